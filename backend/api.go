@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// maxAPIBodySize limits the size of command bodies accepted over HTTP
+const maxAPIBodySize = 1 << 20
+
+// APIError is the JSON body returned for requests rejected before a command is executed
+type APIError struct {
+	Error string `json:"error"`
+}
+
+// RegisterAPI registers the REST/JSON endpoints under the given path prefix (e.g. "/" or "/secret/").
+// They mirror the WebSocket protocol so scripts can read and change the list without a WebSocket:
+//
+//	GET  <prefix>api/state         current StateRollup
+//	POST <prefix>api/commands      execute a command, same JSON as over the WebSocket
+//	GET  <prefix>api/autocomplete  suggestions for ?q=<query>&limit=<n>&offset=<n>
+func (s *Server) RegisterAPI(mux *http.ServeMux, prefix string) {
+	mux.HandleFunc("GET "+prefix+"api/state", s.handleAPIState)
+	mux.HandleFunc("POST "+prefix+"api/commands", s.handleAPICommand)
+	mux.HandleFunc("GET "+prefix+"api/autocomplete", s.handleAPIAutocomplete)
+}
+
+// handleAPIState returns the current state rollup
+func (s *Server) handleAPIState(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.stateRollup())
+}
+
+// handleAPICommand executes a command posted as JSON and broadcasts the resulting event
+// to connected clients, answering with a CommandResponse and a status code matching the outcome
+func (s *Server) handleAPICommand(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, APIError{Error: "request body too large"})
+		return
+	}
+
+	// Parse and validate command
+	cmd, err := ParseCommand(body)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		writeJSON(w, commandErrorStatus(err), invalidCommandResponse(body, validationErr))
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIError{Error: "invalid command: " + err.Error()})
+		return
+	}
+	if cmd == nil {
+		writeJSON(w, http.StatusBadRequest, APIError{Error: "unknown command type"})
+		return
+	}
+
+	slog.Info("command received via http", "type", cmd.GetType(), "commandId", cmd.GetCommandID())
+
+	// The resulting event is broadcast so connected clients see the change live
+	s.handleCommand(cmd, func(response CommandResponse, err error) {
+		writeJSON(w, commandErrorStatus(err), response)
+	})
+}
+
+// handleAPIAutocomplete returns autocomplete suggestions for the q query parameter
+func (s *Server) handleAPIAutocomplete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := queryInt(query.Get("limit"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIError{Error: "invalid limit"})
+		return
+	}
+	offset, err := queryInt(query.Get("offset"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, APIError{Error: "invalid offset"})
+		return
+	}
+
+	suggestions, total, err := s.getAutocompletePage(r.Context(), query.Get("q"), limit, offset)
+	if err != nil {
+		// The client went away
+		return
+	}
+
+	writeJSON(w, http.StatusOK, AutocompleteResponse{
+		Type:        "AutocompleteResponse",
+		Suggestions: suggestions,
+		RequestID:   query.Get("requestId"),
+		Total:       total,
+	})
+}
+
+// queryInt parses an optional non-negative integer query parameter (empty means 0)
+func queryInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n, nil
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal http response", "error", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
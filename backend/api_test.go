@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestAPI(t *testing.T) (*Server, *httptest.Server) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+
+	server := NewServer(store)
+	useTestHelloTimeout(server)
+	go server.Run()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", server.HandleWebSocket)
+	server.RegisterAPI(mux, "/secret/")
+
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+func postCommand(t *testing.T, ts *httptest.Server, body string) (int, CommandResponse) {
+	resp, err := http.Post(ts.URL+"/secret/api/commands", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var cmdResp CommandResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&cmdResp))
+	return resp.StatusCode, cmdResp
+}
+
+func TestAPI_GetState(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	status, _ := postCommand(t, ts, `{"type":"CreateTodo","commandId":"c1","id":"todo-1","name":"Milk"}`)
+	require.Equal(t, http.StatusOK, status)
+
+	resp, err := http.Get(ts.URL + "/secret/api/state")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var rollup StateRollup
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rollup))
+	assert.Equal(t, "StateRollup", rollup.Type)
+	require.Len(t, rollup.Todos, 1)
+	assert.Equal(t, "Milk", rollup.Todos[0].Name)
+}
+
+func TestAPI_CommandBroadcastsToWebSocketClients(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	conn := connectWS(t, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws")
+	defer conn.Close()
+	conn.ReadMessage() // skip rollup
+	conn.ReadMessage() // skip client count
+
+	status, cmdResp := postCommand(t, ts, `{"type":"SetListTitle","commandId":"http-1","title":"Groceries"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "CommandResponse", cmdResp.Type)
+	assert.Equal(t, "http-1", cmdResp.CommandID)
+	assert.True(t, cmdResp.Success)
+
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var event ListTitleChanged
+	require.NoError(t, json.Unmarshal(msg, &event))
+	assert.Equal(t, "ListTitleChanged", event.Type)
+	assert.Equal(t, "Groceries", event.Title)
+}
+
+func TestAPI_CommandErrorStatusCodes(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	status, _ := postCommand(t, ts, `{"type":"CreateCategory","commandId":"c1","id":"cat-1","name":"Dairy"}`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = postCommand(t, ts, `{"type":"CreateTodo","commandId":"c2","id":"todo-1","name":"Milk","categoryId":"cat-1"}`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = postCommand(t, ts, `{"type":"SetDuplicatePolicy","commandId":"c3","policy":"reject"}`)
+	require.Equal(t, http.StatusOK, status)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"not found", `{"type":"CategorizeTodo","commandId":"e1","id":"missing","categoryId":"cat-1"}`, http.StatusNotFound},
+		{"conflict", `{"type":"DeleteCategory","commandId":"e2","id":"cat-1"}`, http.StatusConflict},
+		{"duplicate", `{"type":"CreateTodo","commandId":"e3","id":"todo-2","name":"milk"}`, http.StatusConflict},
+		{"invalid", `{"type":"SetDuplicatePolicy","commandId":"e4","policy":"sometimes"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, cmdResp := postCommand(t, ts, tt.body)
+			assert.Equal(t, tt.status, status)
+			assert.False(t, cmdResp.Success)
+			assert.NotEmpty(t, cmdResp.Error)
+		})
+	}
+}
+
+func TestAPI_RejectMalformedCommand(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	for _, body := range []string{`not json`, `{"type":"NoSuchCommand","commandId":"x"}`} {
+		resp, err := http.Post(ts.URL+"/secret/api/commands", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		var apiErr APIError
+		require.NoError(t, json.Unmarshal(data, &apiErr))
+		assert.NotEmpty(t, apiErr.Error)
+	}
+}
+
+func TestAPI_MethodAndPrefixEnforced(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	resp, err := http.Get(ts.URL + "/secret/api/commands")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/api/state")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAPI_Autocomplete(t *testing.T) {
+	server, ts := setupTestAPI(t)
+
+	for _, name := range []string{"Bread", "Butter", "Beans"} {
+		server.state.nameFrequency[strings.ToLower(name)] = 1
+		server.state.nameCanonical[strings.ToLower(name)] = name
+	}
+
+	resp, err := http.Get(ts.URL + "/secret/api/autocomplete?q=b&limit=2&requestId=r1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var acResp AutocompleteResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&acResp))
+	assert.Equal(t, "AutocompleteResponse", acResp.Type)
+	assert.Equal(t, "r1", acResp.RequestID)
+	assert.Equal(t, 3, acResp.Total)
+	assert.Len(t, acResp.Suggestions, 2)
+
+	resp, err = http.Get(ts.URL + "/secret/api/autocomplete?q=b&limit=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
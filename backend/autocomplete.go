@@ -3,17 +3,19 @@
 package main
 
 import (
+	"context"
 	"sort"
 	"strings"
 	"unicode"
 )
 
-// levenshteinDistance calculates the Levenshtein edit distance between two strings
+// levenshteinDistance calculates the Levenshtein edit distance in runes between two strings
 // using the Wagner-Fischer algorithm with O(min(m,n)) space complexity
-func levenshteinDistance(s1, s2 string) int {
-	// Convert to lowercase for case-insensitive comparison
-	s1 = strings.ToLower(s1)
-	s2 = strings.ToLower(s2)
+func levenshteinDistance(a, b string) int {
+	// Convert to lowercase for case-insensitive comparison; compare runes so a typo in
+	// "mjölk" counts as one edit
+	s1 := []rune(strings.ToLower(a))
+	s2 := []rune(strings.ToLower(b))
 
 	// Ensure s1 is the shorter string to minimize space usage
 	if len(s1) > len(s2) {
@@ -56,12 +58,32 @@ func levenshteinDistance(s1, s2 string) int {
 	return prevRow[m]
 }
 
+// pinnedScoreBonus lifts pinned names above any frequency-based score
+const pinnedScoreBonus = 1e9
+
+// Autocomplete paging limits: requests without a limit get defaultAutocompleteLimit
+// suggestions and no request gets more than maxAutocompleteLimit
+const (
+	defaultAutocompleteLimit = 4
+	maxAutocompleteLimit     = 50
+)
+
+// Match types reported with each suggestion
+const (
+	MatchTypeAll       = "all" // Empty query, every name matches
+	MatchTypePrefix    = "prefix"
+	MatchTypeSubstring = "substring"
+	MatchTypeFuzzy     = "fuzzy"
+)
+
 // suggestionCandidate holds a suggestion with its ranking score
 type suggestionCandidate struct {
 	name         string
+	matched      string // Variant the query was scored against
 	frequency    int
 	distance     int
 	score        float64
+	matchType    string
 	categoryID   *string
 	categoryName *string
 }
@@ -98,64 +120,134 @@ func containsEmoji(s string) bool {
 	return false
 }
 
-// getAutocompleteSuggestions returns up to 4 autocomplete suggestions based on query
-// It uses fuzzy matching with Levenshtein distance and ranks by frequency + recency of category
+// matchName scores how well a name matches the query.
+// Returns false if the name is too far from the query to be suggested.
+func matchName(query, name string, freq int) (matchType string, distance int, matchScore float64, ok bool) {
+	queryLower := strings.ToLower(query)
+	nameLower := strings.ToLower(name)
+
+	if query == "" {
+		// Empty query: match all, score based on frequency only
+		return MatchTypeAll, 0, float64(freq) * 1000, true
+	}
+
+	// Check for prefix match first (higher priority)
+	switch {
+	case strings.HasPrefix(nameLower, queryLower):
+		return MatchTypePrefix, 0, float64(freq)*1000 + 500, true // Bonus for prefix match
+	case strings.Contains(nameLower, queryLower):
+		// Substring match
+		return MatchTypeSubstring, 0, float64(freq)*1000 + 250, true // Bonus for substring match
+	default:
+		// Calculate Levenshtein distance
+		distance = levenshteinDistance(query, name)
+
+		// Only include if distance <= 3
+		if distance > 3 {
+			return "", distance, 0, false
+		}
+
+		return MatchTypeFuzzy, distance, float64(freq)*1000 - float64(distance)*100, true
+	}
+}
+
+// matchRanges returns the half-open [start, end) rune ranges of name that match the query,
+// for clients to highlight. Contiguous matches yield a single range; otherwise the query's
+// runes are matched in order as a subsequence. Matching is case-insensitive.
+func matchRanges(query, name string) [][2]int {
+	queryRunes := []rune(strings.ToLower(query))
+	nameRunes := []rune(name)
+	if len(queryRunes) == 0 {
+		return [][2]int{}
+	}
+	for i, r := range nameRunes {
+		nameRunes[i] = unicode.ToLower(r)
+	}
+
+	// Contiguous match (prefix or substring)
+	for start := 0; start+len(queryRunes) <= len(nameRunes); start++ {
+		if string(nameRunes[start:start+len(queryRunes)]) == string(queryRunes) {
+			return [][2]int{{start, start + len(queryRunes)}}
+		}
+	}
+
+	// Fuzzy match: greedily match query runes in order, merging adjacent positions
+	ranges := [][2]int{}
+	q := 0
+	for i := 0; i < len(nameRunes) && q < len(queryRunes); i++ {
+		if nameRunes[i] != queryRunes[q] {
+			continue
+		}
+		q++
+		if n := len(ranges); n > 0 && ranges[n-1][1] == i {
+			ranges[n-1][1] = i + 1
+		} else {
+			ranges = append(ranges, [2]int{i, i + 1})
+		}
+	}
+	return ranges
+}
+
+// getAutocompleteSuggestions returns the default number of autocomplete suggestions for a query
 func (s *Server) getAutocompleteSuggestions(query string) []AutocompleteSuggestion {
-	// Get all todo names from history with their frequencies
-	nameFrequency := s.state.GetNameFrequency()
+	suggestions, _, _ := s.getAutocompletePage(context.Background(), query, defaultAutocompleteLimit, 0)
+	return suggestions
+}
+
+// getAutocompletePage returns up to limit autocomplete suggestions starting at offset, and the
+// total number of matching names. Returns the context's error if it is cancelled mid-way. It uses fuzzy matching with Levenshtein distance and ranks by
+// frequency + recency of category. Names are grouped by normalized key (case, plurals, synonyms)
+// and suggested under their most recent casing; a query matching any variant suggests the group.
+func (s *Server) getAutocompletePage(ctx context.Context, query string, limit, offset int) ([]AutocompleteSuggestion, int, error) {
+	if limit <= 0 {
+		limit = defaultAutocompleteLimit
+	}
+	limit = min(limit, maxAutocompleteLimit)
+	offset = max(offset, 0)
+
+	// Get all todo names from history grouped by normalized key
+	groups := s.state.GetNameGroups()
 
-	// Get active todo names to filter out (case-insensitive)
+	// Get active todo names to filter out (by normalized key)
 	activeTodos := s.state.GetActiveTodoNames()
 	activeSet := make(map[string]bool)
 	for _, name := range activeTodos {
-		activeSet[strings.ToLower(name)] = true
+		activeSet[s.state.NameKey(name)] = true
 	}
 
-	queryLower := strings.ToLower(query)
+	// Pinned favourites always rank first for an empty query
+	pinned := s.state.GetPinnedKeys()
+
 	var candidates []suggestionCandidate
 
-	for name, freq := range nameFrequency {
-		nameLower := strings.ToLower(name)
+	for _, group := range groups {
+		// Stop early when a newer request supersedes this one
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
 
 		// Skip if this name is already in the active todo list
-		if activeSet[nameLower] {
+		if activeSet[group.Key] {
 			continue
 		}
 
-		var distance int
-		var matchScore float64
-
-		if query == "" {
-			// Empty query: match all, score based on frequency only
-			distance = 0
-			matchScore = float64(freq) * 1000
-		} else {
-			// Check for prefix match first (higher priority)
-			switch {
-			case strings.HasPrefix(nameLower, queryLower):
-				distance = 0
-				matchScore = float64(freq)*1000 + 500 // Bonus for prefix match
-			case strings.Contains(nameLower, queryLower):
-				// Substring match
-				distance = 0
-				matchScore = float64(freq)*1000 + 250 // Bonus for substring match
-			default:
-				// Calculate Levenshtein distance
-				distance = levenshteinDistance(query, name)
-
-				// Only include if distance <= 3
-				if distance > 3 {
-					continue
-				}
-
-				matchScore = float64(freq)*1000 - float64(distance)*100
+		// Score the display name first, then let any other variant improve on it
+		matchType, distance, matchScore, matched := matchName(query, group.Display, group.Frequency)
+		matchedVariant := group.Display
+		for _, variant := range group.Variants {
+			if mt, d, score, ok := matchName(query, variant, group.Frequency); ok && (!matched || score > matchScore) {
+				matchType, distance, matchScore, matched = mt, d, score, true
+				matchedVariant = variant
 			}
 		}
+		if !matched {
+			continue
+		}
 
 		// Attach last known category (recency-based suggestion)
 		var categoryID *string
 		var categoryName *string
-		if lastCat := s.state.GetLastCategoryForName(name); lastCat != nil {
+		if lastCat := group.CategoryID; lastCat != nil {
 			categoryID = lastCat
 			if cat, ok := s.state.GetCategory(*lastCat); ok {
 				// Store a copy of the string value to avoid dangling pointer
@@ -167,34 +259,68 @@ func (s *Server) getAutocompleteSuggestions(query string) []AutocompleteSuggesti
 		}
 
 		// Bonus for items with emojis - they're more fun! 🎉
-		if containsEmoji(name) {
+		if containsEmoji(group.Display) {
 			matchScore += 300
 		}
 
+		if query == "" && pinned[group.Key] != "" {
+			matchScore += pinnedScoreBonus
+			delete(pinned, group.Key)
+		}
+
 		candidates = append(candidates, suggestionCandidate{
-			name:         name,
-			frequency:    freq,
+			name:         group.Display,
+			matched:      matchedVariant,
+			frequency:    group.Frequency,
 			distance:     distance,
 			score:        matchScore,
+			matchType:    matchType,
 			categoryID:   categoryID,
 			categoryName: categoryName,
 		})
 	}
 
-	// Sort by score (descending)
+	// Pinned names without any history yet are still suggested
+	if query == "" {
+		for key, name := range pinned {
+			if activeSet[key] {
+				continue
+			}
+			candidates = append(candidates, suggestionCandidate{
+				name:      name,
+				matched:   name,
+				score:     pinnedScoreBonus,
+				matchType: MatchTypeAll,
+			})
+		}
+	}
+
+	// Sort by score (descending), then by name so pages are stable between requests
 	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].score > candidates[j].score
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].name < candidates[j].name
 	})
 
-	// Take top 4
-	result := make([]AutocompleteSuggestion, 0, 4)
-	for i := 0; i < len(candidates) && i < 4; i++ {
+	// Take the requested page
+	result := make([]AutocompleteSuggestion, 0, limit)
+	for i := offset; i < len(candidates) && i < offset+limit; i++ {
+		// Only the suggested name itself can be highlighted, not another variant or a synonym
+		matches := [][2]int{}
+		if strings.EqualFold(candidates[i].matched, candidates[i].name) {
+			matches = matchRanges(query, candidates[i].name)
+		}
 		result = append(result, AutocompleteSuggestion{
 			Name:         candidates[i].name,
 			CategoryID:   candidates[i].categoryID,
 			CategoryName: candidates[i].categoryName,
+			MatchType:    candidates[i].matchType,
+			Score:        candidates[i].score,
+			Frequency:    candidates[i].frequency,
+			Matches:      matches,
 		})
 	}
 
-	return result
+	return result, len(candidates), nil
 }
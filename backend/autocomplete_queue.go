@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+)
+
+// autocompleteQueue coalesces a client's autocomplete requests so only the latest one is worked on.
+// Queuing a request replaces any request still waiting and cancels the one in flight, so fast
+// typists never build up a backlog of stale queries.
+type autocompleteQueue struct {
+	mu      sync.Mutex
+	pending *AutocompleteRequest
+	cancel  context.CancelFunc // Cancels the in-flight request, nil when idle
+	stopped bool
+	wake    chan struct{} // Signals the worker that a request is pending (buffered, size 1)
+	exited  chan struct{} // Closed when the worker goroutine returns
+}
+
+func newAutocompleteQueue() *autocompleteQueue {
+	return &autocompleteQueue{
+		wake:   make(chan struct{}, 1),
+		exited: make(chan struct{}),
+	}
+}
+
+// push queues req as the latest request, superseding everything queued or in flight before it
+func (q *autocompleteQueue) push(req AutocompleteRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+	if q.pending != nil {
+		slog.Debug("dropping superseded autocomplete request", "requestId", q.pending.RequestID)
+	}
+	q.pending = &req
+	if q.cancel != nil {
+		q.cancel()
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+		// Worker already has a wake-up pending
+	}
+}
+
+// next blocks until a request is pending and returns it with a context that is cancelled
+// once a newer request is pushed. Returns false after stop.
+func (q *autocompleteQueue) next() (AutocompleteRequest, context.Context, bool) {
+	for range q.wake {
+		q.mu.Lock()
+		if q.stopped {
+			q.mu.Unlock()
+			return AutocompleteRequest{}, nil, false
+		}
+		if q.pending == nil {
+			q.mu.Unlock()
+			continue
+		}
+		req := *q.pending
+		q.pending = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		q.cancel = cancel
+		q.mu.Unlock()
+		return req, ctx, true
+	}
+	return AutocompleteRequest{}, nil, false
+}
+
+// done releases the context of the request returned by the last call to next
+func (q *autocompleteQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.cancel != nil {
+		q.cancel()
+		q.cancel = nil
+	}
+}
+
+// stop cancels in-flight work and makes next return false
+func (q *autocompleteQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+	q.stopped = true
+	q.pending = nil
+	if q.cancel != nil {
+		q.cancel()
+	}
+	close(q.wake)
+}
+
+// autocompletePump computes autocomplete responses for a client off the read loop.
+// It exits once the client's queue is stopped, closing the queue's exited channel.
+func (s *Server) autocompletePump(client *Client) {
+	defer close(client.autocomplete.exited)
+
+	for {
+		req, ctx, ok := client.autocomplete.next()
+		if !ok {
+			return
+		}
+
+		suggestions, total, err := s.getAutocompletePage(ctx, req.Query, req.Limit, req.Offset)
+		superseded := err != nil || ctx.Err() != nil
+		client.autocomplete.done()
+		if superseded {
+			// Superseded by a newer request while computing
+			slog.Debug("autocomplete request cancelled", "requestId", req.RequestID)
+			continue
+		}
+
+		// Create response
+		response := AutocompleteResponse{
+			Type:        "AutocompleteResponse",
+			Suggestions: suggestions,
+			RequestID:   req.RequestID,
+			Total:       total,
+		}
+
+		// Send response only to the requesting client
+		responseData, err := json.Marshal(response)
+		if err != nil {
+			slog.Error("failed to marshal autocomplete response", "error", err)
+			continue
+		}
+
+		// Send directly to client, not broadcast
+		if !client.send(responseData) {
+			slog.Warn("client gone or send buffer full, dropping autocomplete response")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutocompleteQueue_CoalescesPendingRequests(t *testing.T) {
+	q := newAutocompleteQueue()
+
+	q.push(AutocompleteRequest{Query: "m", RequestID: "1"})
+	q.push(AutocompleteRequest{Query: "mi", RequestID: "2"})
+	q.push(AutocompleteRequest{Query: "mil", RequestID: "3"})
+
+	req, ctx, ok := q.next()
+	require.True(t, ok)
+	assert.Equal(t, "3", req.RequestID)
+	assert.NoError(t, ctx.Err())
+	q.done()
+
+	// Nothing else is pending
+	q.push(AutocompleteRequest{Query: "milk", RequestID: "4"})
+	req, _, ok = q.next()
+	require.True(t, ok)
+	assert.Equal(t, "4", req.RequestID)
+}
+
+func TestAutocompleteQueue_NewerRequestCancelsInFlight(t *testing.T) {
+	q := newAutocompleteQueue()
+
+	q.push(AutocompleteRequest{RequestID: "old"})
+	_, ctx, ok := q.next()
+	require.True(t, ok)
+
+	q.push(AutocompleteRequest{RequestID: "new"})
+	assert.Error(t, ctx.Err(), "in-flight request should be cancelled")
+	q.done()
+
+	req, ctx, ok := q.next()
+	require.True(t, ok)
+	assert.Equal(t, "new", req.RequestID)
+	assert.NoError(t, ctx.Err())
+}
+
+func TestAutocompleteQueue_Stop(t *testing.T) {
+	q := newAutocompleteQueue()
+
+	q.push(AutocompleteRequest{RequestID: "in-flight"})
+	_, ctx, ok := q.next()
+	require.True(t, ok)
+
+	q.stop()
+	assert.Error(t, ctx.Err())
+
+	// Pushing after stop is ignored and next reports the queue is closed
+	q.push(AutocompleteRequest{RequestID: "late"})
+	_, _, ok = q.next()
+	assert.False(t, ok)
+
+	// Stopping twice is safe
+	q.stop()
+}
+
+func TestAutocomplete_RapidRequestsAnswerLatestAndDontBlockCommands(t *testing.T) {
+	server, ts, wsURL := setupTestServerWithTodos(t)
+	defer ts.Close()
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // rollup
+	conn.ReadMessage() // client count
+
+	// Fire a burst of keystrokes followed by a command
+	const burst = 50
+	for i := 0; i < burst; i++ {
+		data, _ := json.Marshal(AutocompleteRequest{
+			Type:      "AutocompleteRequest",
+			Query:     "Milk"[:1+i%4],
+			RequestID: fmt.Sprintf("req-%d", i),
+		})
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, data))
+	}
+	cmdData, _ := json.Marshal(SetListTitleCommand{
+		BaseCommand: BaseCommand{Type: "SetListTitle", CommandID: "title"},
+		Title:       "Groceries",
+	})
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, cmdData))
+
+	// Read until the command's event and the latest autocomplete response have both arrived
+	responses := 0
+	lastRequestID := ""
+	commandDone := false
+	for !commandDone || lastRequestID != fmt.Sprintf("req-%d", burst-1) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+
+		var typeCheck struct {
+			Type      string `json:"type"`
+			RequestID string `json:"requestId"`
+		}
+		require.NoError(t, json.Unmarshal(msg, &typeCheck))
+		switch typeCheck.Type {
+		case "AutocompleteResponse":
+			responses++
+			lastRequestID = typeCheck.RequestID
+		case "ListTitleChanged":
+			commandDone = true
+		}
+	}
+
+	assert.Equal(t, "Groceries", server.state.GetListTitle())
+	assert.LessOrEqual(t, responses, burst)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -47,6 +48,13 @@ func TestLevenshteinDistance_MultipleDifferences(t *testing.T) {
 	assert.Equal(t, 2, levenshteinDistance("book", "back")) // 2 subs: o->a, o->c
 }
 
+func TestLevenshteinDistance_CountsRunes(t *testing.T) {
+	assert.Equal(t, 1, levenshteinDistance("mjölk", "mjolk"))
+	assert.Equal(t, 1, levenshteinDistance("bröd", "brod"))
+	assert.Equal(t, 1, levenshteinDistance("Gräddfil", "graddfil"))
+	assert.Equal(t, 2, levenshteinDistance("Ägg", "aggs")) // ä -> a and an insertion
+}
+
 func TestLevenshteinDistance_CaseInsensitive(t *testing.T) {
 	assert.Equal(t, 0, levenshteinDistance("MILK", "milk"))
 	assert.Equal(t, 0, levenshteinDistance("Bread", "BREAD"))
@@ -92,7 +100,7 @@ func setupTestServerWithTodos(t *testing.T) (*Server, *httptest.Server, string)
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 
 	server := NewServer(store)
@@ -125,6 +133,7 @@ func setupTestServerWithTodos(t *testing.T) (*Server, *httptest.Server, string)
 	err = server.LoadEvents()
 	require.NoError(t, err)
 
+	useTestHelloTimeout(server)
 	go server.Run()
 
 	ts := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
@@ -190,7 +199,7 @@ func TestAutocomplete_FuzzyMatch(t *testing.T) {
 func TestAutocomplete_MaxFourSuggestions(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	now := time.Now()
@@ -273,8 +282,7 @@ func TestAutocomplete_WebSocketIntegration(t *testing.T) {
 	_, ts, wsURL := setupTestServerWithTodos(t)
 	defer ts.Close()
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	require.NoError(t, err)
+	conn := connectWS(t, wsURL)
 	defer conn.Close()
 
 	// Read initial rollup and client count
@@ -288,7 +296,7 @@ func TestAutocomplete_WebSocketIntegration(t *testing.T) {
 		RequestID: "test-123",
 	}
 	requestData, _ := json.Marshal(request)
-	err = conn.WriteMessage(websocket.TextMessage, requestData)
+	err := conn.WriteMessage(websocket.TextMessage, requestData)
 	require.NoError(t, err)
 
 	// Read autocomplete response
@@ -309,18 +317,14 @@ func TestAutocomplete_ResponseOnlyToRequestingClient(t *testing.T) {
 	_, ts, wsURL := setupTestServerWithTodos(t)
 	defer ts.Close()
 
-	// Connect two clients
-	conn1, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	require.NoError(t, err)
+	// Connect two clients, one after the other was admitted
+	conn1 := connectWS(t, wsURL)
 	defer conn1.Close()
-
-	conn2, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	require.NoError(t, err)
-	defer conn2.Close()
-
-	// Read initial messages
 	conn1.ReadMessage() // rollup
 	conn1.ReadMessage() // client count 1
+
+	conn2 := connectWS(t, wsURL)
+	defer conn2.Close()
 	conn2.ReadMessage() // rollup
 	conn2.ReadMessage() // client count 2
 	conn1.ReadMessage() // client count 2 update
@@ -355,7 +359,7 @@ func TestAutocomplete_ResponseOnlyToRequestingClient(t *testing.T) {
 func TestAutocomplete_SubstringMatch(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	now := time.Now()
@@ -382,7 +386,7 @@ func TestContainsEmoji(t *testing.T) {
 func TestAutocomplete_PrefersEmojis(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	now := time.Now()
@@ -404,7 +408,7 @@ func TestAutocomplete_PrefersEmojis(t *testing.T) {
 func TestAutocomplete_EmptyQueryPrefersEmojis(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	now := time.Now()
@@ -426,7 +430,7 @@ func TestAutocomplete_EmptyQueryPrefersEmojis(t *testing.T) {
 func TestAutocomplete_ReturnsCategoryContext(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	now := time.Now()
@@ -441,3 +445,196 @@ func TestAutocomplete_ReturnsCategoryContext(t *testing.T) {
 	assert.Equal(t, &catID, suggestions[0].CategoryID)
 	assert.Equal(t, "Office", *suggestions[0].CategoryName)
 }
+
+func TestAutocomplete_GroupsNormalizedNames(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "events.jsonl")
+	store, _ := NewJSONLStore(filePath)
+	server := NewServer(store)
+
+	now := time.Now()
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "1", Name: "tomatoes", CreatedAt: now, SortOrder: 1000})
+	store.Append(TodoCompleted{Type: "TodoCompleted", ID: "1", CompletedAt: now})
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Tomato", CreatedAt: now, SortOrder: 2000})
+	store.Append(TodoCompleted{Type: "TodoCompleted", ID: "2", CompletedAt: now})
+	// Stemming groups plurals within a language; words of different languages need a synonym
+	store.Append(SynonymAdded{Type: "SynonymAdded", Name: "tomater", Canonical: "tomato"})
+	server.LoadEvents()
+
+	// One suggestion for the whole group, under the most recent casing
+	assert.Equal(t, []string{"Tomato"}, suggestionNames(server.getAutocompleteSuggestions("tom")))
+
+	// A Swedish query still matches through the synonym's variants once it has been used
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Tomater", CreatedAt: now, SortOrder: 3000})
+	server.state.Apply(TodoCompleted{Type: "TodoCompleted", ID: "3", CompletedAt: now})
+	assert.Equal(t, []string{"Tomater"}, suggestionNames(server.getAutocompleteSuggestions("tomater")))
+}
+
+func TestAutocomplete_VariantMatchHasNoHighlights(t *testing.T) {
+	store, _ := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	server := NewServer(store)
+
+	now := time.Now()
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Eggplant", CreatedAt: now, SortOrder: 1000})
+	store.Append(TodoCompleted{Type: "TodoCompleted", ID: "1", CompletedAt: now})
+	store.Append(SynonymAdded{Type: "SynonymAdded", Name: "eggplant", Canonical: "aubergine"})
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Aubergine", CreatedAt: now, SortOrder: 2000})
+	store.Append(TodoCompleted{Type: "TodoCompleted", ID: "2", CompletedAt: now})
+	server.LoadEvents()
+
+	// The synonym's variant matched, so nothing in the suggested name is highlighted
+	suggestions := server.getAutocompleteSuggestions("egg")
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "Aubergine", suggestions[0].Name)
+	assert.Equal(t, MatchTypePrefix, suggestions[0].MatchType)
+	assert.Equal(t, [][2]int{}, suggestions[0].Matches)
+
+	// The suggested name itself matching is still highlighted
+	suggestions = server.getAutocompleteSuggestions("aub")
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, [][2]int{{0, 3}}, suggestions[0].Matches)
+}
+
+func TestAutocomplete_FilterOutActivePluralVariant(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "events.jsonl")
+	store, _ := NewJSONLStore(filePath)
+	server := NewServer(store)
+
+	now := time.Now()
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Eggs", CreatedAt: now, SortOrder: 1000})
+	store.Append(TodoCompleted{Type: "TodoCompleted", ID: "1", CompletedAt: now})
+	store.Append(TodoCreated{Type: "TodoCreated", ID: "2", Name: "egg", CreatedAt: now, SortOrder: 2000})
+	server.LoadEvents()
+
+	// "egg" is active, so the "Eggs" group is not suggested
+	assert.Empty(t, server.getAutocompleteSuggestions("Egg"))
+}
+
+func TestAutocomplete_PinnedNamesRankFirstForEmptyQuery(t *testing.T) {
+	server, ts, _ := setupTestServerWithTodos(t)
+	defer ts.Close()
+
+	server.state.Apply(NamePinned{Type: "NamePinned", Name: "Eggs"})
+	server.state.Apply(NamePinned{Type: "NamePinned", Name: "Coffee"})
+	server.state.Apply(NamePinned{Type: "NamePinned", Name: "Butter"})
+
+	suggestions := suggestionNames(server.getAutocompleteSuggestions(""))
+
+	// Pinned names come first, including ones without history; active ones are still hidden
+	require.Len(t, suggestions, 4)
+	assert.ElementsMatch(t, []string{"Eggs", "Coffee"}, suggestions[:2])
+	assert.Equal(t, "Milk", suggestions[2])
+	assert.NotContains(t, suggestions, "Butter")
+
+	// Pins don't affect ranking for a typed query
+	assert.Equal(t, []string{"Milk"}, suggestionNames(server.getAutocompleteSuggestions("Mi")))
+}
+
+func TestMatchRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		target   string
+		expected [][2]int
+	}{
+		{"empty query", "", "Milk", [][2]int{}},
+		{"prefix", "mi", "Milk", [][2]int{{0, 2}}},
+		{"substring", "milk", "Whole Milk", [][2]int{{6, 10}}},
+		{"fuzzy subsequence", "mlk", "Milk", [][2]int{{0, 1}, {2, 4}}},
+		{"rune offsets", "mjö", "Mjölk 🥛", [][2]int{{0, 3}}},
+		{"emoji before match", "br", "🍞 Bread", [][2]int{{2, 4}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchRanges(tt.query, tt.target))
+		})
+	}
+}
+
+func TestAutocomplete_SuggestionMatchDetails(t *testing.T) {
+	server, ts, _ := setupTestServerWithTodos(t)
+	defer ts.Close()
+
+	prefix := server.getAutocompleteSuggestions("Mi")
+	require.NotEmpty(t, prefix)
+	assert.Equal(t, "Milk", prefix[0].Name)
+	assert.Equal(t, MatchTypePrefix, prefix[0].MatchType)
+	assert.Equal(t, 3, prefix[0].Frequency)
+	assert.Equal(t, [][2]int{{0, 2}}, prefix[0].Matches)
+	assert.Greater(t, prefix[0].Score, 0.0)
+
+	fuzzy := server.getAutocompleteSuggestions("Mlk")
+	require.NotEmpty(t, fuzzy)
+	assert.Equal(t, MatchTypeFuzzy, fuzzy[0].MatchType)
+
+	all := server.getAutocompleteSuggestions("")
+	require.NotEmpty(t, all)
+	assert.Equal(t, MatchTypeAll, all[0].MatchType)
+}
+
+func TestAutocomplete_LimitAndOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "events.jsonl")
+	store, _ := NewJSONLStore(filePath)
+	server := NewServer(store)
+
+	now := time.Now()
+	// 10 distinct items, item i used i+1 times so the ranking is fully determined
+	for i := 0; i < 10; i++ {
+		name := "Item " + string(rune('A'+i))
+		for j := 0; j <= i; j++ {
+			id := name + string(rune('0'+j))
+			store.Append(TodoCreated{Type: "TodoCreated", ID: id, Name: name, CreatedAt: now, SortOrder: 1000})
+			store.Append(TodoCompleted{Type: "TodoCompleted", ID: id, CompletedAt: now})
+		}
+	}
+	server.LoadEvents()
+
+	page, total, err := server.getAutocompletePage(context.Background(), "", 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, page, defaultAutocompleteLimit)
+	assert.Equal(t, 10, total)
+
+	page, _, _ = server.getAutocompletePage(context.Background(), "", 3, 0)
+	assert.Equal(t, []string{"Item J", "Item I", "Item H"}, suggestionNames(page))
+
+	page, _, _ = server.getAutocompletePage(context.Background(), "", 3, 8)
+	assert.Equal(t, []string{"Item B", "Item A"}, suggestionNames(page))
+
+	page, _, _ = server.getAutocompletePage(context.Background(), "", 3, 20)
+	assert.Empty(t, page)
+
+	page, _, _ = server.getAutocompletePage(context.Background(), "", 1000, -5)
+	assert.Len(t, page, 10)
+}
+
+func TestAutocomplete_WebSocketLimitAndTotal(t *testing.T) {
+	_, ts, wsURL := setupTestServerWithTodos(t)
+	defer ts.Close()
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // rollup
+	conn.ReadMessage() // client count
+
+	requestData, _ := json.Marshal(AutocompleteRequest{
+		Type:      "AutocompleteRequest",
+		Query:     "",
+		RequestID: "paged",
+		Limit:     1,
+		Offset:    1,
+	})
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, requestData))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var response AutocompleteResponse
+	require.NoError(t, json.Unmarshal(msg, &response))
+	assert.Equal(t, []string{"Bread"}, suggestionNames(response.Suggestions))
+	// Milk, Bread and Eggs match; Butter is active
+	assert.Equal(t, 3, response.Total)
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// backupTimeFormat timestamps backup file names so they sort chronologically
+const backupTimeFormat = "20060102T150405Z"
+
+// backupPrefix starts the name of every backup file, which is followed by the timestamp
+// and the log's extension, e.g. events-20250101T020000Z.jsonl
+const backupPrefix = "events-"
+
+// backupFileName returns the name of a backup of the backend's log taken at t
+func backupFileName(backend StoreBackend, t time.Time) (string, error) {
+	path, err := backend.Path("")
+	if err != nil {
+		return "", err
+	}
+	return backupPrefix + t.UTC().Format(backupTimeFormat) + filepath.Ext(path), nil
+}
+
+// WriteBackupFile writes a consistent snapshot of the store into dir and returns its path
+// and the number of events it holds. The file only appears under its final name once complete.
+func WriteBackupFile(store EventStore, backend StoreBackend, dir string, now time.Time) (string, int, error) {
+	name, err := backupFileName(backend, now)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	count, err := store.Backup(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	path := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to save backup: %w", err)
+	}
+	if err := syncDir(dir); err != nil {
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+// pruneBackups deletes the oldest backups of the backend in dir, keeping the newest keep
+func pruneBackups(dir string, backend StoreBackend, keep int) error {
+	path, err := backend.Path("")
+	if err != nil {
+		return err
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+filepath.Ext(path)))
+	if err != nil {
+		return err
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// Timestamps in the names sort chronologically
+	slices.Sort(backups)
+	var errs []error
+	for _, old := range backups[:len(backups)-keep] {
+		if err := os.Remove(old); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunScheduledBackups writes a backup into dir every interval, keeping the newest retention
+// backups, until ctx is done
+func RunScheduledBackups(ctx context.Context, store EventStore, backend StoreBackend, dir string, interval time.Duration, retention int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			path, count, err := WriteBackupFile(store, backend, dir, now)
+			if err != nil {
+				slog.Error("scheduled backup failed", "error", err)
+				continue
+			}
+			slog.Info("scheduled backup written", "file", path, "event_count", count)
+			if err := pruneBackups(dir, backend, retention); err != nil {
+				slog.Error("failed to prune old backups", "error", err)
+			}
+		}
+	}
+}
+
+// RegisterBackup registers the admin backup download under the given path prefix:
+//
+//	GET <prefix>admin/backup  consistent snapshot of the event log, in the backend's file format
+//
+// Requests must carry "Authorization: Bearer <token>". The snapshot's event count is
+// returned in the X-Event-Count header.
+func (s *Server) RegisterBackup(mux *http.ServeMux, prefix, token string, backend StoreBackend) {
+	mux.HandleFunc("GET "+prefix+"admin/backup", func(w http.ResponseWriter, r *http.Request) {
+		s.handleBackup(w, r, token, backend)
+	})
+}
+
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request, token string, backend StoreBackend) {
+	want := "Bearer " + token
+	if token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, APIError{Error: "unauthorized"})
+		return
+	}
+
+	name, err := backupFileName(backend, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, APIError{Error: err.Error()})
+		return
+	}
+
+	// Spool the snapshot to a temporary file, so a failure can still be reported with an
+	// error status and memory doesn't grow with the log
+	file, size, count, err := s.spoolBackup()
+	if err != nil {
+		slog.Error("backup failed", "error", err)
+		writeJSON(w, http.StatusInternalServerError, APIError{Error: "backup failed"})
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Event-Count", strconv.Itoa(count))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		slog.Warn("backup download interrupted", "error", err)
+		return
+	}
+	slog.Info("backup downloaded", "event_count", count, "bytes", size)
+}
+
+// spoolBackup writes a snapshot of the store to a temporary file, rewound for reading.
+// Returns the file with its size and the number of events; the caller removes it.
+func (s *Server) spoolBackup() (*os.File, int64, int, error) {
+	file, err := os.CreateTemp("", "foodlist-backup-*")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	count, err := s.store.Backup(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = file.Stat()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, 0, 0, err
+	}
+	return file, info.Size(), count, nil
+}
+
+// replayEvents applies events to a fresh State, as LoadEvents would on startup,
+// and fails if any of them can't be applied
+func replayEvents(events []Event) (state *State, err error) {
+	state = NewState()
+	for i, event := range events {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("event %d (%s) can't be applied: %v", i, event.EventType(), r)
+				}
+			}()
+			state.Apply(event)
+		}()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// runRestore implements the "restore" subcommand, which replaces the event log with a backup:
+//
+//	foodlist restore -file BACKUP [-backend jsonl] [-data-dir DIR]
+//
+// The backup must be readable with the configured encryption key and replay cleanly into
+// a fresh state before it replaces the log; the replaced log is kept in a directory next to it.
+// Fails with ErrStoreLocked while the server is using the data directory. Returns the process exit code.
+func runRestore(args []string, backend StoreBackend, dataDir string, cipher *EventCipher, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	file := flags.String("file", "", "backup file to restore")
+	flags.StringVar((*string)(&backend), "backend", string(backend), "store backend the backup was taken from (jsonl or bolt)")
+	flags.StringVar(&dataDir, "data-dir", dataDir, "directory holding the event store")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(stderr, "restore: -file is required")
+		return 2
+	}
+
+	if err := restoreBackup(backend, dataDir, *file, cipher, time.Now(), stdout); err != nil {
+		fmt.Fprintf(stderr, "restore: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func restoreBackup(backend StoreBackend, dataDir, backupPath string, cipher *EventCipher, now time.Time, stdout io.Writer) error {
+	path, err := backend.Path(dataDir)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	// Copy the backup next to the log first, so what is validated is exactly what gets swapped in
+	tmp, err := os.CreateTemp(dataDir, ".restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if err := copyFileTo(tmp, backupPath); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	state, count, err := validateBackup(backend, tmp.Name(), cipher)
+	if err != nil {
+		return fmt.Errorf("backup is not valid: %w", err)
+	}
+
+	// Keep the current log, all its segments, in case the wrong backup was restored
+	current, err := backend.Files(path)
+	if err != nil {
+		return err
+	}
+	kept := ""
+	if len(current) > 0 {
+		kept = filepath.Join(dataDir, "pre-restore-"+now.UTC().Format(backupTimeFormat))
+		if err := moveFiles(current, kept); err != nil {
+			return fmt.Errorf("failed to move current event log aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	if err := syncDir(dataDir); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "restored %d events (%d todos, %d categories) to %s\n", count, state.TodoCount(), len(state.GetCategories()), path)
+	if kept != "" {
+		fmt.Fprintf(stdout, "previous event log kept in %s\n", kept)
+	}
+	return nil
+}
+
+// validateBackup reads a backup file as the backend's log and replays it into a fresh State
+func validateBackup(backend StoreBackend, path string, cipher *EventCipher) (*State, int, error) {
+	opts := DefaultStoreOptions()
+	opts.ReadOnly = true
+	opts.Cipher = cipher
+	store, err := OpenEventStore(backend, path, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer store.Close()
+
+	events, err := store.ReadAll()
+	if err != nil {
+		return nil, 0, err
+	}
+	state, err := replayEvents(events)
+	if err != nil {
+		return nil, 0, err
+	}
+	return state, len(events), nil
+}
+
+// copyFileTo copies the file at path into dst and syncs dst
+func copyFileTo(dst *os.File, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+	return dst.Sync()
+}
+
+// backupDir returns where scheduled backups are kept within dataDir
+func backupDir(dataDir string) string {
+	return filepath.Join(dataDir, "backups")
+}
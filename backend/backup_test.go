@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyCompleteLines_DropsPartialLastLine(t *testing.T) {
+	var buf bytes.Buffer
+	count, err := copyCompleteLines(&buf, strings.NewReader("{\"a\":1}\n\n{\"b\":2}\n{\"c\""))
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "{\"a\":1}\n\n{\"b\":2}\n", buf.String())
+}
+
+func TestWriteBackupFile_AndRetention(t *testing.T) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.Append(createdEvent(1)))
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	start := time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		path, count, err := WriteBackupFile(store, StoreBackendJSONL, dir, start.Add(time.Duration(i)*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, fmt.Sprintf("events-20250101T%02d0000Z.jsonl", 2+i), filepath.Base(path))
+	}
+
+	require.NoError(t, pruneBackups(dir, StoreBackendJSONL, 2))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"events-20250101T040000Z.jsonl", "events-20250101T050000Z.jsonl"}, names)
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.AppendBatch([]Event{createdEvent(1), createdEvent(2)}))
+	spoolDir := t.TempDir()
+	t.Setenv("TMPDIR", spoolDir)
+
+	server := NewServer(store)
+	mux := http.NewServeMux()
+	server.RegisterBackup(mux, "/secret/", "s3cret", StoreBackendJSONL)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(auth string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/secret/admin/backup", nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, get("").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, get("Bearer wrong").StatusCode)
+
+	resp := get("Bearer s3cret")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("X-Event-Count"))
+	assert.Contains(t, resp.Header.Get("Content-Disposition"), ".jsonl")
+
+	var body bytes.Buffer
+	_, err = body.ReadFrom(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(body.String(), "\n"))
+	assert.Contains(t, body.String(), `"id":"todo-2"`)
+	assert.Equal(t, int64(body.Len()), resp.ContentLength)
+
+	// The spooled snapshot is removed once sent
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(spoolDir)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// writeBackupOf creates a store in its own directory holding events and returns a backup file of it
+func writeBackupOf(t *testing.T, backend StoreBackend, cipher *EventCipher, events ...Event) string {
+	path, _ := backend.Path(t.TempDir())
+	opts := DefaultStoreOptions()
+	opts.Cipher = cipher
+	store, err := OpenEventStore(backend, path, opts)
+	require.NoError(t, err)
+	defer store.Close()
+	require.NoError(t, store.AppendBatch(events))
+
+	backup, _, err := WriteBackupFile(store, backend, t.TempDir(), time.Now())
+	require.NoError(t, err)
+	return backup
+}
+
+func TestRestore_ReplacesLogAndKeepsPrevious(t *testing.T) {
+	for _, backend := range []StoreBackend{StoreBackendJSONL, StoreBackendBolt} {
+		t.Run(string(backend), func(t *testing.T) {
+			_, cipher := newTestKey(t)
+			backup := writeBackupOf(t, backend, cipher, createdEvent(1), createdEvent(2), createdEvent(3))
+
+			// The current log holds something else
+			dataDir := t.TempDir()
+			path, _ := backend.Path(dataDir)
+			opts := DefaultStoreOptions()
+			opts.Cipher = cipher
+			current, err := OpenEventStore(backend, path, opts)
+			require.NoError(t, err)
+			require.NoError(t, current.Append(createdEvent(9)))
+			require.NoError(t, current.Close())
+
+			var stdout, stderr bytes.Buffer
+			code := runRestore([]string{"-file", backup}, backend, dataDir, cipher, &stdout, &stderr)
+			require.Equal(t, 0, code, stderr.String())
+			assert.Contains(t, stdout.String(), "restored 3 events (3 todos, 0 categories)")
+			assert.Contains(t, stdout.String(), "previous event log kept in")
+
+			restored, err := OpenEventStore(backend, path, opts)
+			require.NoError(t, err)
+			events, err := restored.ReadAll()
+			require.NoError(t, err)
+			require.NoError(t, restored.Close())
+			assert.Equal(t, []string{"todo-1", "todo-2", "todo-3"}, eventIDs(events))
+
+			kept, err := filepath.Glob(filepath.Join(dataDir, "pre-restore-*", filepath.Base(path)))
+			require.NoError(t, err)
+			require.Len(t, kept, 1)
+		})
+	}
+}
+
+func TestRestore_RejectsInvalidBackup(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "events.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"ListTitleChanged","title":"Keep me"}`+"\n"), 0o644))
+
+	_, cipher := newTestKey(t)
+	encrypted := writeBackupOf(t, StoreBackendJSONL, cipher, createdEvent(1))
+	garbage := filepath.Join(t.TempDir(), "garbage.jsonl")
+	require.NoError(t, os.WriteFile(garbage, []byte("not an event\n"), 0o644))
+
+	cases := map[string][]string{
+		"garbage":       {"-file", garbage},
+		"wrong key":     {"-file", encrypted},
+		"wrong backend": {"-file", garbage, "-backend", "bolt"},
+		"missing file":  {"-file", filepath.Join(t.TempDir(), "missing")},
+	}
+	for name, args := range cases {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, 1, runRestore(args, StoreBackendJSONL, dataDir, nil, &stdout, &stderr))
+
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Contains(t, string(data), "Keep me", "log must be untouched")
+		})
+	}
+
+	leftovers, err := filepath.Glob(filepath.Join(dataDir, ".restore-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+}
+
+func TestRestore_RefusedWhileServerRunning(t *testing.T) {
+	backup := writeBackupOf(t, StoreBackendJSONL, nil, createdEvent(1))
+
+	dataDir := t.TempDir()
+	running, err := NewJSONLStore(filepath.Join(dataDir, "events.jsonl"))
+	require.NoError(t, err)
+	defer running.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, runRestore([]string{"-file", backup}, StoreBackendJSONL, dataDir, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), ErrStoreLocked.Error())
+}
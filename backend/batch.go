@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxBatchSize limits how many commands a single Batch may carry
+const maxBatchSize = 500
+
+// EventBatch broadcasts the events of a batch as one message, in order.
+// It is only sent to clients; the store keeps the individual events.
+type EventBatch struct {
+	Type      string  `json:"type"`
+	CommandID string  `json:"commandId"`
+	Events    []Event `json:"events"`
+}
+
+func (e EventBatch) EventType() string { return "EventBatch" }
+func (e EventBatch) GetID() string     { return "" }
+
+// CommandResult reports the outcome of one command in a batch
+type CommandResult struct {
+	CommandID string            `json:"commandId"`
+	Success   bool              `json:"success"`
+	Error     string            `json:"error,omitempty"`  // English message of the code
+	Code      ErrorCode         `json:"code,omitempty"`   // Why the command was rejected or not applied
+	Params    map[string]string `json:"params,omitempty"` // Values of the placeholders in the code's message template
+}
+
+// BatchError is returned when a command in a batch is rejected, which rejects the whole batch.
+// It wraps the command's error, so its kind decides the status of the batch.
+type BatchError struct {
+	Index int // Position of the rejected command in the batch
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("command %d: %s", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BatchCommand carries several commands that are validated, persisted and applied together
+type BatchCommand struct {
+	BaseCommand
+	Commands []json.RawMessage `json:"commands"`
+	parsed   []Command         // Commands parsed by ParseCommand
+}
+
+// Batches have no event producer of their own: executeCommand runs their commands
+func init() {
+	registerCommandHandler("Batch", &commandHandler{decode: decodeBatch})
+}
+
+func decodeBatch(data []byte) (Command, error) {
+	var cmd BatchCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, err
+	}
+	if err := cmd.parseCommands(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// parseCommands parses the batch's sub-commands. Batches can't be nested.
+func (c *BatchCommand) parseCommands() error {
+	if len(c.Commands) == 0 {
+		return errors.New("batch has no commands")
+	}
+	if len(c.Commands) > maxBatchSize {
+		return fmt.Errorf("batch has %d commands, at most %d are allowed", len(c.Commands), maxBatchSize)
+	}
+
+	// The schema validated the commands along with the batch
+	c.parsed = make([]Command, len(c.Commands))
+	for i, data := range c.Commands {
+		cmd, err := decodeCommand(data)
+		if err != nil {
+			return fmt.Errorf("command %d: %w", i, err)
+		}
+		if cmd == nil {
+			return fmt.Errorf("command %d: %w", i, errUnknownCommand)
+		}
+		if _, nested := cmd.(BatchCommand); nested {
+			return fmt.Errorf("command %d: batches can't be nested", i)
+		}
+		c.parsed[i] = cmd
+	}
+	return nil
+}
+
+// results reports the outcome of each command in the batch given the batch's error.
+// A rejected batch applies nothing, so every command is reported as failed.
+func (c BatchCommand) results(err error) []CommandResult {
+	var batchErr *BatchError
+	errors.As(err, &batchErr)
+
+	results := make([]CommandResult, len(c.parsed))
+	for i, cmd := range c.parsed {
+		results[i] = CommandResult{CommandID: cmd.GetCommandID(), Success: err == nil}
+		switch {
+		case err == nil:
+			continue
+		case batchErr != nil && batchErr.Index == i:
+			results[i].Code, results[i].Params = errorCode(batchErr.Err)
+		case batchErr != nil:
+			results[i].Code = ErrorCodeNotAppliedBatchRejected
+			results[i].Params = map[string]string{"index": strconv.Itoa(batchErr.Index)}
+		default:
+			results[i].Code = ErrorCodeNotApplied
+		}
+		results[i].Error = errorMessage(results[i].Code, results[i].Params)
+	}
+	return results
+}
+
+// convertBatch validates every command of a batch against the state as left by the commands
+// before it and returns the resulting events, to be persisted and applied all at once.
+// If any command is rejected no events are returned. Must be called with commandMu held.
+func (s *Server) convertBatch(batch BatchCommand) (Event, []Event, error) {
+	// Validate on a scratch copy so each command sees the effects of earlier ones
+	scratch := s.state.clone()
+	events := make([]Event, 0, len(batch.parsed))
+	for i, cmd := range batch.parsed {
+		event, err := convertCommand(scratch, cmd)
+		if err == nil && event == nil {
+			err = invalid(ErrorCodeNoEvent)
+		}
+		if err != nil {
+			return nil, nil, &BatchError{Index: i, Err: err}
+		}
+		scratch.Apply(event)
+		events = append(events, event)
+	}
+
+	return EventBatch{Type: "EventBatch", CommandID: batch.CommandID, Events: events}, events, nil
+}
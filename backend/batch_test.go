@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommand_Batch(t *testing.T) {
+	cmd, err := ParseCommand([]byte(`{"type":"Batch","commandId":"b1","commands":[
+		{"type":"CreateCategory","commandId":"c1","id":"cat-1","name":"Dairy"},
+		{"type":"CreateTodo","commandId":"c2","id":"todo-1","name":"Milk","categoryId":"cat-1"}
+	]}`))
+	require.NoError(t, err)
+	batch, ok := cmd.(BatchCommand)
+	require.True(t, ok)
+	require.Len(t, batch.parsed, 2)
+	assert.IsType(t, CreateCategoryCommand{}, batch.parsed[0])
+	assert.IsType(t, CreateTodoCommand{}, batch.parsed[1])
+}
+
+func TestParseCommand_BatchRejectsInvalidContent(t *testing.T) {
+	tests := map[string]string{
+		"empty":   `{"type":"Batch","commandId":"b1","commands":[]}`,
+		"unknown": `{"type":"Batch","commandId":"b1","commands":[{"type":"NoSuchCommand","commandId":"c1"}]}`,
+		"nested":  `{"type":"Batch","commandId":"b1","commands":[{"type":"Batch","commandId":"b2","commands":[{"type":"SetListTitle","commandId":"c1","title":"x"}]}]}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCommand([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExecuteBatch_LaterCommandsSeeEarlierOnes(t *testing.T) {
+	server, ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	cmd, err := ParseCommand([]byte(`{"type":"Batch","commandId":"b1","commands":[
+		{"type":"CreateCategory","commandId":"c1","id":"cat-1","name":"Dairy"},
+		{"type":"CreateTodo","commandId":"c2","id":"todo-1","name":"Milk","categoryId":"cat-1"},
+		{"type":"CreateTodo","commandId":"c3","id":"todo-2","name":"Cheese","categoryId":"cat-1"}
+	]}`))
+	require.NoError(t, err)
+
+	var response CommandResponse
+	event, err := server.handleCommand(cmd, func(r CommandResponse, _ error) { response = r })
+	require.NoError(t, err)
+	assert.True(t, response.Success)
+	require.Len(t, response.Results, 3)
+	for _, result := range response.Results {
+		assert.True(t, result.Success)
+	}
+
+	batch, ok := event.(EventBatch)
+	require.True(t, ok)
+	assert.Len(t, batch.Events, 3)
+
+	// Applied to the state
+	todo, ok := server.state.GetTodo("todo-2")
+	require.True(t, ok)
+	assert.Equal(t, "cat-1", *todo.CategoryID)
+
+	// Created todos get increasing sort orders, as if sent one by one
+	milk, _ := server.state.GetTodo("todo-1")
+	assert.Greater(t, todo.SortOrder, milk.SortOrder)
+
+	// Persisted as individual events
+	events, err := server.store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "CategoryCreated", events[0].EventType())
+}
+
+func TestExecuteBatch_RejectedCommandAppliesNothing(t *testing.T) {
+	server, ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	cmd, err := ParseCommand([]byte(`{"type":"Batch","commandId":"b1","commands":[
+		{"type":"CreateTodo","commandId":"c1","id":"todo-1","name":"Milk"},
+		{"type":"CategorizeTodo","commandId":"c2","id":"todo-1","categoryId":"missing"},
+		{"type":"SetListTitle","commandId":"c3","title":"Never"}
+	]}`))
+	require.NoError(t, err)
+
+	var response CommandResponse
+	event, err := server.handleCommand(cmd, func(r CommandResponse, _ error) { response = r })
+	require.Error(t, err)
+	assert.Nil(t, event)
+	assert.False(t, response.Success)
+	assert.Equal(t, http.StatusNotFound, commandErrorStatus(err))
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, "c2", response.Results[1].CommandID)
+	assert.Equal(t, ErrorCodeCategoryNotFound, response.Results[1].Code)
+	assert.Equal(t, "category not found", response.Results[1].Error)
+	assert.Equal(t, ErrorCodeNotAppliedBatchRejected, response.Results[0].Code)
+	assert.Equal(t, map[string]string{"index": "1"}, response.Results[0].Params)
+	assert.Equal(t, ErrorCodeBatchRejected, response.Code)
+	for _, result := range response.Results {
+		assert.False(t, result.Success)
+		assert.NotEmpty(t, result.Error)
+	}
+
+	// Nothing applied or persisted
+	assert.Equal(t, 0, server.state.TodoCount())
+	assert.Equal(t, "My Todo List", server.state.GetListTitle())
+	events, err := server.store.ReadAll()
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestServer_BatchBroadcastAsOneMessage(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // skip rollup
+	conn.ReadMessage() // skip client count
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Batch","commandId":"b1","commands":[
+		{"type":"CreateTodo","commandId":"c1","id":"todo-1","name":"Flour"},
+		{"type":"CreateTodo","commandId":"c2","id":"todo-2","name":"Sugar"}
+	]}`))
+
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var response CommandResponse
+	require.NoError(t, json.Unmarshal(msg, &response))
+	assert.Equal(t, "b1", response.CommandID)
+	assert.True(t, response.Success)
+	assert.Len(t, response.Results, 2)
+
+	_, msg, err = conn.ReadMessage()
+	require.NoError(t, err)
+	var batch struct {
+		Type      string            `json:"type"`
+		CommandID string            `json:"commandId"`
+		Events    []json.RawMessage `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(msg, &batch))
+	assert.Equal(t, "EventBatch", batch.Type)
+	assert.Equal(t, "b1", batch.CommandID)
+	require.Len(t, batch.Events, 2)
+	event, err := ParseEvent(batch.Events[1])
+	require.NoError(t, err)
+	assert.Equal(t, "Sugar", event.(TodoCreated).Name)
+}
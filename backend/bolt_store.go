@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	berrors "go.etcd.io/bbolt/errors"
+)
+
+// boltEventsBucket holds the events, keyed by their big-endian sequence number starting at 1
+var boltEventsBucket = []byte("events")
+
+// BoltStore is an EventStore keeping events in an embedded single-file bbolt database.
+// Every append is its own transaction, synced before it returns; bbolt serializes writers.
+type BoltStore struct {
+	db        *bolt.DB
+	readOnly  bool
+	cipher    *EventCipher
+	lock      *dirLock // Held on the data directory unless read-only
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewBoltStore opens the bbolt database at filePath for writing, creating it if it doesn't exist
+func NewBoltStore(filePath string) (*BoltStore, error) {
+	return NewBoltStoreWithOptions(filePath, StoreOptions{})
+}
+
+// NewBoltStoreWithOptions opens the bbolt database at filePath. Of the options only ReadOnly
+// and Cipher apply, since every bbolt transaction is synced. A writable store holds an exclusive lock
+// on the file's directory until closed, and fails with ErrStoreLocked if another process holds it.
+// A read-only store needs an existing database and waits at most a second for a writer
+// of the same database file, like a running server, to let go of it before failing with
+// ErrStoreLocked.
+func NewBoltStoreWithOptions(filePath string, opts StoreOptions) (*BoltStore, error) {
+	var lock *dirLock
+	if !opts.ReadOnly {
+		var err error
+		if lock, err = lockDataDir(filepath.Dir(filePath)); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(filePath, 0o644, &bolt.Options{Timeout: time.Second, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		lock.release()
+		if errors.Is(err, berrors.ErrTimeout) {
+			return nil, fmt.Errorf("%w: stop the server to read the bolt database", ErrStoreLocked)
+		}
+		return nil, fmt.Errorf("failed to open event store database: %w", err)
+	}
+
+	if !opts.ReadOnly {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(boltEventsBucket)
+			return err
+		})
+		if err != nil {
+			db.Close()
+			lock.release()
+			return nil, fmt.Errorf("failed to create events bucket: %w", err)
+		}
+	}
+
+	return &BoltStore{db: db, readOnly: opts.ReadOnly, cipher: opts.Cipher, lock: lock}, nil
+}
+
+// Append adds an event to the store
+func (s *BoltStore) Append(event Event) error {
+	return s.AppendBatch([]Event{event})
+}
+
+// AppendAsync appends events right away, since every bolt transaction is synced on its own
+// commit, and returns a channel holding the outcome
+func (s *BoltStore) AppendAsync(events []Event) <-chan error {
+	resultCh := make(chan error, 1)
+	resultCh <- s.AppendBatch(events)
+	return resultCh
+}
+
+// AppendBatch adds several events to the store in a single transaction,
+// so either all of them are stored or, on error, none are
+func (s *BoltStore) AppendBatch(events []Event) error {
+	if s.readOnly {
+		return ErrStoreReadOnly
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEventsBucket)
+		for _, event := range events {
+			data, err := MarshalStoredEvent(event)
+			if err != nil {
+				return fmt.Errorf("failed to marshal event: %w", err)
+			}
+			if data, err = s.cipher.Seal(data); err != nil {
+				return fmt.Errorf("failed to encrypt event: %w", err)
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(boltKey(seq), data); err != nil {
+				return fmt.Errorf("failed to write event: %w", err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) {
+		return ErrStoreClosed
+	}
+	return err
+}
+
+// ReadAll reads all events from the store
+func (s *BoltStore) ReadAll() ([]Event, error) {
+	return s.ReadFrom(0)
+}
+
+// ReadFrom reads the events after the first position events, in order
+func (s *BoltStore) ReadFrom(position int) ([]Event, error) {
+	position = max(position, 0)
+	var events []Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEventsBucket)
+		if bucket == nil {
+			// Read-only store of a database that was never written
+			return nil
+		}
+		cursor := bucket.Cursor()
+		for key, data := cursor.Seek(boltKey(uint64(position) + 1)); key != nil; key, data = cursor.Next() {
+			plain, err := s.cipher.Open(data)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt event %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			event, err := ParseStoredEvent(plain)
+			if err != nil {
+				return fmt.Errorf("failed to parse event %d: %w", binary.BigEndian.Uint64(key), err)
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) {
+		return nil, ErrStoreClosed
+	}
+	return events, err
+}
+
+// Backup writes a consistent copy of the database to w, from a read transaction so appends
+// continue meanwhile, and returns the number of events in it. The copy is itself a bbolt
+// database, with events encrypted if the store is.
+func (s *BoltStore) Backup(w io.Writer) (int, error) {
+	count := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(boltEventsBucket); bucket != nil {
+			// Keys are never deleted, so the sequence is the number of events
+			count = int(bucket.Sequence())
+		}
+		_, err := tx.WriteTo(w)
+		return err
+	})
+	if errors.Is(err, berrors.ErrDatabaseNotOpen) {
+		return 0, ErrStoreClosed
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to back up event store: %w", err)
+	}
+	return count, nil
+}
+
+// Close waits for running transactions, closes the database and releases the lock.
+// Safe to call more than once.
+func (s *BoltStore) Close() error {
+	s.closeOnce.Do(func() {
+		s.closeErr = errors.Join(s.db.Close(), s.lock.release())
+	})
+	return s.closeErr
+}
+
+// boltKey encodes a sequence number so keys sort in append order
+func boltKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
@@ -0,0 +1,142 @@
+package main
+
+import "time"
+
+type CreateCategoryCommand struct {
+	BaseCommand
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	SortOrder float64 `json:"sortOrder,omitempty"`
+}
+
+type RenameCategoryCommand struct {
+	BaseCommand
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type DeleteCategoryCommand struct {
+	BaseCommand
+	ID string `json:"id"`
+}
+
+type ReorderCategoryCommand struct {
+	BaseCommand
+	ID        string  `json:"id"`
+	SortOrder float64 `json:"sortOrder"`
+}
+
+func init() {
+	registerCommand("CreateCategory", checkCreateCategory, createCategory)
+	registerCommand("RenameCategory", checkRenameCategory, func(_ *State, c RenameCategoryCommand) (Event, error) {
+		return CategoryRenamed{Type: "CategoryRenamed", ID: c.ID, Name: c.Name}, nil
+	})
+	registerCommand("DeleteCategory", checkDeleteCategory, func(_ *State, c DeleteCategoryCommand) (Event, error) {
+		return CategoryDeleted{Type: "CategoryDeleted", ID: c.ID}, nil
+	})
+	registerCommand("ReorderCategory", checkReorderCategory, func(_ *State, c ReorderCategoryCommand) (Event, error) {
+		return CategoryReordered{Type: "CategoryReordered", ID: c.ID, SortOrder: int(c.SortOrder)}, nil
+	})
+
+	registerProjector((*State).applyCategoryCreated)
+	registerProjector((*State).applyCategoryRenamed)
+	registerProjector((*State).applyCategoryDeleted)
+	registerProjector((*State).applyCategoryReordered)
+}
+
+func checkCreateCategory(state *State, c CreateCategoryCommand) error {
+	if c.ID == "" {
+		return invalid(ErrorCodeMissingCategoryID)
+	}
+
+	// Check if an active category with this name already exists
+	if state.CategoryNameExists(c.Name) {
+		return conflict(ErrorCodeCategoryNameTaken, "name", c.Name)
+	}
+	return nil
+}
+
+// createCategory creates a category, reusing the ID of a deleted category with the same name
+func createCategory(state *State, c CreateCategoryCommand) (Event, error) {
+	// Check if there's a deleted category with the same name (case-sensitive)
+	deletedCategoryID := state.FindDeletedCategoryByName(c.Name)
+
+	// If a deleted category with this name exists, reuse its ID
+	categoryID := c.ID
+	if deletedCategoryID != "" {
+		categoryID = deletedCategoryID
+	}
+
+	sortOrder := state.GetHighestCategorySortOrder() + 1000
+	if c.SortOrder != 0 {
+		sortOrder = int(c.SortOrder)
+	}
+	return CategoryCreated{
+		Type:      "CategoryCreated",
+		ID:        categoryID,
+		Name:      c.Name,
+		CreatedAt: time.Now().UTC(),
+		SortOrder: sortOrder,
+	}, nil
+}
+
+func checkRenameCategory(state *State, c RenameCategoryCommand) error {
+	currentCat, ok := state.GetCategory(c.ID)
+	if !ok {
+		return notFound(ErrorCodeCategoryNotFound, "id", c.ID)
+	}
+
+	// Check if another category with this name already exists
+	if state.CategoryNameExists(c.Name) && currentCat.Name != c.Name {
+		return conflict(ErrorCodeCategoryNameTaken, "name", c.Name)
+	}
+	return nil
+}
+
+func checkDeleteCategory(state *State, c DeleteCategoryCommand) error {
+	if state.CategoryHasTodos(c.ID) {
+		return conflict(ErrorCodeCategoryNotEmpty, "id", c.ID)
+	}
+	if _, ok := state.GetCategory(c.ID); !ok {
+		return notFound(ErrorCodeCategoryNotFound, "id", c.ID)
+	}
+	return nil
+}
+
+func checkReorderCategory(state *State, c ReorderCategoryCommand) error {
+	if _, ok := state.GetCategory(c.ID); !ok {
+		return notFound(ErrorCodeCategoryNotFound, "id", c.ID)
+	}
+	return nil
+}
+
+func (s *State) applyCategoryCreated(e CategoryCreated) {
+	s.categories[e.ID] = &Category{
+		ID:        e.ID,
+		Name:      e.Name,
+		CreatedAt: e.CreatedAt,
+		SortOrder: e.SortOrder,
+	}
+	// Remove from deleted categories if it was deleted before
+	delete(s.deletedCategories, e.ID)
+}
+
+func (s *State) applyCategoryRenamed(e CategoryRenamed) {
+	if cat, ok := s.categories[e.ID]; ok {
+		cat.Name = e.Name
+	}
+}
+
+func (s *State) applyCategoryDeleted(e CategoryDeleted) {
+	// Before deleting, store the category name for potential reuse
+	if cat, ok := s.categories[e.ID]; ok {
+		s.deletedCategories[e.ID] = cat.Name
+	}
+	delete(s.categories, e.ID)
+}
+
+func (s *State) applyCategoryReordered(e CategoryReordered) {
+	if cat, ok := s.categories[e.ID]; ok {
+		cat.SortOrder = e.SortOrder
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+// ChecksumMode controls the checksum stored with each line of a JSONL log
+type ChecksumMode string
+
+const (
+	// ChecksumNone stores events without a checksum
+	ChecksumNone ChecksumMode = "none"
+	// ChecksumCRC stores a CRC-32C of each line, which detects bit-rot and accidental edits
+	ChecksumCRC ChecksumMode = "crc32c"
+	// ChecksumChain stores a SHA-256 over each line and the previous line's hash, so editing,
+	// removing or reordering lines is evident from the line on
+	ChecksumChain ChecksumMode = "chain"
+)
+
+// ErrChecksumMismatch is returned when a line doesn't match its checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Validate checks the checksum mode
+func (m ChecksumMode) Validate() error {
+	switch m {
+	case ChecksumNone, ChecksumCRC, ChecksumChain:
+		return nil
+	default:
+		return fmt.Errorf("unknown checksum mode '%s'", m)
+	}
+}
+
+// A checksum is written as "<algorithm>:<hex>". On a JSON line it is added as a last
+// "checksum" field, so the log stays valid JSON lines and ParseStoredEvent ignores it. On an
+// encrypted line it follows a tab. It covers the line as it was without the checksum.
+const (
+	checksumField  = `,"checksum":"`
+	crcPrefix      = "crc32c:"
+	chainPrefix    = "sha256:"
+	crcChecksumLen = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// addChecksum returns the line with its checksum in the given mode, and the hash that the
+// next line in chain mode is chained to. prev is the hash of the previous line, if chained.
+func addChecksum(line []byte, mode ChecksumMode, prev []byte) ([]byte, []byte) {
+	var sum string
+	var head []byte
+	switch mode {
+	case ChecksumCRC:
+		sum = crcPrefix + fmt.Sprintf("%08x", crc32.Checksum(line, crcTable))
+	case ChecksumChain:
+		head = chainHash(prev, line)
+		sum = chainPrefix + hex.EncodeToString(head)
+	default:
+		return line, nil
+	}
+
+	if bytes.HasSuffix(line, []byte("}")) {
+		out := make([]byte, 0, len(line)+len(checksumField)+len(sum)+2)
+		out = append(out, line[:len(line)-1]...)
+		out = append(out, checksumField...)
+		out = append(out, sum...)
+		return append(out, `"}`...), head
+	}
+	return append(append(append([]byte{}, line...), '\t'), sum...), head
+}
+
+// chainHash hashes a line together with the previous line's hash
+func chainHash(prev, line []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(line)
+	return h.Sum(nil)
+}
+
+// errMissingChecksum is returned for a JSON line with a checksum after a tab instead of in its
+// checksum field, which is never written that way
+var errMissingChecksum = errors.New(`missing checksum: JSON lines carry it in a "checksum" field, not after a tab`)
+
+// splitChecksum separates a line into the line as it was checksummed and its checksum,
+// which is empty if the line has none
+func splitChecksum(line []byte) ([]byte, string, error) {
+	if !bytes.HasPrefix(line, []byte("{")) {
+		// Encrypted records never contain tabs
+		if i := bytes.LastIndexByte(line, '\t'); i >= 0 {
+			return line[:i], string(line[i+1:]), nil
+		}
+		return line, "", nil
+	}
+
+	if bytes.HasSuffix(line, []byte(`"}`)) {
+		// JSON escapes quotes inside strings, so the field can't appear within a value
+		if i := bytes.LastIndex(line, []byte(checksumField)); i >= 0 {
+			sum := line[i+len(checksumField) : len(line)-2]
+			payload := make([]byte, 0, i+1)
+			return append(append(payload, line[:i]...), '}'), string(sum), nil
+		}
+	}
+	// JSON escapes tabs inside strings and events are written without whitespace
+	if bytes.IndexByte(line, '\t') >= 0 {
+		return nil, "", errMissingChecksum
+	}
+	return line, "", nil
+}
+
+// lineVerifier checks the checksums of consecutive lines of a log.
+// Chained lines can only be checked when the previous line was read, so a verifier
+// that starts mid-log, or after a line without a hash, accepts the first chained line.
+type lineVerifier struct {
+	prev []byte // Hash of the previous line if it was chained
+
+	// Only when verifying the whole log
+	report      *VerifyReport
+	checksummed bool // A line with a checksum was seen
+}
+
+// lineKind describes which checksum a verified line carried
+type lineKind int
+
+const (
+	lineUnchecked lineKind = iota
+	lineCRC
+	lineChained
+	lineChainStart // Chained, but the previous line wasn't, so the link couldn't be checked
+)
+
+// verify checks a line's checksum and returns the line without it
+func (v *lineVerifier) verify(line []byte) ([]byte, lineKind, error) {
+	payload, sum, err := splitChecksum(line)
+	prev := v.prev
+	v.prev = nil
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case sum == "":
+		return payload, lineUnchecked, nil
+
+	case len(sum) == len(crcPrefix)+crcChecksumLen && sum[:len(crcPrefix)] == crcPrefix:
+		want, err := strconv.ParseUint(sum[len(crcPrefix):], 16, 32)
+		if err != nil {
+			return nil, 0, fmt.Errorf("malformed checksum %q", sum)
+		}
+		if crc32.Checksum(payload, crcTable) != uint32(want) {
+			return nil, 0, ErrChecksumMismatch
+		}
+		return payload, lineCRC, nil
+
+	case len(sum) > len(chainPrefix) && sum[:len(chainPrefix)] == chainPrefix:
+		head, err := hex.DecodeString(sum[len(chainPrefix):])
+		if err != nil || len(head) != sha256.Size {
+			return nil, 0, fmt.Errorf("malformed checksum %q", sum)
+		}
+		v.prev = head
+		if prev == nil {
+			return payload, lineChainStart, nil
+		}
+		if !bytes.Equal(chainHash(prev, payload), head) {
+			return nil, 0, fmt.Errorf("%w: hash chain broken", ErrChecksumMismatch)
+		}
+		return payload, lineChained, nil
+
+	default:
+		return nil, 0, fmt.Errorf("unknown checksum %q", sum)
+	}
+}
+
+// note records a verified line in the report, flagging lines that lack the checksum their
+// predecessors had: unchecked lines after checksummed ones look like manual edits, and a
+// chain starting over after lines were chained hides whatever was cut out before it
+func (v *lineVerifier) note(kind lineKind, file string, line int) {
+	if v.report == nil {
+		return
+	}
+	location := fmt.Sprintf("%s line %d", file, line)
+	switch kind {
+	case lineUnchecked:
+		v.report.Unchecked++
+		if v.checksummed {
+			v.report.Issues = append(v.report.Issues, VerifyIssue{Location: location, Problem: "line has no checksum, but earlier lines have"})
+		}
+	case lineCRC:
+		v.report.CRC++
+	case lineChained, lineChainStart:
+		v.report.Chained++
+		if kind == lineChainStart && v.report.ChainStart != "" {
+			v.report.Issues = append(v.report.Issues, VerifyIssue{Location: location, Problem: "hash chain starts over, lines before it may have been removed or altered"})
+		}
+		if v.report.ChainStart == "" {
+			v.report.ChainStart = location
+		}
+	}
+	v.checksummed = v.checksummed || kind != lineUnchecked
+}
+
+// LogCorruptionError reports where a JSONL log can't be read
+type LogCorruptionError struct {
+	File   string
+	Line   int   // 1-based line number within the file
+	Offset int64 // Byte offset of the line within the file
+	Err    error
+}
+
+func (e *LogCorruptionError) Error() string {
+	return fmt.Sprintf("%s line %d (offset %d): %s", e.File, e.Line, e.Offset, e.Err)
+}
+
+func (e *LogCorruptionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// generateGo renders events_gen.go: the event structs with their Event implementations
+// and decoder registrations, and the other messages and types the server sends. Commands
+// and definitions marked "x-go": "manual" are written by hand.
+func generateGo(s *schema) ([]byte, error) {
+	var shared, messages []property
+	for _, definition := range s.definitions {
+		n := definition.node
+		if !n.isObject() || n.Go == "manual" || s.isEvent(definition.name) || s.isCommand(definition.name) {
+			continue
+		}
+		if typeConst(n) == "" {
+			shared = append(shared, definition)
+		} else {
+			messages = append(messages, definition)
+		}
+	}
+
+	var b strings.Builder
+	for line := range strings.SplitSeq(header, "\n") {
+		fmt.Fprintf(&b, "// %s\n", line)
+	}
+	b.WriteString("\npackage main\n\nimport (\n\t\"encoding/json\"\n")
+	if s.usesTime() {
+		b.WriteString("\t\"time\"\n")
+	}
+	b.WriteString(")\n")
+
+	for _, definition := range s.definitions {
+		if definition.node.Messages != nil {
+			writeGoMessages(&b, definition.name, definition.node)
+		}
+	}
+
+	for _, definition := range shared {
+		s.writeGoStruct(&b, definition.name, definition.node)
+	}
+
+	b.WriteString("\n// Event types")
+	for i, name := range s.events {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		s.writeGoStruct(&b, name, s.definitions.get(name))
+	}
+
+	b.WriteString("\n// Event is an interface for all event types\n")
+	b.WriteString("type Event interface {\n\tEventType() string\n\tGetID() string\n}\n\n")
+	for _, name := range s.events {
+		fmt.Fprintf(&b, "func (e %s) EventType() string { return %q }\n", name, name)
+	}
+	b.WriteString("\n")
+	for _, name := range s.events {
+		if s.definitions.get(name).Properties.get("id") != nil {
+			fmt.Fprintf(&b, "func (e %s) GetID() string { return e.ID }\n", name)
+		} else {
+			fmt.Fprintf(&b, "func (e %s) GetID() string { return \"\" } // %s has no ID\n", name, name)
+		}
+	}
+
+	b.WriteString("\n// Register the decoder of every event; projectors are registered by hand\n")
+	b.WriteString("func init() {\n")
+	for _, name := range s.events {
+		fmt.Fprintf(&b, "\tregisterEvent[%s]()\n", name)
+	}
+	b.WriteString("}\n")
+
+	b.WriteString("\n// MarshalEvent serializes an event to JSON\n")
+	b.WriteString("func MarshalEvent(e Event) ([]byte, error) {\n\treturn json.Marshal(e)\n}\n")
+
+	for _, definition := range messages {
+		s.writeGoStruct(&b, definition.name, definition.node)
+	}
+
+	source, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("generated Go doesn't compile: %w", err)
+	}
+	return source, nil
+}
+
+// generateGoSchema renders the schema itself as a Go constant, for validating messages
+// against it at runtime; the backend module can't embed files outside of it
+func generateGoSchema(data []byte) ([]byte, error) {
+	if bytes.ContainsRune(data, '`') {
+		return nil, fmt.Errorf("the schema can't contain backquotes")
+	}
+	var b strings.Builder
+	for line := range strings.SplitSeq(header, "\n") {
+		fmt.Fprintf(&b, "// %s\n", line)
+	}
+	b.WriteString("\npackage main\n\n")
+	b.WriteString("// eventsSchema is schema/events.schema.json, which commands and events are validated against\n")
+	fmt.Fprintf(&b, "const eventsSchema = `%s`\n", data)
+	return []byte(b.String()), nil
+}
+
+// writeGoMessages writes an enum with message templates as a string type with a constant
+// for every value, and the English templates for them
+func writeGoMessages(b *strings.Builder, name string, n *node) {
+	b.WriteString("\n")
+	if n.Description != "" {
+		fmt.Fprintf(b, "// %s\n", n.Description)
+	}
+	fmt.Fprintf(b, "type %s string\n\nconst (\n", name)
+	for _, value := range n.Enum {
+		fmt.Fprintf(b, "\t%s%s %s = %q\n", name, goName(value), name, value)
+	}
+	b.WriteString(")\n\n")
+	variable := strings.ToLower(name[:1]) + name[1:] + "Messages"
+	fmt.Fprintf(b, "// %s are the English message templates of every %s\n", variable, name)
+	fmt.Fprintf(b, "var %s = map[%s]string{\n", variable, name)
+	for _, value := range n.Enum {
+		fmt.Fprintf(b, "\t%s%s: %q,\n", name, goName(value), n.Messages["en"][value])
+	}
+	b.WriteString("}\n")
+}
+
+func (s *schema) writeGoStruct(b *strings.Builder, name string, n *node) {
+	b.WriteString("\n")
+	if n.Description != "" {
+		fmt.Fprintf(b, "// %s\n", n.Description)
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, prop := range n.Properties {
+		required := n.isRequired(prop.name)
+		tag := prop.name
+		// Optional fields with a default leave it to the receiver when unset
+		if !required && prop.node.Default != nil {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`", goName(prop.name), s.goType(prop.node, required), tag)
+		if prop.node.Description != "" {
+			fmt.Fprintf(b, " // %s", prop.node.Description)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+}
+
+// goType returns the Go type of a property
+func (s *schema) goType(n *node, required bool) string {
+	if n.Ref != "" {
+		name, definition := s.ref(n.Ref)
+		switch {
+		case definition.isEnum() && definition.Messages != nil:
+			return name
+		case definition.isEnum():
+			return "string"
+		case !required:
+			return "*" + name
+		default:
+			return name
+		}
+	}
+	if n.Const != "" || len(n.Enum) > 0 {
+		return "string"
+	}
+	if included, _, ok := s.refExcluding(n); ok {
+		return s.goType(&node{Ref: "#/definitions/" + included}, required)
+	}
+
+	var base string
+	switch n.Type.base() {
+	case "string":
+		base = "string"
+		if n.Format == "date-time" {
+			base = "time.Time"
+		}
+	case "integer":
+		base = "int"
+	case "number":
+		base = "float64"
+	case "boolean":
+		base = "bool"
+	case "array":
+		element := s.goType(n.Items, true)
+		if length, ok := n.fixedLength(); ok {
+			return fmt.Sprintf("[%d]%s", length, element)
+		}
+		return "[]" + element
+	case "object":
+		if values := n.AdditionalProperties.node; values != nil {
+			return "map[string]" + s.goType(values, true)
+		}
+		base = "any"
+	default:
+		base = "any"
+	}
+	if n.Type.nullable() {
+		return "*" + base
+	}
+	return base
+}
+
+// usesTime reports whether any generated struct has a date-time field
+func (s *schema) usesTime() bool {
+	for _, definition := range s.definitions {
+		if definition.node.Go == "manual" || s.isCommand(definition.name) {
+			continue
+		}
+		for _, prop := range definition.node.Properties {
+			if prop.node.Format == "date-time" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// goName turns a JSON property name or snake_case enum value into an exported Go name
+func goName(name string) string {
+	if name == "id" {
+		return "ID"
+	}
+	if prefix, ok := strings.CutSuffix(name, "Id"); ok {
+		name = prefix + "ID"
+	}
+	var b strings.Builder
+	for word := range strings.SplitSeq(name, "_") {
+		switch word {
+		case "":
+		case "id":
+			b.WriteString("ID")
+		default:
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+// Command schemagen generates the Go event types in backend/events_gen.go and the
+// TypeScript types in frontend/src/lib/types.ts from schema/events.schema.json, and embeds
+// the schema itself in backend/events_schema_gen.go for validating messages.
+//
+// Run it with "go generate" in backend/. With -check it only reports generated files that
+// are out of date with the schema, exiting with status 1 if there are any.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("schemagen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	schemaPath := flags.String("schema", "../schema/events.schema.json", "JSON Schema to generate from")
+	goPath := flags.String("go", "events_gen.go", "Go file to write")
+	tsPath := flags.String("ts", "../frontend/src/lib/types.ts", "TypeScript file to write")
+	schemaGoPath := flags.String("schema-go", "events_schema_gen.go", "Go file to write the schema itself to")
+	check := flags.Bool("check", false, "only check that the generated files are up to date")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	files, err := generate(*schemaPath, *goPath, *tsPath, *schemaGoPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "schemagen: %v\n", err)
+		return 1
+	}
+
+	stale := 0
+	for _, file := range files {
+		current, err := os.ReadFile(file.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(stderr, "schemagen: %v\n", err)
+			return 1
+		}
+		if bytes.Equal(current, file.content) {
+			continue
+		}
+		if *check {
+			fmt.Fprintf(stderr, "%s is out of date with %s; run go generate in backend/\n", file.path, *schemaPath)
+			stale++
+			continue
+		}
+		if err := os.WriteFile(file.path, file.content, 0o644); err != nil {
+			fmt.Fprintf(stderr, "schemagen: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "wrote %s\n", file.path)
+	}
+	if stale > 0 {
+		return 1
+	}
+	return 0
+}
+
+// generatedFile is the content a generated file should have
+type generatedFile struct {
+	path    string
+	content []byte
+}
+
+// generate renders the Go and TypeScript files for the schema at schemaPath
+func generate(schemaPath, goPath, tsPath, schemaGoPath string) ([]generatedFile, error) {
+	data, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := parseSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", schemaPath, err)
+	}
+
+	goSource, err := generateGo(schema)
+	if err != nil {
+		return nil, err
+	}
+	tsSource, err := generateTS(schema)
+	if err != nil {
+		return nil, err
+	}
+	schemaSource, err := generateGoSchema(data)
+	if err != nil {
+		return nil, err
+	}
+	return []generatedFile{{goPath, goSource}, {tsPath, tsSource}, {schemaGoPath, schemaSource}}, nil
+}
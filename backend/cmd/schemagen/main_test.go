@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGeneratedFilesAreCurrent fails when the schema changed without regenerating
+func TestGeneratedFilesAreCurrent(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{
+		"-check",
+		"-schema", "../../../schema/events.schema.json",
+		"-go", "../../events_gen.go",
+		"-ts", "../../../frontend/src/lib/types.ts",
+		"-schema-go", "../../events_schema_gen.go",
+	}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+}
+
+const testSchema = `{
+  "definitions": {
+    "Rename": {
+      "type": "object",
+      "properties": {
+        "type": {"const": "Rename"},
+        "commandId": {"type": "string"},
+        "id": {"type": "string"}
+      },
+      "required": ["type", "commandId", "id"]
+    },
+    "Renamed": {
+      "type": "object",
+      "properties": {
+        "type": {"const": "Renamed"},
+        "id": {"type": "string"},
+        "name": {"type": "string", "description": "New name"},
+        "at": {"type": ["string", "null"], "format": "date-time"},
+        "color": {"$ref": "#/definitions/Color"}
+      },
+      "required": ["type", "id", "name"]
+    },
+    "Cleared": {
+      "type": "object",
+      "properties": {
+        "type": {"const": "Cleared"}
+      },
+      "required": ["type"]
+    },
+    "Search": {
+      "type": "object",
+      "description": "Search for names",
+      "x-go": "manual",
+      "properties": {
+        "type": {"const": "Search"},
+        "query": {"type": "string"}
+      },
+      "required": ["type", "query"]
+    },
+    "Result": {
+      "type": "object",
+      "properties": {
+        "type": {"const": "Result"},
+        "limit": {"type": "integer", "default": 4},
+        "ranges": {"type": "array", "items": {"type": "array", "items": {"type": "integer"}, "minItems": 2, "maxItems": 2}},
+        "names": {"type": "array", "items": {"type": ["string", "null"]}},
+        "commands": {"type": "array", "items": {"allOf": [{"$ref": "#/definitions/Command"}, {"not": {"$ref": "#/definitions/Rename"}}]}}
+      },
+      "required": ["type", "ranges"]
+    },
+    "Color": {"enum": ["red", "green"]},
+    "Event": {"oneOf": [{"$ref": "#/definitions/Renamed"}, {"$ref": "#/definitions/Cleared"}]},
+    "Command": {"oneOf": [{"$ref": "#/definitions/Rename"}]},
+    "ServerMessage": {"oneOf": [{"$ref": "#/definitions/Event"}, {"$ref": "#/definitions/Result"}]}
+  }
+}`
+
+func TestGenerate(t *testing.T) {
+	schema, err := parseSchema([]byte(testSchema))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Renamed", "Cleared"}, schema.events)
+
+	goSource, err := generateGo(schema)
+	require.NoError(t, err)
+	goCode := string(goSource)
+	assert.Contains(t, goCode, "// Code generated by schemagen from schema/events.schema.json. DO NOT EDIT.\n")
+	assert.Contains(t, goCode, "\t\"time\"\n")
+	assert.Contains(t, goCode, "\tName  string     `json:\"name\"` // New name\n")
+	assert.Contains(t, goCode, "\tAt    *time.Time `json:\"at\"`\n")
+	assert.Contains(t, goCode, "\tColor string     `json:\"color\"`\n", "enums are strings")
+	assert.Contains(t, goCode, "\tLimit    int       `json:\"limit,omitempty\"`\n", "optional with a default")
+	assert.Contains(t, goCode, "\tRanges   [][2]int  `json:\"ranges\"`\n")
+	assert.Contains(t, goCode, "\tNames    []*string `json:\"names\"`\n")
+	assert.Contains(t, goCode, "func (e Renamed) GetID() string { return e.ID }\n")
+	assert.Contains(t, goCode, "func (e Cleared) GetID() string { return \"\" } // Cleared has no ID\n")
+	assert.Contains(t, goCode, "func init() {\n\tregisterEvent[Renamed]()\n\tregisterEvent[Cleared]()\n}\n")
+	assert.NotContains(t, goCode, "type Rename struct", "commands are written by hand")
+	assert.NotContains(t, goCode, "type Search struct", "marked manual")
+
+	tsSource, err := generateTS(schema)
+	require.NoError(t, err)
+	ts := string(tsSource)
+	assert.Contains(t, ts, "export interface Renamed {\n  type: \"Renamed\"\n  id: string\n  // New name\n  name: string\n  at?: string | null\n  color?: Color\n}\n")
+	assert.Contains(t, ts, "// Search for names\nexport interface Search {\n")
+	assert.Contains(t, ts, "  ranges: [number, number][]\n  names?: (string | null)[]\n  commands?: Exclude<Command, Rename>[]\n")
+	assert.Contains(t, ts, "export type Color = \"red\" | \"green\"\n")
+	assert.Contains(t, ts, "export type ServerMessage =\n  | Event\n  | Result\n")
+	assert.Contains(t, ts, "new Set<Event[\"type\"]>([\n  \"Renamed\",\n  \"Cleared\",\n])")
+	assert.Contains(t, ts, "export function isCleared(msg: ServerMessage): msg is Cleared {\n  return msg.type === \"Cleared\"\n}\n")
+	assert.Contains(t, ts, "export function isResult(msg: ServerMessage): msg is Result {\n")
+}
+
+func TestParseSchema_UnknownRef(t *testing.T) {
+	_, err := parseSchema([]byte(`{"definitions": {
+		"Renamed": {"type": "object", "properties": {"color": {"$ref": "#/definitions/Colour"}}},
+		"Event": {"oneOf": [{"$ref": "#/definitions/Renamed"}]},
+		"Command": {"oneOf": []}
+	}}`))
+	assert.ErrorContains(t, err, `Renamed.color: unknown $ref "#/definitions/Colour"`)
+}
+
+func TestRun_CheckAndWrite(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "events.schema.json")
+	require.NoError(t, os.WriteFile(schemaPath, []byte(testSchema), 0o644))
+	args := []string{
+		"-schema", schemaPath,
+		"-go", filepath.Join(dir, "events_gen.go"),
+		"-ts", filepath.Join(dir, "types.ts"),
+		"-schema-go", filepath.Join(dir, "events_schema_gen.go"),
+	}
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run(append([]string{"-check"}, args...), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "events_gen.go is out of date")
+	assert.Contains(t, stderr.String(), "types.ts is out of date")
+	assert.NoFileExists(t, filepath.Join(dir, "types.ts"), "-check doesn't write")
+
+	stderr.Reset()
+	assert.Equal(t, 0, run(args, &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "wrote ")
+	assert.Equal(t, 0, run(append([]string{"-check"}, args...), &stdout, &stderr), stderr.String())
+}
+
+const messagesSchema = `{
+  "definitions": {
+    "Reason": {
+      "description": "Why it failed",
+      "enum": ["not_found", "missing_id"],
+      "x-messages": {
+        "en": {"not_found": "'{name}' not found", "missing_id": "missing id"},
+        "sv": {"not_found": "'{name}' finns inte", "missing_id": "id saknas"}
+      }
+    },
+    "Failed": {
+      "type": "object",
+      "properties": {
+        "type": {"const": "Failed"},
+        "reason": {"$ref": "#/definitions/Reason"},
+        "params": {"type": "object", "additionalProperties": {"type": "string"}}
+      },
+      "required": ["type", "reason"],
+      "additionalProperties": false
+    },
+    "Event": {"oneOf": [{"$ref": "#/definitions/Failed"}]},
+    "Command": {"oneOf": []},
+    "ServerMessage": {"oneOf": [{"$ref": "#/definitions/Event"}]}
+  }
+}`
+
+func TestGenerate_Messages(t *testing.T) {
+	schema, err := parseSchema([]byte(messagesSchema))
+	require.NoError(t, err)
+
+	goSource, err := generateGo(schema)
+	require.NoError(t, err)
+	goCode := string(goSource)
+	assert.Contains(t, goCode, "// Why it failed\ntype Reason string\n")
+	assert.Contains(t, goCode, "\tReasonMissingID Reason = \"missing_id\"\n")
+	assert.Contains(t, goCode, "var reasonMessages = map[Reason]string{\n\tReasonNotFound:  \"'{name}' not found\",\n")
+	assert.Contains(t, goCode, "\tReason Reason            `json:\"reason\"`\n")
+	assert.Contains(t, goCode, "\tParams map[string]string `json:\"params\"`\n")
+
+	tsSource, err := generateTS(schema)
+	require.NoError(t, err)
+	ts := string(tsSource)
+	assert.Contains(t, ts, "export const reasonMessages: Record<\"en\" | \"sv\", Record<Reason, string>> = {\n"+
+		"  en: {\n    not_found: \"'{name}' not found\",\n    missing_id: \"missing id\",\n  },\n"+
+		"  sv: {\n    not_found: \"'{name}' finns inte\",\n    missing_id: \"id saknas\",\n  },\n}\n")
+	assert.Contains(t, ts, "  params?: Record<string, string>\n")
+}
+
+func TestParseSchema_IncompleteMessages(t *testing.T) {
+	for _, tt := range []struct {
+		messages string
+		err      string
+	}{
+		{`{"sv": {"a": "A"}}`, "Reason: x-messages has no English (en) templates"},
+		{`{"en": {"a": "A"}, "sv": {}}`, `Reason: x-messages.sv has no template for "a"`},
+		{`{"en": {"a": "A", "b": "B"}}`, `Reason: x-messages.en has a template for unknown value "b"`},
+	} {
+		_, err := parseSchema([]byte(`{"definitions": {
+			"Reason": {"enum": ["a"], "x-messages": ` + tt.messages + `},
+			"Event": {"oneOf": []},
+			"Command": {"oneOf": []}
+		}}`))
+		assert.EqualError(t, err, tt.err)
+	}
+}
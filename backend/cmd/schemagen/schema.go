@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// header is the comment at the top of every generated file
+const header = "Code generated by schemagen from schema/events.schema.json. DO NOT EDIT.\n" +
+	"Run go generate in backend/ to regenerate."
+
+// node is the subset of JSON Schema the message definitions use
+type node struct {
+	Ref         string          `json:"$ref"`
+	Type        typeList        `json:"type"`
+	Format      string          `json:"format"`
+	Const       string          `json:"const"`
+	Enum        []string        `json:"enum"`
+	Description string          `json:"description"`
+	Default     json.RawMessage `json:"default"`
+	Properties  properties      `json:"properties"`
+	Required    []string        `json:"required"`
+	Items       *node           `json:"items"`
+	MinItems    *int            `json:"minItems"`
+	MaxItems    *int            `json:"maxItems"`
+	Not         *node           `json:"not"`
+	AllOf       []*node         `json:"allOf"`
+	OneOf       []*node         `json:"oneOf"`
+	// AdditionalProperties is the node of every value of a map-like object
+	AdditionalProperties additionalProperties `json:"additionalProperties"`
+	// Go is "manual" for definitions whose Go types are written by hand
+	Go string `json:"x-go"`
+	// Messages are an enum's message templates by language, then by value
+	Messages map[string]map[string]string `json:"x-messages"`
+}
+
+// additionalProperties is either a boolean, which needs no code, or the node of the values
+type additionalProperties struct {
+	node *node
+}
+
+func (a *additionalProperties) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		return nil
+	}
+	a.node = &node{}
+	return json.Unmarshal(data, a.node)
+}
+
+// typeList is a "type" keyword, either a single type or a list of them
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = typeList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// base is the type other than null
+func (t typeList) base() string {
+	for _, name := range t {
+		if name != "null" {
+			return name
+		}
+	}
+	return ""
+}
+
+func (t typeList) nullable() bool {
+	return slices.Contains(t, "null")
+}
+
+// property is a named node, kept in schema order
+type property struct {
+	name string
+	node *node
+}
+
+// properties is a JSON object of nodes that keeps the order of its keys, which decides
+// the order of generated fields and types
+type properties []property
+
+func (p *properties) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil {
+		return err
+	} else if token != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %v", token)
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		var value node
+		if err := decoder.Decode(&value); err != nil {
+			return fmt.Errorf("%v: %w", token, err)
+		}
+		*p = append(*p, property{name: token.(string), node: &value})
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+func (p properties) get(name string) *node {
+	for _, prop := range p {
+		if prop.name == name {
+			return prop.node
+		}
+	}
+	return nil
+}
+
+// schema is a parsed events.schema.json
+type schema struct {
+	definitions properties
+	events      []string // Members of the Event union
+	commands    []string // Members of the Command union
+}
+
+func parseSchema(data []byte) (*schema, error) {
+	var file struct {
+		Definitions properties `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	s := &schema{definitions: file.Definitions}
+
+	for _, union := range []struct {
+		name    string
+		members *[]string
+	}{{"Event", &s.events}, {"Command", &s.commands}} {
+		definition := s.definitions.get(union.name)
+		if definition == nil {
+			return nil, fmt.Errorf("missing %s definition", union.name)
+		}
+		for _, member := range definition.OneOf {
+			name, err := s.resolve(member.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", union.name, err)
+			}
+			*union.members = append(*union.members, name)
+		}
+	}
+
+	for _, definition := range s.definitions {
+		for _, prop := range definition.node.Properties {
+			if err := s.checkRefs(prop.node); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", definition.name, prop.name, err)
+			}
+		}
+		if err := checkMessages(definition.node); err != nil {
+			return nil, fmt.Errorf("%s: %w", definition.name, err)
+		}
+	}
+	return s, nil
+}
+
+// checkMessages checks that an enum with message templates has one for every value in every
+// language, and has English ones for the Go code
+func checkMessages(n *node) error {
+	if n.Messages == nil {
+		return nil
+	}
+	if !n.isEnum() {
+		return fmt.Errorf("only enums can have x-messages")
+	}
+	if _, ok := n.Messages["en"]; !ok {
+		return fmt.Errorf("x-messages has no English (en) templates")
+	}
+	for _, language := range n.languages() {
+		templates := n.Messages[language]
+		for _, value := range n.Enum {
+			if _, ok := templates[value]; !ok {
+				return fmt.Errorf("x-messages.%s has no template for %q", language, value)
+			}
+		}
+		for value := range templates {
+			if !slices.Contains(n.Enum, value) {
+				return fmt.Errorf("x-messages.%s has a template for unknown value %q", language, value)
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the definition name a $ref points to
+func (s *schema) resolve(ref string) (string, error) {
+	name, ok := strings.CutPrefix(ref, "#/definitions/")
+	if !ok || s.definitions.get(name) == nil {
+		return "", fmt.Errorf("unknown $ref %q", ref)
+	}
+	return name, nil
+}
+
+func (s *schema) checkRefs(n *node) error {
+	if n == nil {
+		return nil
+	}
+	if n.Ref != "" {
+		if _, err := s.resolve(n.Ref); err != nil {
+			return err
+		}
+	}
+	for _, child := range append([]*node{n.Items, n.Not, n.AdditionalProperties.node}, n.AllOf...) {
+		if err := s.checkRefs(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refExcluding returns the definitions of an allOf of a $ref and a "not" of another $ref,
+// which restricts a union to all members but one
+func (s *schema) refExcluding(n *node) (included, excluded string, ok bool) {
+	if len(n.AllOf) != 2 || n.AllOf[0].Ref == "" || n.AllOf[1].Not == nil || n.AllOf[1].Not.Ref == "" {
+		return "", "", false
+	}
+	included, _ = s.ref(n.AllOf[0].Ref)
+	excluded, _ = s.ref(n.AllOf[1].Not.Ref)
+	return included, excluded, true
+}
+
+// ref returns the definition a $ref points to; refs are checked by parseSchema
+func (s *schema) ref(ref string) (string, *node) {
+	name, _ := s.resolve(ref)
+	return name, s.definitions.get(name)
+}
+
+func (s *schema) isEvent(name string) bool {
+	return slices.Contains(s.events, name)
+}
+
+func (s *schema) isCommand(name string) bool {
+	return slices.Contains(s.commands, name)
+}
+
+// typeConst returns the const of a definition's "type" property, naming the message
+func typeConst(definition *node) string {
+	if prop := definition.Properties.get("type"); prop != nil {
+		return prop.Const
+	}
+	return ""
+}
+
+func (n *node) isEnum() bool {
+	return len(n.Enum) > 0 && n.Properties == nil
+}
+
+// languages returns the languages of an enum's message templates, sorted
+func (n *node) languages() []string {
+	return slices.Sorted(maps.Keys(n.Messages))
+}
+
+func (n *node) isObject() bool {
+	return n.Properties != nil
+}
+
+func (n *node) isRequired(name string) bool {
+	return slices.Contains(n.Required, name)
+}
+
+// fixedLength returns the length of an array with as many minItems as maxItems
+func (n *node) fixedLength() (int, bool) {
+	if n.MinItems == nil || n.MaxItems == nil || *n.MinItems != *n.MaxItems {
+		return 0, false
+	}
+	return *n.MinItems, true
+}
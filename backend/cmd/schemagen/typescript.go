@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// generateTS renders types.ts: an interface for every object definition, a type for every
+// enum and union, and type guards for the messages the server sends
+func generateTS(s *schema) ([]byte, error) {
+	var b strings.Builder
+	for line := range strings.SplitSeq(header, "\n") {
+		fmt.Fprintf(&b, "// %s\n", line)
+	}
+
+	for _, definition := range s.definitions {
+		n := definition.node
+		b.WriteString("\n")
+		if n.Description != "" {
+			fmt.Fprintf(&b, "// %s\n", n.Description)
+		}
+		switch {
+		case n.isObject():
+			fmt.Fprintf(&b, "export interface %s {\n", definition.name)
+			for _, prop := range n.Properties {
+				if prop.node.Description != "" {
+					fmt.Fprintf(&b, "  // %s\n", prop.node.Description)
+				}
+				optional := ""
+				if !n.isRequired(prop.name) {
+					optional = "?"
+				}
+				fmt.Fprintf(&b, "  %s%s: %s\n", prop.name, optional, s.tsType(prop.node))
+			}
+			b.WriteString("}\n")
+		case n.isEnum():
+			fmt.Fprintf(&b, "export type %s = %s\n", definition.name, tsEnum(n.Enum))
+			if n.Messages != nil {
+				writeTSMessages(&b, definition.name, n)
+			}
+		case n.OneOf != nil && len(n.OneOf) == 0:
+			fmt.Fprintf(&b, "export type %s = never\n", definition.name)
+		case len(n.OneOf) > 0:
+			fmt.Fprintf(&b, "export type %s =\n", definition.name)
+			for _, member := range n.OneOf {
+				fmt.Fprintf(&b, "  | %s\n", s.tsType(member))
+			}
+		default:
+			return nil, fmt.Errorf("%s: can't generate a TypeScript type for it", definition.name)
+		}
+	}
+
+	// Type guards narrowing a ServerMessage
+	b.WriteString("\nconst eventTypes: ReadonlySet<string> = new Set<Event[\"type\"]>([\n")
+	for _, name := range s.events {
+		fmt.Fprintf(&b, "  %q,\n", name)
+	}
+	b.WriteString("])\n\n")
+	b.WriteString("export function isEvent(msg: ServerMessage): msg is Event {\n")
+	b.WriteString("  return eventTypes.has(msg.type)\n}\n")
+
+	serverMessage := s.definitions.get("ServerMessage")
+	if serverMessage == nil {
+		return nil, fmt.Errorf("missing ServerMessage definition")
+	}
+	var guarded []string
+	for _, member := range serverMessage.OneOf {
+		name, definition := s.ref(member.Ref)
+		if name == "Event" {
+			guarded = append(guarded, s.events...)
+		} else if typeConst(definition) != "" {
+			guarded = append(guarded, name)
+		}
+	}
+	for _, name := range guarded {
+		fmt.Fprintf(&b, "\nexport function is%s(msg: ServerMessage): msg is %s {\n", name, name)
+		fmt.Fprintf(&b, "  return msg.type === %q\n}\n", typeConst(s.definitions.get(name)))
+	}
+	return []byte(b.String()), nil
+}
+
+// tsType returns the TypeScript type of a property
+func (s *schema) tsType(n *node) string {
+	var base string
+	switch {
+	case n.Ref != "":
+		base, _ = s.ref(n.Ref)
+	case n.AllOf != nil:
+		included, excluded, ok := s.refExcluding(n)
+		if !ok {
+			return "unknown"
+		}
+		base = fmt.Sprintf("Exclude<%s, %s>", included, excluded)
+	case n.Const != "":
+		base = strconv.Quote(n.Const)
+	case len(n.Enum) > 0:
+		base = tsEnum(n.Enum)
+	default:
+		switch n.Type.base() {
+		case "string":
+			base = "string"
+		case "integer", "number":
+			base = "number"
+		case "boolean":
+			base = "boolean"
+		case "array":
+			element := s.tsType(n.Items)
+			if length, ok := n.fixedLength(); ok {
+				elements := make([]string, length)
+				for i := range elements {
+					elements[i] = element
+				}
+				return "[" + strings.Join(elements, ", ") + "]"
+			}
+			if strings.Contains(element, " | ") {
+				element = "(" + element + ")"
+			}
+			return element + "[]"
+		case "object":
+			base = "unknown"
+			if values := n.AdditionalProperties.node; values != nil {
+				base = fmt.Sprintf("Record<string, %s>", s.tsType(values))
+			}
+		default:
+			base = "unknown"
+		}
+	}
+	if n.Type.nullable() {
+		return base + " | null"
+	}
+	return base
+}
+
+// writeTSMessages writes the message templates of an enum in every language, for clients
+// to fill in with the parameters sent along with a value
+func writeTSMessages(b *strings.Builder, name string, n *node) {
+	languages := n.languages()
+	variable := strings.ToLower(name[:1]) + name[1:] + "Messages"
+	fmt.Fprintf(b, "\nexport const %s: Record<%s, Record<%s, string>> = {\n", variable, tsEnum(languages), name)
+	for _, language := range languages {
+		fmt.Fprintf(b, "  %s: {\n", language)
+		for _, value := range n.Enum {
+			fmt.Fprintf(b, "    %s: %s,\n", value, strconv.Quote(n.Messages[language][value]))
+		}
+		b.WriteString("  },\n")
+	}
+	b.WriteString("}\n")
+}
+
+func tsEnum(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return strings.Join(quoted, " | ")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind classifies why a command was rejected
+type ErrorKind int
+
+const (
+	ErrorKindInvalid  ErrorKind = iota // The command is malformed or its values are invalid
+	ErrorKindNotFound                  // The command refers to something that doesn't exist
+	ErrorKindConflict                  // The command conflicts with the current state
+)
+
+// CommandError is returned by commandToEvent when a command is rejected. Its code and
+// params are sent to the client, which shows the code's message in its own language.
+type CommandError struct {
+	Kind   ErrorKind
+	Code   ErrorCode
+	Params map[string]string // Values of the placeholders in the code's message template
+}
+
+func (e *CommandError) Error() string {
+	return errorMessage(e.Code, e.Params)
+}
+
+// invalid returns a CommandError for malformed or invalid commands. params are pairs of
+// placeholder names and values, like the arguments of slog.
+func invalid(code ErrorCode, params ...string) error {
+	return &CommandError{Kind: ErrorKindInvalid, Code: code, Params: errorParams(params)}
+}
+
+// notFound returns a CommandError for commands referring to missing todos, categories or names
+func notFound(code ErrorCode, params ...string) error {
+	return &CommandError{Kind: ErrorKindNotFound, Code: code, Params: errorParams(params)}
+}
+
+// conflict returns a CommandError for commands that conflict with the current state
+func conflict(code ErrorCode, params ...string) error {
+	return &CommandError{Kind: ErrorKindConflict, Code: code, Params: errorParams(params)}
+}
+
+func errorParams(pairs []string) map[string]string {
+	if len(pairs) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		params[pairs[i]] = pairs[i+1]
+	}
+	return params
+}
+
+// errorMessage fills the English message template of a code with its params in a single
+// pass, so placeholders within param values, which may be user text, are left alone
+func errorMessage(code ErrorCode, params map[string]string) string {
+	if len(params) == 0 {
+		return errorCodeMessages[code]
+	}
+	oldnew := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		oldnew = append(oldnew, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(oldnew...).Replace(errorCodeMessages[code])
+}
+
+// errorCode returns the code and params a client gets for a command's execution error.
+// Errors without a code of their own, like storage errors, don't leak their details.
+func errorCode(err error) (ErrorCode, map[string]string) {
+	var batchErr *BatchError
+	var duplicateErr *DuplicateTodoError
+	var validationErr *ValidationError
+	var commandErr *CommandError
+	switch {
+	case errors.Is(err, errPersistFailed):
+		return ErrorCodePersistFailed, nil
+	case errors.Is(err, errShuttingDown):
+		return ErrorCodeShuttingDown, nil
+	case errors.As(err, &batchErr):
+		return ErrorCodeBatchRejected, errorParams([]string{"index", strconv.Itoa(batchErr.Index)})
+	case errors.As(err, &duplicateErr):
+		return ErrorCodeDuplicateTodo, duplicateErr.params()
+	case errors.As(err, &validationErr):
+		return ErrorCodeInvalidFields, validationErr.params()
+	case errors.As(err, &commandErr):
+		return commandErr.Code, commandErr.Params
+	default:
+		return ErrorCodeInternalError, nil
+	}
+}
+
+// commandErrorStatus maps a command execution error to an HTTP status code
+func commandErrorStatus(err error) int {
+	var duplicateErr *DuplicateTodoError
+	var commandErr *CommandError
+	var validationErr *ValidationError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, errPersistFailed):
+		return http.StatusInternalServerError
+	case errors.Is(err, errShuttingDown):
+		return http.StatusServiceUnavailable
+	case errors.As(err, &duplicateErr):
+		return http.StatusConflict
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &commandErr):
+		switch commandErr.Kind {
+		case ErrorKindNotFound:
+			return http.StatusNotFound
+		case ErrorKindConflict:
+			return http.StatusConflict
+		default:
+			return http.StatusUnprocessableEntity
+		}
+	default:
+		return http.StatusInternalServerError
+	}
+}
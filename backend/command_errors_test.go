@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorMessage_FillsTemplate(t *testing.T) {
+	assert.Equal(t, "'Milk' is already grouped with 'milk'",
+		errorMessage(ErrorCodeNamesAlreadyGrouped, map[string]string{"name": "Milk", "other": "milk"}))
+	assert.Equal(t, "todo not found", errorMessage(ErrorCodeTodoNotFound, map[string]string{"id": "t1"}))
+}
+
+func TestErrorMessage_LeavesPlaceholdersInValues(t *testing.T) {
+	// Whichever param is filled in first, the other's placeholder in user text stays as typed
+	for range 20 {
+		assert.Equal(t, "'{other}' is already grouped with '{name}'",
+			errorMessage(ErrorCodeNamesAlreadyGrouped, map[string]string{"name": "{other}", "other": "{name}"}))
+	}
+}
+
+func TestErrorMessage_EveryCodeHasATemplate(t *testing.T) {
+	for _, code := range messages.definitions["ErrorCode"].Enum {
+		assert.NotEmpty(t, errorCodeMessages[ErrorCode(code)], code)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   ErrorCode
+		params map[string]string
+	}{
+		{"command error", conflict(ErrorCodeCategoryNameTaken, "name", "Dairy"), ErrorCodeCategoryNameTaken, map[string]string{"name": "Dairy"}},
+		{"duplicate", &DuplicateTodoError{Existing: Todo{Name: "Milk"}}, ErrorCodeDuplicateTodo, map[string]string{"name": "Milk"}},
+		{"batch", &BatchError{Index: 2, Err: invalid(ErrorCodeNoEvent)}, ErrorCodeBatchRejected, map[string]string{"index": "2"}},
+		{"persist", fmt.Errorf("%w: %w", errPersistFailed, errors.New("disk full")), ErrorCodePersistFailed, nil},
+		{"shutting down", errShuttingDown, ErrorCodeShuttingDown, nil},
+		{"other", errors.New("secret detail"), ErrorCodeInternalError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, params := errorCode(tt.err)
+			assert.Equal(t, tt.code, code)
+			assert.Equal(t, tt.params, params)
+		})
+	}
+}
+
+func TestAPI_RejectionCarriesCodeAndParams(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	status, _ := postCommand(t, ts, `{"type":"CreateCategory","commandId":"c1","id":"cat-1","name":"Dairy"}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, cmdResp := postCommand(t, ts, `{"type":"CreateCategory","commandId":"c2","id":"cat-2","name":"Dairy"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Equal(t, ErrorCodeCategoryNameTaken, cmdResp.Code)
+	assert.Equal(t, map[string]string{"name": "Dairy"}, cmdResp.Params)
+	assert.Equal(t, "category with name 'Dairy' already exists", cmdResp.Error)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Duplicate policies control what happens when a CreateTodo command names an item
+// that is already active on the list
+const (
+	DuplicatePolicyAllow  = "allow"  // Create the todo anyway
+	DuplicatePolicyMerge  = "merge"  // Increment the quantity of the existing todo instead
+	DuplicatePolicyReject = "reject" // Reject the command and report the existing todo
+)
+
+// defaultDuplicatePolicy applies until a list sets its own policy, so lists keep
+// accepting the same item twice unless they opt into merging or rejecting
+const defaultDuplicatePolicy = DuplicatePolicyAllow
+
+// Fuzzy duplicate matching only kicks in for keys of at least duplicateFuzzyMinLength runes,
+// so short names like "tea" and "pea" are never treated as the same item
+const (
+	duplicateFuzzyMaxDistance = 1
+	duplicateFuzzyMinLength   = 5
+)
+
+type SetDuplicatePolicyCommand struct {
+	BaseCommand
+	Policy string `json:"policy"`
+}
+
+func init() {
+	registerCommand("SetDuplicatePolicy", checkSetDuplicatePolicy, func(_ *State, c SetDuplicatePolicyCommand) (Event, error) {
+		return DuplicatePolicyChanged{Type: "DuplicatePolicyChanged", Policy: c.Policy}, nil
+	})
+
+	registerProjector(func(s *State, e DuplicatePolicyChanged) {
+		s.duplicatePolicy = e.Policy
+	})
+}
+
+func checkSetDuplicatePolicy(_ *State, c SetDuplicatePolicyCommand) error {
+	if !isValidDuplicatePolicy(c.Policy) {
+		return invalid(ErrorCodeUnknownDuplicatePolicy, "policy", c.Policy)
+	}
+	return nil
+}
+
+// isValidDuplicatePolicy reports whether policy is one of the known duplicate policies
+func isValidDuplicatePolicy(policy string) bool {
+	switch policy {
+	case DuplicatePolicyAllow, DuplicatePolicyMerge, DuplicatePolicyReject:
+		return true
+	default:
+		return false
+	}
+}
+
+// DuplicateTodoError is returned when a CreateTodo command is rejected because
+// an equivalent todo is already active on the list
+type DuplicateTodoError struct {
+	Existing Todo
+}
+
+func (e *DuplicateTodoError) Error() string {
+	return errorMessage(ErrorCodeDuplicateTodo, e.params())
+}
+
+func (e *DuplicateTodoError) params() map[string]string {
+	return map[string]string{"name": e.Existing.Name}
+}
+
+// FindActiveDuplicate returns the active (not completed) todo that is a near-duplicate of name.
+// Names match when they share a normalized key (case, whitespace, plurals, synonyms) or when
+// their keys are within a small edit distance. Exact key matches win over fuzzy ones.
+func (s *State) FindActiveDuplicate(name string) (*Todo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key := s.nameKey(name)
+
+	type match struct {
+		todo     *Todo
+		distance int
+	}
+	var matches []match
+
+	for _, todo := range s.todos {
+		if todo.CompletedAt != nil {
+			continue
+		}
+		todoKey := s.nameKey(todo.Name)
+		if todoKey == key {
+			matches = append(matches, match{todo: todo, distance: 0})
+			continue
+		}
+		if min(utf8.RuneCountInString(key), utf8.RuneCountInString(todoKey)) < duplicateFuzzyMinLength {
+			continue
+		}
+		if distance := levenshteinDistance(key, todoKey); distance <= duplicateFuzzyMaxDistance {
+			matches = append(matches, match{todo: todo, distance: distance})
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, false
+	}
+
+	// Closest match first, most recently sorted (highest sortOrder) on ties
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].todo.SortOrder > matches[j].todo.SortOrder
+	})
+
+	// Return a copy
+	todoCopy := *matches[0].todo
+	return &todoCopy, true
+}
+
+// GetDuplicatePolicy returns the list's duplicate policy
+func (s *State) GetDuplicatePolicy() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.duplicatePolicy
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_FindActiveDuplicate(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Milk", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Bananas", CreatedAt: now, SortOrder: 2000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Bread", CreatedAt: now, SortOrder: 3000})
+	state.Apply(TodoCompleted{Type: "TodoCompleted", ID: "3", CompletedAt: now})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "4", Name: "Yoghurt", CreatedAt: now, SortOrder: 4000})
+	state.Apply(SynonymAdded{Type: "SynonymAdded", Name: "mjölk", Canonical: "milk"})
+
+	tests := []struct {
+		name       string
+		query      string
+		expectedID string
+	}{
+		{"case and whitespace", " milk ", "1"},
+		{"plural", "banana", "2"},
+		{"fuzzy", "yogurt", "4"},
+		{"synonym", "Mjölk", "1"},
+		{"completed todos are ignored", "Bread", ""},
+		{"short names are not fuzzy matched", "Silk", ""},
+		{"unrelated", "Eggs", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo, ok := state.FindActiveDuplicate(tt.query)
+			if tt.expectedID == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.expectedID, todo.ID)
+		})
+	}
+}
+
+func TestState_FindActiveDuplicateCountsDiacriticsAsOneEdit(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Mjölk", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Gräddfil", CreatedAt: now, SortOrder: 2000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Smörgåsgurka", CreatedAt: now, SortOrder: 3000})
+
+	for query, expectedID := range map[string]string{"mjolk": "1", "Graddfil": "2", "smorgasgurka": "", "Smörgasgurka": "3"} {
+		todo, ok := state.FindActiveDuplicate(query)
+		if expectedID == "" {
+			assert.False(t, ok, query)
+			continue
+		}
+		require.True(t, ok, query)
+		assert.Equal(t, expectedID, todo.ID, query)
+	}
+}
+
+func TestState_FindActiveDuplicatePrefersExactKey(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Carrot", CreatedAt: now, SortOrder: 2000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Carrots", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Parrot", CreatedAt: now, SortOrder: 3000})
+
+	todo, ok := state.FindActiveDuplicate("carrot")
+	require.True(t, ok)
+	// Both carrots share the key; the higher sortOrder wins over the fuzzy "Parrot"
+	assert.Equal(t, "1", todo.ID)
+}
+
+func TestCommandToEvent_CreateTodo_RejectsDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+	server.state.Apply(DuplicatePolicyChanged{Type: "DuplicatePolicyChanged", Policy: DuplicatePolicyReject})
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Milk", CreatedAt: time.Now().UTC(), SortOrder: 1000})
+
+	_, err = server.commandToEvent(CreateTodoCommand{
+		BaseCommand: BaseCommand{Type: "CreateTodo"},
+		ID:          "todo-2",
+		Name:        "milk ",
+	})
+
+	var duplicateErr *DuplicateTodoError
+	require.ErrorAs(t, err, &duplicateErr)
+	assert.Equal(t, "todo-1", duplicateErr.Existing.ID)
+}
+
+func TestCommandToEvent_CreateTodo_MergesDuplicate(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+	server.state.Apply(DuplicatePolicyChanged{Type: "DuplicatePolicyChanged", Policy: DuplicatePolicyMerge})
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Milk", CreatedAt: time.Now().UTC(), SortOrder: 1000})
+
+	event, err := server.commandToEvent(CreateTodoCommand{
+		BaseCommand: BaseCommand{Type: "CreateTodo"},
+		ID:          "todo-2",
+		Name:        "MILK",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TodoQuantityChanged{Type: "TodoQuantityChanged", ID: "todo-1", Quantity: 2}, event)
+
+	server.state.Apply(event)
+	todo, ok := server.state.GetTodo("todo-1")
+	require.True(t, ok)
+	assert.Equal(t, 2, todo.Quantity)
+	assert.Equal(t, 1, server.state.TodoCount())
+}
+
+func TestCommandToEvent_CreateTodo_AllowsDuplicateByDefault(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Milk", CreatedAt: time.Now().UTC(), SortOrder: 1000})
+
+	event, err := server.commandToEvent(CreateTodoCommand{
+		BaseCommand: BaseCommand{Type: "CreateTodo"},
+		ID:          "todo-2",
+		Name:        "Milk",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "TodoCreated", event.EventType())
+}
+
+func TestCommandToEvent_SetDuplicatePolicy(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+
+	assert.Equal(t, DuplicatePolicyAllow, server.state.GetDuplicatePolicy())
+
+	event, err := server.commandToEvent(SetDuplicatePolicyCommand{
+		BaseCommand: BaseCommand{Type: "SetDuplicatePolicy"},
+		Policy:      DuplicatePolicyMerge,
+	})
+	require.NoError(t, err)
+	server.state.Apply(event)
+	assert.Equal(t, DuplicatePolicyMerge, server.state.GetDuplicatePolicy())
+
+	_, err = server.commandToEvent(SetDuplicatePolicyCommand{
+		BaseCommand: BaseCommand{Type: "SetDuplicatePolicy"},
+		Policy:      "ignore",
+	})
+	assert.Error(t, err)
+}
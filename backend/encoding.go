@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// WebSocket clients choose how messages are encoded through the subprotocol they request.
+// MessagePack messages are transcoded from and to the JSON ones, so both encodings carry
+// the same fields, omit the same empty values and send timestamps as the same strings.
+// Clients that request no subprotocol get JSON.
+const (
+	subprotocolMsgpack = "foodlist.msgpack"
+	subprotocolJSON    = "foodlist.json"
+)
+
+// messageSubprotocols are the subprotocols the server accepts, most preferred first
+var messageSubprotocols = []string{subprotocolMsgpack, subprotocolJSON}
+
+// messageEncoding is how a client's messages are written to its WebSocket
+type messageEncoding int
+
+const (
+	encodingJSON messageEncoding = iota
+	encodingMsgpack
+)
+
+// encodingFor returns the encoding of a negotiated subprotocol
+func encodingFor(subprotocol string) messageEncoding {
+	if subprotocol == subprotocolMsgpack {
+		return encodingMsgpack
+	}
+	return encodingJSON
+}
+
+// encode returns a JSON message in the given encoding, with its WebSocket frame type
+func (e messageEncoding) encode(message []byte) (int, []byte, error) {
+	if e != encodingMsgpack {
+		return websocket.TextMessage, message, nil
+	}
+	data, err := jsonToMsgpack(message)
+	return websocket.BinaryMessage, data, err
+}
+
+// outgoingMessage is a JSON message queued for clients. A broadcast queues the same one for
+// every client, so it is transcoded to MessagePack at most once however many clients use it.
+type outgoingMessage struct {
+	json []byte
+
+	msgpackOnce sync.Once
+	msgpack     []byte
+	msgpackErr  error
+}
+
+// newOutgoingMessage wraps a JSON message for sending
+func newOutgoingMessage(message []byte) *outgoingMessage {
+	return &outgoingMessage{json: message}
+}
+
+// encode returns the message in the given encoding, with its WebSocket frame type.
+// Safe to call from several clients' writers at once.
+func (m *outgoingMessage) encode(e messageEncoding) (int, []byte, error) {
+	if e != encodingMsgpack {
+		return e.encode(m.json)
+	}
+	m.msgpackOnce.Do(func() {
+		m.msgpack, m.msgpackErr = jsonToMsgpack(m.json)
+	})
+	return websocket.BinaryMessage, m.msgpack, m.msgpackErr
+}
+
+// decodeFrame returns a received message as JSON. Binary frames carry MessagePack,
+// whichever subprotocol was negotiated.
+func decodeFrame(frameType int, data []byte) ([]byte, error) {
+	if frameType != websocket.BinaryMessage {
+		return data, nil
+	}
+	return msgpackToJSON(data)
+}
+
+// jsonToMsgpack transcodes a JSON message into MessagePack. Whole numbers become the
+// smallest integer that holds them and other numbers float64, as a JavaScript client
+// would read them. Object keys are sorted, so the same message always encodes the same.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to transcode json message: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("failed to transcode json message: trailing data")
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+	encoder.SetSortMapKeys(true)
+	if err := encoder.Encode(convertNumbers(value)); err != nil {
+		return nil, fmt.Errorf("failed to transcode json message: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// convertNumbers replaces the json.Numbers within a decoded JSON value by int64 where they
+// are whole and fit, and float64 otherwise
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, element := range v {
+			v[key] = convertNumbers(element)
+		}
+	case []any:
+		for i, element := range v {
+			v[i] = convertNumbers(element)
+		}
+	}
+	return value
+}
+
+// msgpackToJSON transcodes a MessagePack message into JSON, so it takes the same path
+// as a JSON message from then on
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var value any
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("failed to decode msgpack message: %w", err)
+	}
+	message, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("msgpack message has no json equivalent: %w", err)
+	}
+	return message, nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// largeRollup returns a rollup of a list with the given number of todos, a third of them
+// completed and spread over a few categories
+func largeRollup(todos int) StateRollup {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rollup := StateRollup{Type: "StateRollup", ListTitle: "Groceries", DuplicatePolicy: DuplicatePolicyMerge}
+	for i := range 8 {
+		rollup.Categories = append(rollup.Categories, Category{
+			ID:        fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+			Name:      fmt.Sprintf("Category %d", i),
+			CreatedAt: now,
+			SortOrder: i * 1000,
+		})
+	}
+	for i := range todos {
+		categoryID := rollup.Categories[i%len(rollup.Categories)].ID
+		todo := Todo{
+			ID:         fmt.Sprintf("10000000-0000-4000-8000-%012d", i),
+			Name:       fmt.Sprintf("Item number %d", i),
+			CreatedAt:  now.Add(time.Duration(i) * time.Minute),
+			SortOrder:  i * 1000,
+			Starred:    i%10 == 0,
+			CategoryID: &categoryID,
+			Quantity:   1 + i%3,
+		}
+		if i%3 == 0 {
+			completedAt := todo.CreatedAt.Add(time.Hour)
+			todo.CompletedAt = &completedAt
+		}
+		rollup.Todos = append(rollup.Todos, todo)
+	}
+	return rollup
+}
+
+// connectMsgpack dials with the MessagePack subprotocol and completes the handshake
+func connectMsgpack(t *testing.T, wsURL string) *websocket.Conn {
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocolMsgpack, subprotocolJSON}}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	require.Equal(t, subprotocolMsgpack, conn.Subprotocol())
+
+	writeMsgpack(t, conn, Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion})
+	var welcome Welcome
+	readMsgpack(t, conn, &welcome)
+	require.Equal(t, "Welcome", welcome.Type)
+	return conn
+}
+
+// writeMsgpack sends a message as the MessagePack transcoding of its JSON
+func writeMsgpack(t *testing.T, conn *websocket.Conn, message any) {
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+	encoded, err := jsonToMsgpack(data)
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, encoded))
+}
+
+// readMsgpack reads a binary message and decodes it through its JSON equivalent
+func readMsgpack(t *testing.T, conn *websocket.Conn, v any) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	frameType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, frameType)
+	message, err := msgpackToJSON(data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(message, v))
+}
+
+func TestMsgpack_TranscodesLikeJSON(t *testing.T) {
+	// Enough todos for 16-bit array lengths, and names that need escaping or a 16-bit length
+	rollup := largeRollup(20)
+	rollup.Synonyms = []Synonym{{Name: "mjölk", Canonical: "milk"}}
+	rollup.Todos[0].Name = `Bread, "sliced" [white] {large}\n`
+	rollup.Todos[1].Name = strings.Repeat("long name ", 30)
+	response := CommandResponse{
+		Type:      "CommandResponse",
+		CommandID: "cmd-1",
+		Code:      ErrorCodeDuplicateTodo,
+		Params:    map[string]string{"name": "Milk"},
+		Results:   []CommandResult{{Success: true}},
+	}
+	suggestions := AutocompleteResponse{
+		Type:        "AutocompleteResponse",
+		RequestID:   "req-1",
+		Suggestions: []AutocompleteSuggestion{{Name: "Milk", Score: 0.75, Matches: [][2]int{{0, 2}}}},
+	}
+
+	for _, message := range []any{rollup, response, suggestions} {
+		data, err := json.Marshal(message)
+		require.NoError(t, err)
+
+		encoded, err := jsonToMsgpack(data)
+		require.NoError(t, err)
+		assert.Less(t, len(encoded), len(data))
+		decoded, err := msgpackToJSON(encoded)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(data), string(decoded))
+	}
+}
+
+func TestMsgpack_KeepsTimestampsAndNumberKinds(t *testing.T) {
+	encoded, err := jsonToMsgpack([]byte(`{"createdAt":"2025-03-01T12:00:00Z","sortOrder":1000,"score":0.5,"completedAt":null}`))
+	require.NoError(t, err)
+
+	var value map[string]any
+	require.NoError(t, msgpack.Unmarshal(encoded, &value))
+	assert.Equal(t, "2025-03-01T12:00:00Z", value["createdAt"], "timestamps stay strings, as in JSON")
+	assert.EqualValues(t, 1000, value["sortOrder"])
+	assert.IsType(t, float64(0), value["score"])
+	assert.Contains(t, value, "completedAt")
+	assert.Nil(t, value["completedAt"])
+}
+
+func TestMsgpack_RejectsMalformedMessages(t *testing.T) {
+	_, err := msgpackToJSON([]byte{0xc1})
+	assert.Error(t, err)
+	_, err = jsonToMsgpack([]byte(`{"type":`))
+	assert.Error(t, err)
+}
+
+func TestWebSocket_MsgpackSubprotocol(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	conn := connectMsgpack(t, wsURL)
+	defer conn.Close()
+
+	var rollup StateRollup
+	readMsgpack(t, conn, &rollup)
+	assert.Equal(t, "StateRollup", rollup.Type)
+	var count ClientCountMessage
+	readMsgpack(t, conn, &count)
+	assert.Equal(t, 1, count.Count)
+
+	// Garbage is dropped without closing the connection
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, []byte{0xc1}))
+
+	writeMsgpack(t, conn, CreateTodoCommand{
+		BaseCommand: BaseCommand{Type: "CreateTodo", CommandID: "mp-1"},
+		ID:          "todo-1",
+		Name:        "Milk",
+	})
+	var response CommandResponse
+	readMsgpack(t, conn, &response)
+	assert.Equal(t, "mp-1", response.CommandID)
+	assert.True(t, response.Success)
+
+	var created TodoCreated
+	readMsgpack(t, conn, &created)
+	assert.Equal(t, "TodoCreated", created.Type)
+	assert.Equal(t, "Milk", created.Name)
+}
+
+func TestWebSocket_MsgpackAndJSONClientsShareBroadcasts(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	binary := connectMsgpack(t, wsURL)
+	defer binary.Close()
+	var skip map[string]any
+	readMsgpack(t, binary, &skip) // rollup
+	readMsgpack(t, binary, &skip) // client count
+
+	text := connectWSHello(t, wsURL)
+	defer text.Close()
+	assert.Empty(t, text.Subprotocol(), "clients asking for no subprotocol get JSON")
+	text.ReadMessage()            // rollup
+	text.ReadMessage()            // client count
+	readMsgpack(t, binary, &skip) // client count
+
+	require.NoError(t, text.WriteMessage(websocket.TextMessage, []byte(`{"type":"SetListTitle","commandId":"t-1","title":"Weekend"}`)))
+
+	var event ListTitleChanged
+	readMsgpack(t, binary, &event)
+	assert.Equal(t, "Weekend", event.Title)
+}
+
+func TestServer_BroadcastTranscodedOncePerEncoding(t *testing.T) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+
+	var clients []*Client
+	for _, encoding := range []messageEncoding{encodingMsgpack, encodingMsgpack, encodingJSON} {
+		client := newClient(nil)
+		client.encoding = encoding
+		server.clients[client] = true
+		clients = append(clients, client)
+	}
+	message := []byte(`{"type":"ListTitleChanged","title":"Weekend"}`)
+	require.False(t, server.sendToAll(message))
+
+	var frames [][]byte
+	for _, client := range clients {
+		queued := <-client.sendCh
+		frameType, data, err := queued.encode(client.encoding)
+		require.NoError(t, err)
+		if client.encoding == encodingMsgpack {
+			assert.Equal(t, websocket.BinaryMessage, frameType)
+		} else {
+			assert.Equal(t, websocket.TextMessage, frameType)
+			assert.Equal(t, message, data)
+		}
+		frames = append(frames, data)
+	}
+	// Both MessagePack clients got the bytes of a single transcode
+	require.NotEmpty(t, frames[0])
+	assert.Same(t, &frames[0][0], &frames[1][0])
+}
+
+func TestWebSocket_CompressionNegotiation(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprint(enabled), func(t *testing.T) {
+			server, ts, wsURL := setupTestServer(t)
+			defer ts.Close()
+			cfg := DefaultWebSocketConfig()
+			cfg.Compression = enabled
+			server.SetWebSocketConfig(cfg)
+			for _, todo := range largeRollup(200).Todos {
+				server.state.Apply(TodoCreated{Type: "TodoCreated", ID: todo.ID, Name: todo.Name, CreatedAt: todo.CreatedAt, SortOrder: todo.SortOrder})
+			}
+
+			dialer := websocket.Dialer{EnableCompression: true}
+			conn, resp, err := dialer.Dial(wsURL, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			assert.Equal(t, enabled, strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate"))
+
+			require.NoError(t, conn.WriteJSON(Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion}))
+			var welcome Welcome
+			require.NoError(t, conn.ReadJSON(&welcome))
+			var rollup StateRollup
+			require.NoError(t, conn.ReadJSON(&rollup))
+			assert.Len(t, rollup.Todos, 200)
+		})
+	}
+}
+
+// deflatedSize is the size of data after permessage-deflate at the level gorilla uses
+func deflatedSize(b *testing.B, data []byte) int {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	require.NoError(b, err)
+	w.Write(data)
+	w.Close()
+	return buf.Len()
+}
+
+// BenchmarkStateRollupEncoding compares encoding a 500-todo rollup as JSON and as
+// MessagePack, reporting the size of each with and without deflate
+func BenchmarkStateRollupEncoding(b *testing.B) {
+	rollup := largeRollup(500)
+	for _, encoding := range []struct {
+		name     string
+		encoding messageEncoding
+	}{{"json", encodingJSON}, {"msgpack", encodingMsgpack}} {
+		b.Run(encoding.name, func(b *testing.B) {
+			var data []byte
+			for b.Loop() {
+				message, err := json.Marshal(rollup)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, data, err = encoding.encoding.encode(message); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+			b.ReportMetric(float64(deflatedSize(b, data)), "deflated-bytes/msg")
+		})
+	}
+}
+
+// BenchmarkWebSocketRollup measures the time from dialing to holding the state of a
+// 500-todo list, for each encoding with and without permessage-deflate
+func BenchmarkWebSocketRollup(b *testing.B) {
+	for _, subprotocol := range []string{subprotocolJSON, subprotocolMsgpack} {
+		for _, compression := range []bool{false, true} {
+			name := strings.TrimPrefix(subprotocol, "foodlist.")
+			if compression {
+				name += "+deflate"
+			}
+			b.Run(name, func(b *testing.B) {
+				store, err := NewJSONLStore(filepath.Join(b.TempDir(), "events.jsonl"))
+				require.NoError(b, err)
+				server := NewServer(store)
+				go server.Run()
+				for _, todo := range largeRollup(500).Todos {
+					server.state.Apply(TodoCreated{Type: "TodoCreated", ID: todo.ID, Name: todo.Name, CreatedAt: todo.CreatedAt, SortOrder: todo.SortOrder})
+				}
+				ts := httptest.NewServer(http.HandlerFunc(server.HandleWebSocket))
+				defer ts.Close()
+				wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+				dialer := websocket.Dialer{Subprotocols: []string{subprotocol}, EnableCompression: compression}
+				hello, _ := json.Marshal(Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion})
+				frameType, hello, _ := encodingFor(subprotocol).encode(hello)
+				for b.Loop() {
+					conn, _, err := dialer.Dial(wsURL, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					conn.WriteMessage(frameType, hello)
+					conn.ReadMessage() // Welcome
+					if _, _, err := conn.ReadMessage(); err != nil {
+						b.Fatal(err)
+					}
+					conn.Close()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix starts every encrypted record, followed by the key ID, a colon and
+// the base64 nonce and ciphertext. Plain records are JSON and always start with '{'.
+const encryptedPrefix = "enc:v1:"
+
+// encryptionKeySize is the key size for AES-256
+const encryptionKeySize = 32
+
+// ErrWrongKey is returned when the event log was encrypted with a different key than the configured one
+var ErrWrongKey = errors.New("event log is encrypted with a different key")
+
+// EventCipher encrypts event records with AES-256-GCM, which also authenticates them,
+// so a tampered or corrupted record fails to decrypt rather than being misread.
+type EventCipher struct {
+	aead  cipher.AEAD
+	keyID string // Identifies the key in each record, so a wrong key gets a clear error
+}
+
+// NewEventCipher creates a cipher from a 32 byte key
+func NewEventCipher(key []byte) (*EventCipher, error) {
+	if len(key) != encryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &EventCipher{aead: aead, keyID: hex.EncodeToString(sum[:4])}, nil
+}
+
+// LoadEventCipher creates a cipher from a base64 key given directly or read from keyFile.
+// Returns nil, meaning no encryption, if neither is set.
+func LoadEventCipher(key, keyFile string) (*EventCipher, error) {
+	if key != "" && keyFile != "" {
+		return nil, errors.New("set either an encryption key or a key file, not both")
+	}
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		key = string(data)
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	return NewEventCipher(raw)
+}
+
+// KeyID returns the short fingerprint recorded with each encrypted record
+func (c *EventCipher) KeyID() string {
+	return c.keyID
+}
+
+// Seal encrypts one record. A nil cipher leaves it as is.
+func (c *EventCipher) Seal(plain []byte) ([]byte, error) {
+	if c == nil {
+		return plain, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plain)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, plain, nil)
+
+	record := make([]byte, 0, len(encryptedPrefix)+len(c.keyID)+1+base64.StdEncoding.EncodedLen(len(sealed)))
+	record = append(record, encryptedPrefix...)
+	record = append(record, c.keyID...)
+	record = append(record, ':')
+	return base64.StdEncoding.AppendEncode(record, sealed), nil
+}
+
+// Open decrypts one record. Encrypted records need a cipher with the same key, and a cipher
+// refuses plain records, so an encrypted log can't silently gain unencrypted events.
+func (c *EventCipher) Open(record []byte) ([]byte, error) {
+	encrypted := bytes.HasPrefix(record, []byte(encryptedPrefix))
+	switch {
+	case c == nil && !encrypted:
+		return record, nil
+	case c == nil:
+		return nil, errors.New("event log is encrypted, but no encryption key is configured")
+	case !encrypted:
+		return nil, errors.New("unencrypted event in encrypted event log; encrypt the existing log with the rotate-key command")
+	}
+
+	keyID, data, ok := bytes.Cut(record[len(encryptedPrefix):], []byte(":"))
+	if !ok {
+		return nil, errors.New("malformed encrypted event")
+	}
+	if string(keyID) != c.keyID {
+		return nil, fmt.Errorf("%w (log key %s, configured key %s)", ErrWrongKey, keyID, c.keyID)
+	}
+
+	sealed, err := base64.StdEncoding.AppendDecode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted event: %w", err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("malformed encrypted event: too short")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("encrypted event failed authentication, the event log is corrupted or was tampered with")
+	}
+	return plain, nil
+}
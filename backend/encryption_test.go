@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKey returns a random base64 encoded key and its cipher
+func newTestKey(t *testing.T) (string, *EventCipher) {
+	raw := make([]byte, encryptionKeySize)
+	_, err := rand.Read(raw)
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(raw)
+
+	cipher, err := LoadEventCipher(key, "")
+	require.NoError(t, err)
+	return key, cipher
+}
+
+// cipherOptions returns the default store options with the given cipher
+func cipherOptions(cipher *EventCipher) StoreOptions {
+	opts := DefaultStoreOptions()
+	opts.Cipher = cipher
+	return opts
+}
+
+func TestEventCipher_SealAndOpen(t *testing.T) {
+	_, cipher := newTestKey(t)
+	plain := []byte(`{"type":"TodoCreated","id":"todo-1","name":"Insulin"}`)
+
+	sealed, err := cipher.Seal(plain)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(sealed, []byte(encryptedPrefix+cipher.KeyID()+":")))
+	assert.NotContains(t, string(sealed), "Insulin")
+	assert.NotContains(t, string(sealed), "\n")
+
+	// A fresh nonce each time
+	again, err := cipher.Seal(plain)
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := cipher.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, plain, opened)
+}
+
+func TestEventCipher_NilCipherPassesPlainRecords(t *testing.T) {
+	var cipher *EventCipher
+	plain := []byte(`{"type":"ListTitleChanged"}`)
+
+	sealed, err := cipher.Seal(plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, sealed)
+
+	opened, err := cipher.Open(plain)
+	require.NoError(t, err)
+	assert.Equal(t, plain, opened)
+}
+
+func TestEventCipher_OpenErrors(t *testing.T) {
+	_, cipher := newTestKey(t)
+	_, other := newTestKey(t)
+	sealed, err := cipher.Seal([]byte(`{"type":"ListTitleChanged"}`))
+	require.NoError(t, err)
+
+	_, err = other.Open(sealed)
+	assert.ErrorIs(t, err, ErrWrongKey)
+	assert.ErrorContains(t, err, cipher.KeyID())
+
+	var none *EventCipher
+	_, err = none.Open(sealed)
+	assert.ErrorContains(t, err, "no encryption key is configured")
+
+	_, err = cipher.Open([]byte(`{"type":"ListTitleChanged"}`))
+	assert.ErrorContains(t, err, "unencrypted event")
+
+	// Flip a bit of the ciphertext
+	header := encryptedPrefix + cipher.KeyID() + ":"
+	raw, err := base64.StdEncoding.DecodeString(string(sealed[len(header):]))
+	require.NoError(t, err)
+	raw[len(raw)-1] ^= 1
+	tampered := []byte(header + base64.StdEncoding.EncodeToString(raw))
+	_, err = cipher.Open(tampered)
+	assert.ErrorContains(t, err, "failed authentication")
+
+	_, err = cipher.Open([]byte(encryptedPrefix + cipher.KeyID()))
+	assert.ErrorContains(t, err, "malformed")
+}
+
+func TestLoadEventCipher(t *testing.T) {
+	key, cipher := newTestKey(t)
+
+	none, err := LoadEventCipher("", "")
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(key+"\n"), 0o600))
+	fromFile, err := LoadEventCipher("", keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, cipher.KeyID(), fromFile.KeyID())
+
+	_, err = LoadEventCipher(key, keyFile)
+	assert.ErrorContains(t, err, "not both")
+
+	_, err = LoadEventCipher("not base64!", "")
+	assert.ErrorContains(t, err, "base64")
+
+	_, err = LoadEventCipher(base64.StdEncoding.EncodeToString([]byte("too short")), "")
+	assert.ErrorContains(t, err, "32 bytes")
+
+	_, err = LoadEventCipher("", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestJSONLStore_EncryptsLines(t *testing.T) {
+	_, cipher := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	opts := DefaultStoreOptions()
+	opts.Cipher = cipher
+	store, err := NewJSONLStoreWithOptions(path, opts)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendBatch([]Event{createdEvent(1), createdEvent(2)}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "Item 1")
+	assert.Equal(t, 2, bytes.Count(data, []byte("\n")))
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []Event{createdEvent(1), createdEvent(2)}, events)
+	require.NoError(t, store.Close())
+
+	// Reopening with another key or none fails clearly instead of loading garbage
+	_, wrong := newTestKey(t)
+	opts.Cipher = wrong
+	opts.ReadOnly = true
+	reader, err := NewJSONLStoreWithOptions(path, opts)
+	require.NoError(t, err)
+	_, err = reader.ReadAll()
+	assert.ErrorIs(t, err, ErrWrongKey)
+
+	plain, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true})
+	require.NoError(t, err)
+	_, err = plain.ReadAll()
+	assert.ErrorContains(t, err, "no encryption key")
+}
+
+func TestRotateKey(t *testing.T) {
+	for _, backend := range []StoreBackend{StoreBackendJSONL, StoreBackendBolt} {
+		t.Run(string(backend), func(t *testing.T) {
+			dataDir := t.TempDir()
+			path, _ := backend.Path(dataDir)
+			want := []Event{createdEvent(1), createdEvent(2), createdEvent(3)}
+
+			store, err := OpenEventStore(backend, path, DefaultStoreOptions())
+			require.NoError(t, err)
+			require.NoError(t, store.AppendBatch(want))
+			require.NoError(t, store.Close())
+
+			readWith := func(cipher *EventCipher) ([]Event, error) {
+				store, err := OpenEventStore(backend, path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true, Cipher: cipher})
+				require.NoError(t, err)
+				defer store.Close()
+				return store.ReadAll()
+			}
+			rotate := func(current *EventCipher, args ...string) (int, string) {
+				var stdout, stderr bytes.Buffer
+				code := runRotateKey(args, backend, dataDir, cipherOptions(current), &stdout, &stderr)
+				return code, stdout.String() + stderr.String()
+			}
+			writeKey := func() (string, *EventCipher) {
+				key, cipher := newTestKey(t)
+				keyFile := filepath.Join(t.TempDir(), "key")
+				require.NoError(t, os.WriteFile(keyFile, []byte(key), 0o600))
+				return keyFile, cipher
+			}
+
+			// Encrypt the plain log
+			firstFile, first := writeKey()
+			code, out := rotate(nil, "-new-key-file", firstFile)
+			require.Equal(t, 0, code, out)
+			assert.Contains(t, out, "encrypted 3 events with key "+first.KeyID())
+			events, err := readWith(first)
+			require.NoError(t, err)
+			assert.Equal(t, want, events)
+			_, err = readWith(nil)
+			assert.Error(t, err)
+
+			// Rotate to a second key; the first no longer reads the log
+			secondFile, second := writeKey()
+			code, out = rotate(first, "-new-key-file", secondFile)
+			require.Equal(t, 0, code, out)
+			events, err = readWith(second)
+			require.NoError(t, err)
+			assert.Equal(t, want, events)
+			_, err = readWith(first)
+			assert.ErrorIs(t, err, ErrWrongKey)
+
+			// Rotating with the wrong current key leaves the log untouched
+			code, out = rotate(first, "-new-key-file", firstFile)
+			assert.Equal(t, 1, code)
+			assert.Contains(t, out, ErrWrongKey.Error())
+			events, err = readWith(second)
+			require.NoError(t, err)
+			assert.Equal(t, want, events)
+
+			// And back to plain JSON
+			code, out = rotate(second, "-decrypt")
+			require.Equal(t, 0, code, out)
+			events, err = readWith(nil)
+			require.NoError(t, err)
+			assert.Equal(t, want, events)
+
+			// No temporary directories are left behind
+			leftovers, err := filepath.Glob(filepath.Join(dataDir, ".rotate-key-*"))
+			require.NoError(t, err)
+			assert.Empty(t, leftovers)
+		})
+	}
+}
+
+func TestRotateKey_RejectsInvalidUse(t *testing.T) {
+	dataDir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 1, runRotateKey(nil, StoreBackendJSONL, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "either -new-key-file or -decrypt")
+
+	// Refused while the server holds the data directory
+	path, _ := StoreBackendJSONL.Path(dataDir)
+	running, err := NewJSONLStore(path)
+	require.NoError(t, err)
+	defer running.Close()
+
+	stderr.Reset()
+	assert.Equal(t, 1, runRotateKey([]string{"-decrypt"}, StoreBackendJSONL, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), ErrStoreLocked.Error())
+}
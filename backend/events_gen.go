@@ -1,14 +1,90 @@
-// Generated from schema/events.schema.json
-// Do not edit manually - run schema/generate.sh to regenerate
+// Code generated by schemagen from schema/events.schema.json. DO NOT EDIT.
+// Run go generate in backend/ to regenerate.
 
 package main
 
 import (
 	"encoding/json"
-	"fmt"
 	"time"
 )
 
+// Why a command or connection was rejected. Clients show the message template of the code in their language, with {name} placeholders filled from the response's params
+type ErrorCode string
+
+const (
+	ErrorCodeInvalidFields           ErrorCode = "invalid_fields"
+	ErrorCodeCommandTypeMismatch     ErrorCode = "command_type_mismatch"
+	ErrorCodeNoEvent                 ErrorCode = "no_event"
+	ErrorCodeTodoNotFound            ErrorCode = "todo_not_found"
+	ErrorCodeDuplicateTodo           ErrorCode = "duplicate_todo"
+	ErrorCodeUnknownDuplicatePolicy  ErrorCode = "unknown_duplicate_policy"
+	ErrorCodeCategoryNotFound        ErrorCode = "category_not_found"
+	ErrorCodeMissingCategoryID       ErrorCode = "missing_category_id"
+	ErrorCodeCategoryNameTaken       ErrorCode = "category_name_taken"
+	ErrorCodeCategoryNotEmpty        ErrorCode = "category_not_empty"
+	ErrorCodeNameNotInHistory        ErrorCode = "name_not_in_history"
+	ErrorCodeMissingMergeTarget      ErrorCode = "missing_merge_target"
+	ErrorCodeNamesAlreadyGrouped     ErrorCode = "names_already_grouped"
+	ErrorCodeMissingPinName          ErrorCode = "missing_pin_name"
+	ErrorCodeNameAlreadyPinned       ErrorCode = "name_already_pinned"
+	ErrorCodeNameNotPinned           ErrorCode = "name_not_pinned"
+	ErrorCodeMissingSynonymName      ErrorCode = "missing_synonym_name"
+	ErrorCodeSynonymNotFound         ErrorCode = "synonym_not_found"
+	ErrorCodeBatchRejected           ErrorCode = "batch_rejected"
+	ErrorCodeNotApplied              ErrorCode = "not_applied"
+	ErrorCodeNotAppliedBatchRejected ErrorCode = "not_applied_batch_rejected"
+	ErrorCodePersistFailed           ErrorCode = "persist_failed"
+	ErrorCodeShuttingDown            ErrorCode = "shutting_down"
+	ErrorCodeClientTooOld            ErrorCode = "client_too_old"
+	ErrorCodeInternalError           ErrorCode = "internal_error"
+)
+
+// errorCodeMessages are the English message templates of every ErrorCode
+var errorCodeMessages = map[ErrorCode]string{
+	ErrorCodeInvalidFields:           "invalid {type}: {problems}",
+	ErrorCodeCommandTypeMismatch:     "{got} is not a {type} command",
+	ErrorCodeNoEvent:                 "command did not produce an event",
+	ErrorCodeTodoNotFound:            "todo not found",
+	ErrorCodeDuplicateTodo:           "'{name}' is already on the list",
+	ErrorCodeUnknownDuplicatePolicy:  "unknown duplicate policy '{policy}'",
+	ErrorCodeCategoryNotFound:        "category not found",
+	ErrorCodeMissingCategoryID:       "missing category id",
+	ErrorCodeCategoryNameTaken:       "category with name '{name}' already exists",
+	ErrorCodeCategoryNotEmpty:        "cannot delete non-empty category",
+	ErrorCodeNameNotInHistory:        "name not found in history",
+	ErrorCodeMissingMergeTarget:      "missing name to merge into",
+	ErrorCodeNamesAlreadyGrouped:     "'{name}' is already grouped with '{other}'",
+	ErrorCodeMissingPinName:          "missing name to pin",
+	ErrorCodeNameAlreadyPinned:       "'{name}' is already pinned",
+	ErrorCodeNameNotPinned:           "name is not pinned",
+	ErrorCodeMissingSynonymName:      "synonym name and canonical name are required",
+	ErrorCodeSynonymNotFound:         "synonym not found",
+	ErrorCodeBatchRejected:           "command {index} of the batch was rejected",
+	ErrorCodeNotApplied:              "not applied",
+	ErrorCodeNotAppliedBatchRejected: "not applied, command {index} was rejected",
+	ErrorCodePersistFailed:           "failed to persist event",
+	ErrorCodeShuttingDown:            "server is shutting down",
+	ErrorCodeClientTooOld:            "this version of the app is out of date (protocol {version}, the server needs {min}); reload to update",
+	ErrorCodeInternalError:           "internal error",
+}
+
+// AutocompleteSuggestion includes the name, optional category context and match details
+type AutocompleteSuggestion struct {
+	Name         string   `json:"name"`
+	CategoryID   *string  `json:"categoryId"`
+	CategoryName *string  `json:"categoryName"`
+	MatchType    string   `json:"matchType"`
+	Score        float64  `json:"score"`
+	Frequency    int      `json:"frequency"`
+	Matches      [][2]int `json:"matches"` // Half-open [start, end) rune ranges of name matching the query; empty when the query matched another variant of the name or a synonym
+}
+
+// FieldError describes one field of a message that doesn't match the schema
+type FieldError struct {
+	Field   string `json:"field"` // Path of the field, e.g. commands[1].sortOrder; empty for the message itself
+	Message string `json:"message"`
+}
+
 // Todo item projected from events
 type Todo struct {
 	ID          string     `json:"id"`
@@ -18,6 +94,7 @@ type Todo struct {
 	SortOrder   int        `json:"sortOrder"`
 	Starred     bool       `json:"starred"`
 	CategoryID  *string    `json:"categoryId"`
+	Quantity    int        `json:"quantity"`
 }
 
 // Category projected from events
@@ -28,6 +105,12 @@ type Category struct {
 	SortOrder int       `json:"sortOrder"`
 }
 
+// Synonym maps an alias name to the canonical name it is grouped with
+type Synonym struct {
+	Name      string `json:"name"`
+	Canonical string `json:"canonical"`
+}
+
 // Event types
 type TodoCreated struct {
 	Type       string    `json:"type"`
@@ -108,11 +191,47 @@ type ListTitleChanged struct {
 	Title string `json:"title"`
 }
 
-type StateRollup struct {
-	Type       string     `json:"type"`
-	Todos      []Todo     `json:"todos"`
-	Categories []Category `json:"categories"`
-	ListTitle  string     `json:"listTitle"`
+type SynonymAdded struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Canonical string `json:"canonical"`
+}
+
+type SynonymRemoved struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type TodoQuantityChanged struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Quantity int    `json:"quantity"`
+}
+
+type DuplicatePolicyChanged struct {
+	Type   string `json:"type"`
+	Policy string `json:"policy"`
+}
+
+type NameForgotten struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type NamePinned struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type NameUnpinned struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type NamesMerged struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	Into string `json:"into"`
 }
 
 // Event is an interface for all event types
@@ -121,125 +240,73 @@ type Event interface {
 	GetID() string
 }
 
-func (e TodoCreated) EventType() string       { return "TodoCreated" }
-func (e TodoCompleted) EventType() string     { return "TodoCompleted" }
-func (e TodoUncompleted) EventType() string   { return "TodoUncompleted" }
-func (e TodoStarred) EventType() string       { return "TodoStarred" }
-func (e TodoUnstarred) EventType() string     { return "TodoUnstarred" }
-func (e TodoReordered) EventType() string     { return "TodoReordered" }
-func (e TodoRenamed) EventType() string       { return "TodoRenamed" }
-func (e TodoCategorized) EventType() string   { return "TodoCategorized" }
-func (e CategoryCreated) EventType() string   { return "CategoryCreated" }
-func (e CategoryRenamed) EventType() string   { return "CategoryRenamed" }
-func (e CategoryDeleted) EventType() string   { return "CategoryDeleted" }
-func (e CategoryReordered) EventType() string { return "CategoryReordered" }
-func (e ListTitleChanged) EventType() string  { return "ListTitleChanged" }
-
-func (e TodoCreated) GetID() string       { return e.ID }
-func (e TodoCompleted) GetID() string     { return e.ID }
-func (e TodoUncompleted) GetID() string   { return e.ID }
-func (e TodoStarred) GetID() string       { return e.ID }
-func (e TodoUnstarred) GetID() string     { return e.ID }
-func (e TodoReordered) GetID() string     { return e.ID }
-func (e TodoRenamed) GetID() string       { return e.ID }
-func (e TodoCategorized) GetID() string   { return e.ID }
-func (e CategoryCreated) GetID() string   { return e.ID }
-func (e CategoryRenamed) GetID() string   { return e.ID }
-func (e CategoryDeleted) GetID() string   { return e.ID }
-func (e CategoryReordered) GetID() string { return e.ID }
-func (e ListTitleChanged) GetID() string  { return "" } // ListTitleChanged doesn't have an ID
-
-// ParseEvent parses a JSON event into the appropriate Event type
-func ParseEvent(data []byte) (Event, error) {
-	var typeCheck struct {
-		Type string `json:"type"`
-	}
-	if err := json.Unmarshal(data, &typeCheck); err != nil {
-		return nil, fmt.Errorf("failed to parse event type: %w", err)
-	}
-
-	switch typeCheck.Type {
-	case "TodoCreated":
-		var e TodoCreated
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoCreated: %w", err)
-		}
-		return e, nil
-	case "TodoCompleted":
-		var e TodoCompleted
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoCompleted: %w", err)
-		}
-		return e, nil
-	case "TodoUncompleted":
-		var e TodoUncompleted
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoUncompleted: %w", err)
-		}
-		return e, nil
-	case "TodoStarred":
-		var e TodoStarred
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoStarred: %w", err)
-		}
-		return e, nil
-	case "TodoUnstarred":
-		var e TodoUnstarred
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoUnstarred: %w", err)
-		}
-		return e, nil
-	case "TodoReordered":
-		var e TodoReordered
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoReordered: %w", err)
-		}
-		return e, nil
-	case "TodoRenamed":
-		var e TodoRenamed
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoRenamed: %w", err)
-		}
-		return e, nil
-	case "TodoCategorized":
-		var e TodoCategorized
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse TodoCategorized: %w", err)
-		}
-		return e, nil
-	case "CategoryCreated":
-		var e CategoryCreated
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse CategoryCreated: %w", err)
-		}
-		return e, nil
-	case "CategoryRenamed":
-		var e CategoryRenamed
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse CategoryRenamed: %w", err)
-		}
-		return e, nil
-	case "CategoryDeleted":
-		var e CategoryDeleted
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse CategoryDeleted: %w", err)
-		}
-		return e, nil
-	case "CategoryReordered":
-		var e CategoryReordered
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse CategoryReordered: %w", err)
-		}
-		return e, nil
-	case "ListTitleChanged":
-		var e ListTitleChanged
-		if err := json.Unmarshal(data, &e); err != nil {
-			return nil, fmt.Errorf("failed to parse ListTitleChanged: %w", err)
-		}
-		return e, nil
-	default:
-		return nil, fmt.Errorf("unknown event type: %s", typeCheck.Type)
-	}
+func (e TodoCreated) EventType() string            { return "TodoCreated" }
+func (e TodoCompleted) EventType() string          { return "TodoCompleted" }
+func (e TodoUncompleted) EventType() string        { return "TodoUncompleted" }
+func (e TodoStarred) EventType() string            { return "TodoStarred" }
+func (e TodoUnstarred) EventType() string          { return "TodoUnstarred" }
+func (e TodoReordered) EventType() string          { return "TodoReordered" }
+func (e TodoRenamed) EventType() string            { return "TodoRenamed" }
+func (e TodoCategorized) EventType() string        { return "TodoCategorized" }
+func (e CategoryCreated) EventType() string        { return "CategoryCreated" }
+func (e CategoryRenamed) EventType() string        { return "CategoryRenamed" }
+func (e CategoryDeleted) EventType() string        { return "CategoryDeleted" }
+func (e CategoryReordered) EventType() string      { return "CategoryReordered" }
+func (e ListTitleChanged) EventType() string       { return "ListTitleChanged" }
+func (e SynonymAdded) EventType() string           { return "SynonymAdded" }
+func (e SynonymRemoved) EventType() string         { return "SynonymRemoved" }
+func (e TodoQuantityChanged) EventType() string    { return "TodoQuantityChanged" }
+func (e DuplicatePolicyChanged) EventType() string { return "DuplicatePolicyChanged" }
+func (e NameForgotten) EventType() string          { return "NameForgotten" }
+func (e NamePinned) EventType() string             { return "NamePinned" }
+func (e NameUnpinned) EventType() string           { return "NameUnpinned" }
+func (e NamesMerged) EventType() string            { return "NamesMerged" }
+
+func (e TodoCreated) GetID() string            { return e.ID }
+func (e TodoCompleted) GetID() string          { return e.ID }
+func (e TodoUncompleted) GetID() string        { return e.ID }
+func (e TodoStarred) GetID() string            { return e.ID }
+func (e TodoUnstarred) GetID() string          { return e.ID }
+func (e TodoReordered) GetID() string          { return e.ID }
+func (e TodoRenamed) GetID() string            { return e.ID }
+func (e TodoCategorized) GetID() string        { return e.ID }
+func (e CategoryCreated) GetID() string        { return e.ID }
+func (e CategoryRenamed) GetID() string        { return e.ID }
+func (e CategoryDeleted) GetID() string        { return e.ID }
+func (e CategoryReordered) GetID() string      { return e.ID }
+func (e ListTitleChanged) GetID() string       { return "" } // ListTitleChanged has no ID
+func (e SynonymAdded) GetID() string           { return "" } // SynonymAdded has no ID
+func (e SynonymRemoved) GetID() string         { return "" } // SynonymRemoved has no ID
+func (e TodoQuantityChanged) GetID() string    { return e.ID }
+func (e DuplicatePolicyChanged) GetID() string { return "" } // DuplicatePolicyChanged has no ID
+func (e NameForgotten) GetID() string          { return "" } // NameForgotten has no ID
+func (e NamePinned) GetID() string             { return "" } // NamePinned has no ID
+func (e NameUnpinned) GetID() string           { return "" } // NameUnpinned has no ID
+func (e NamesMerged) GetID() string            { return "" } // NamesMerged has no ID
+
+// Register the decoder of every event; projectors are registered by hand
+func init() {
+	registerEvent[TodoCreated]()
+	registerEvent[TodoCompleted]()
+	registerEvent[TodoUncompleted]()
+	registerEvent[TodoStarred]()
+	registerEvent[TodoUnstarred]()
+	registerEvent[TodoReordered]()
+	registerEvent[TodoRenamed]()
+	registerEvent[TodoCategorized]()
+	registerEvent[CategoryCreated]()
+	registerEvent[CategoryRenamed]()
+	registerEvent[CategoryDeleted]()
+	registerEvent[CategoryReordered]()
+	registerEvent[ListTitleChanged]()
+	registerEvent[SynonymAdded]()
+	registerEvent[SynonymRemoved]()
+	registerEvent[TodoQuantityChanged]()
+	registerEvent[DuplicatePolicyChanged]()
+	registerEvent[NameForgotten]()
+	registerEvent[NamePinned]()
+	registerEvent[NameUnpinned]()
+	registerEvent[NamesMerged]()
 }
 
 // MarshalEvent serializes an event to JSON
@@ -253,11 +320,51 @@ type ClientCount struct {
 	Count int    `json:"count"`
 }
 
+// StateRollup is sent to clients on connection with the current state
+type StateRollup struct {
+	Type            string     `json:"type"`
+	Todos           []Todo     `json:"todos"`
+	Categories      []Category `json:"categories"`
+	ListTitle       string     `json:"listTitle"`
+	Synonyms        []Synonym  `json:"synonyms"`
+	DuplicatePolicy string     `json:"duplicatePolicy"`
+	PinnedNames     []string   `json:"pinnedNames"`
+}
+
+// Hello is the first message a client sends after connecting, before it gets any state
+type Hello struct {
+	Type            string `json:"type"`
+	ProtocolVersion int    `json:"protocolVersion"` // Protocol version the client was built for
+	ClientVersion   string `json:"clientVersion"`   // Build of the client, for logging
+}
+
+// Welcome accepts a client's Hello; the StateRollup follows it
+type Welcome struct {
+	Type               string   `json:"type"`
+	ProtocolVersion    int      `json:"protocolVersion"`    // Protocol version the server speaks
+	MinProtocolVersion int      `json:"minProtocolVersion"` // Oldest client protocol version the server accepts
+	ServerVersion      string   `json:"serverVersion"`
+	ServerCommit       string   `json:"serverCommit"` // VCS revision the server was built from, if known
+	Features           []string `json:"features"`
+}
+
+// ReloadRequired is sent to a client too old for the server before its connection is closed
+type ReloadRequired struct {
+	Type               string            `json:"type"`
+	ProtocolVersion    int               `json:"protocolVersion"`    // Protocol version the server speaks
+	MinProtocolVersion int               `json:"minProtocolVersion"` // Oldest client protocol version the server accepts
+	Error              string            `json:"error"`              // English message of the code
+	Code               ErrorCode         `json:"code"`
+	Params             map[string]string `json:"params"` // Values of the placeholders in the code's message template
+}
+
 // AutocompleteRequest is sent by clients to request autocomplete suggestions
 type AutocompleteRequest struct {
 	Type      string `json:"type"`
 	Query     string `json:"query"`
 	RequestID string `json:"requestId"`
+	Limit     int    `json:"limit,omitempty"`  // Defaults to 4, capped at 50
+	Offset    int    `json:"offset,omitempty"` // Number of ranked suggestions to skip
 }
 
 // AutocompleteResponse contains autocomplete suggestions sent back to the requesting client
@@ -265,11 +372,5 @@ type AutocompleteResponse struct {
 	Type        string                   `json:"type"`
 	Suggestions []AutocompleteSuggestion `json:"suggestions"`
 	RequestID   string                   `json:"requestId"`
-}
-
-// AutocompleteSuggestion includes the name and optional category context
-type AutocompleteSuggestion struct {
-	Name         string  `json:"name"`
-	CategoryID   *string `json:"categoryId"`
-	CategoryName *string `json:"categoryName"`
+	Total       int                      `json:"total"` // Number of matching names across all pages
 }
@@ -158,6 +158,8 @@ func TestEventType_AllTypes(t *testing.T) {
 		{TodoUnstarred{Type: "TodoUnstarred", ID: "1"}, "TodoUnstarred"},
 		{TodoReordered{Type: "TodoReordered", ID: "1", SortOrder: 2000}, "TodoReordered"},
 		{TodoRenamed{Type: "TodoRenamed", ID: "1", Name: "Renamed"}, "TodoRenamed"},
+		{SynonymAdded{Type: "SynonymAdded", Name: "tomat", Canonical: "tomato"}, "SynonymAdded"},
+		{SynonymRemoved{Type: "SynonymRemoved", Name: "tomat"}, "SynonymRemoved"},
 	}
 
 	for _, e := range events {
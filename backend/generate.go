@@ -0,0 +1,4 @@
+package main
+
+// Event and message types are generated from the schema shared with the frontend
+//go:generate go run ./cmd/schemagen
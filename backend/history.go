@@ -0,0 +1,270 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+type ForgetNameCommand struct {
+	BaseCommand
+	Name string `json:"name"`
+}
+
+type MergeNamesCommand struct {
+	BaseCommand
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
+type PinNameCommand struct {
+	BaseCommand
+	Name string `json:"name"`
+}
+
+type UnpinNameCommand struct {
+	BaseCommand
+	Name string `json:"name"`
+}
+
+type AddSynonymCommand struct {
+	BaseCommand
+	Name      string `json:"name"`
+	Canonical string `json:"canonical"`
+}
+
+type RemoveSynonymCommand struct {
+	BaseCommand
+	Name string `json:"name"`
+}
+
+func init() {
+	registerCommand("ForgetName", checkForgetName, func(_ *State, c ForgetNameCommand) (Event, error) {
+		return NameForgotten{Type: "NameForgotten", Name: c.Name}, nil
+	})
+	registerCommand("MergeNames", checkMergeNames, func(_ *State, c MergeNamesCommand) (Event, error) {
+		return NamesMerged{Type: "NamesMerged", From: c.From, Into: strings.TrimSpace(c.Into)}, nil
+	})
+	registerCommand("PinName", checkPinName, func(_ *State, c PinNameCommand) (Event, error) {
+		return NamePinned{Type: "NamePinned", Name: strings.TrimSpace(c.Name)}, nil
+	})
+	registerCommand("UnpinName", checkUnpinName, func(_ *State, c UnpinNameCommand) (Event, error) {
+		return NameUnpinned{Type: "NameUnpinned", Name: c.Name}, nil
+	})
+	registerCommand("AddSynonym", checkAddSynonym, func(state *State, c AddSynonymCommand) (Event, error) {
+		name, canonical := synonymOf(state, c)
+		return SynonymAdded{Type: "SynonymAdded", Name: name, Canonical: canonical}, nil
+	})
+	registerCommand("RemoveSynonym", nil, removeSynonym)
+
+	registerProjector(func(s *State, e NameForgotten) { s.forgetName(e.Name) })
+	registerProjector(func(s *State, e NamesMerged) { s.mergeNames(e.From, e.Into) })
+	registerProjector(func(s *State, e NamePinned) { s.pinnedNames[s.normalizer.Key(e.Name)] = e.Name })
+	registerProjector(func(s *State, e NameUnpinned) { s.unpinKey(s.nameKey(e.Name)) })
+	registerProjector(func(s *State, e SynonymAdded) {
+		s.synonyms[s.normalizer.Key(e.Name)] = Synonym{Name: e.Name, Canonical: e.Canonical}
+	})
+	registerProjector(func(s *State, e SynonymRemoved) { delete(s.synonyms, s.normalizer.Key(e.Name)) })
+}
+
+func checkForgetName(state *State, c ForgetNameCommand) error {
+	if !state.HasNameHistory(c.Name) {
+		return notFound(ErrorCodeNameNotInHistory, "name", c.Name)
+	}
+	return nil
+}
+
+func checkMergeNames(state *State, c MergeNamesCommand) error {
+	if strings.TrimSpace(c.Into) == "" {
+		return invalid(ErrorCodeMissingMergeTarget)
+	}
+	if !state.HasNameHistory(c.From) {
+		return notFound(ErrorCodeNameNotInHistory, "name", c.From)
+	}
+	if state.NameKey(c.From) == state.NameKey(c.Into) {
+		return conflict(ErrorCodeNamesAlreadyGrouped, "name", c.From, "other", c.Into)
+	}
+	return nil
+}
+
+func checkPinName(state *State, c PinNameCommand) error {
+	name := strings.TrimSpace(c.Name)
+	if name == "" {
+		return invalid(ErrorCodeMissingPinName)
+	}
+	if state.IsNamePinned(name) {
+		return conflict(ErrorCodeNameAlreadyPinned, "name", name)
+	}
+	return nil
+}
+
+func checkUnpinName(state *State, c UnpinNameCommand) error {
+	if !state.IsNamePinned(c.Name) {
+		return notFound(ErrorCodeNameNotPinned, "name", c.Name)
+	}
+	return nil
+}
+
+func checkAddSynonym(state *State, c AddSynonymCommand) error {
+	name, canonical := synonymOf(state, c)
+	if name == "" || canonical == "" {
+		return invalid(ErrorCodeMissingSynonymName)
+	}
+
+	// Reject no-ops and cycles: the alias must not already group with the canonical name
+	if state.NameKey(name) == state.NameKey(canonical) {
+		return conflict(ErrorCodeNamesAlreadyGrouped, "name", name, "other", canonical)
+	}
+	return nil
+}
+
+// synonymOf returns the alias and canonical name an AddSynonym command adds
+func synonymOf(state *State, c AddSynonymCommand) (name, canonical string) {
+	name = strings.TrimSpace(c.Name)
+	canonical = strings.TrimSpace(c.Canonical)
+	if canonical == "" {
+		return name, canonical
+	}
+
+	// Point at the end of an existing chain so the table stays flat
+	if existing, ok := state.GetSynonym(canonical); ok {
+		canonical = existing.Canonical
+	}
+	return name, canonical
+}
+
+func removeSynonym(state *State, c RemoveSynonymCommand) (Event, error) {
+	synonym, ok := state.GetSynonym(c.Name)
+	if !ok {
+		return nil, notFound(ErrorCodeSynonymNotFound, "name", c.Name)
+	}
+	return SynonymRemoved{Type: "SynonymRemoved", Name: synonym.Name}, nil
+}
+
+// forgetName removes every variant in a name's group from the autocomplete history.
+// This should only be called from applyEvent with the lock held.
+func (s *State) forgetName(name string) {
+	key := s.nameKey(name)
+	for _, nameLower := range s.groupVariants(key) {
+		delete(s.nameFrequency, nameLower)
+		delete(s.nameCanonical, nameLower)
+		delete(s.nameLastCategory, nameLower)
+		delete(s.nameLastSeen, nameLower)
+		delete(s.nameCategorySeen, nameLower)
+	}
+	s.unpinKey(key)
+}
+
+// mergeNames moves the frequency and last category of one name group into another.
+// The target keeps its casing; the source's category wins only if it was assigned more recently.
+// This should only be called from applyEvent with the lock held.
+func (s *State) mergeNames(from, into string) {
+	fromKey := s.nameKey(from)
+	intoKey := s.nameKey(into)
+	if fromKey == intoKey {
+		return
+	}
+
+	// Fold into the most recently used variant of the target, or start a new history entry
+	target := strings.ToLower(into)
+	latest := -1
+	for _, nameLower := range s.groupVariants(intoKey) {
+		if seen := s.nameLastSeen[nameLower]; seen > latest {
+			target = nameLower
+			latest = seen
+		}
+	}
+	if _, ok := s.nameCanonical[target]; !ok {
+		s.nameCanonical[target] = into
+	}
+
+	for _, nameLower := range s.groupVariants(fromKey) {
+		s.nameFrequency[target] += s.nameFrequency[nameLower]
+		if seen, ok := s.nameCategorySeen[nameLower]; ok && seen > s.nameCategorySeen[target] {
+			s.nameLastCategory[target] = s.nameLastCategory[nameLower]
+			s.nameCategorySeen[target] = seen
+		}
+		if s.nameLastSeen[nameLower] > s.nameLastSeen[target] {
+			s.nameLastSeen[target] = s.nameLastSeen[nameLower]
+		}
+		delete(s.nameFrequency, nameLower)
+		delete(s.nameCanonical, nameLower)
+		delete(s.nameLastCategory, nameLower)
+		delete(s.nameLastSeen, nameLower)
+		delete(s.nameCategorySeen, nameLower)
+	}
+
+	// A pinned source stays pinned under its new name
+	if s.unpinKey(fromKey) {
+		s.pinnedNames[s.normalizer.Key(into)] = into
+	}
+}
+
+// groupVariants returns the lowercase history entries that resolve to key (internal use only)
+func (s *State) groupVariants(key string) []string {
+	var variants []string
+	for nameLower := range s.nameFrequency {
+		if s.nameKey(nameLower) == key {
+			variants = append(variants, nameLower)
+		}
+	}
+	return variants
+}
+
+// unpinKey removes any pin resolving to key and reports whether one was removed (internal use only)
+func (s *State) unpinKey(key string) bool {
+	removed := false
+	for pinKey, name := range s.pinnedNames {
+		if s.nameKey(name) == key {
+			delete(s.pinnedNames, pinKey)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// HasNameHistory reports whether any name in the given name's group has been used before
+func (s *State) HasNameHistory(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.groupVariants(s.nameKey(name))) > 0
+}
+
+// IsNamePinned reports whether the given name's group is pinned
+func (s *State) IsNamePinned(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pinnedKeys()[s.nameKey(name)] != ""
+}
+
+// GetPinnedNames returns all pinned names sorted alphabetically
+func (s *State) GetPinnedNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.pinnedNames))
+	for _, name := range s.pinnedNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPinnedKeys returns the group keys of all pinned names mapped to the name as pinned
+func (s *State) GetPinnedKeys() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.pinnedKeys()
+}
+
+// pinnedKeys resolves pinned names to their current group keys without locking (internal use only).
+// Pins are resolved on read so they follow later synonym changes.
+func (s *State) pinnedKeys() map[string]string {
+	keys := make(map[string]string, len(s.pinnedNames))
+	for _, name := range s.pinnedNames {
+		keys[s.nameKey(name)] = name
+	}
+	return keys
+}
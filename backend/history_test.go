@@ -0,0 +1,138 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState_ForgetName(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Bananananas", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "bananananas", CreatedAt: now, SortOrder: 2000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Milk", CreatedAt: now, SortOrder: 3000})
+	state.Apply(NamePinned{Type: "NamePinned", Name: "Bananananas"})
+
+	state.Apply(NameForgotten{Type: "NameForgotten", Name: "BANANANANAS"})
+
+	assert.Equal(t, map[string]int{"Milk": 1}, state.GetNameFrequency())
+	assert.False(t, state.HasNameHistory("Bananananas"))
+	assert.Empty(t, state.GetPinnedNames())
+	// Todos themselves are untouched
+	assert.Equal(t, 3, state.TodoCount())
+}
+
+func TestState_MergeNames(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+	catID := "cat-1"
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Bananas", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Bananananas", CreatedAt: now, SortOrder: 2000, CategoryID: &catID})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Bananananas", CreatedAt: now, SortOrder: 3000, CategoryID: &catID})
+	state.Apply(NamePinned{Type: "NamePinned", Name: "Bananananas"})
+
+	state.Apply(NamesMerged{Type: "NamesMerged", From: "Bananananas", Into: "Bananas"})
+
+	assert.Equal(t, map[string]int{"Bananas": 3}, state.GetNameFrequency())
+	require.NotNil(t, state.GetLastCategoryForName("Bananas"))
+	assert.Equal(t, catID, *state.GetLastCategoryForName("Bananas"))
+	assert.Equal(t, []string{"Bananas"}, state.GetPinnedNames())
+}
+
+func TestState_MergeNamesIntoNewName(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Tomahto", CreatedAt: now, SortOrder: 1000})
+	state.Apply(NamesMerged{Type: "NamesMerged", From: "Tomahto", Into: "Tomato"})
+
+	assert.Equal(t, map[string]int{"Tomato": 1}, state.GetNameFrequency())
+}
+
+func TestState_PinAndUnpinName(t *testing.T) {
+	state := NewState()
+
+	state.Apply(NamePinned{Type: "NamePinned", Name: "Coffee"})
+	assert.True(t, state.IsNamePinned("coffee"))
+	assert.Equal(t, []string{"Coffee"}, state.GetPinnedNames())
+
+	state.Apply(NameUnpinned{Type: "NameUnpinned", Name: "COFFEE"})
+	assert.False(t, state.IsNamePinned("Coffee"))
+	assert.Empty(t, state.GetPinnedNames())
+}
+
+func TestState_HistoryManagementReplaysFromLog(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "events.jsonl")
+	store, err := NewJSONLStore(filePath)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	events := []Event{
+		TodoCreated{Type: "TodoCreated", ID: "1", Name: "Bananananas", CreatedAt: now, SortOrder: 1000},
+		TodoCreated{Type: "TodoCreated", ID: "2", Name: "Bananas", CreatedAt: now, SortOrder: 2000},
+		TodoCreated{Type: "TodoCreated", ID: "3", Name: "Mlik", CreatedAt: now, SortOrder: 3000},
+		NamesMerged{Type: "NamesMerged", From: "Bananananas", Into: "Bananas"},
+		NameForgotten{Type: "NameForgotten", Name: "Mlik"},
+		NamePinned{Type: "NamePinned", Name: "Coffee"},
+	}
+	for _, e := range events {
+		require.NoError(t, store.Append(e))
+	}
+	store.Close()
+
+	store, err = NewJSONLStore(filePath)
+	require.NoError(t, err)
+	defer store.Close()
+	server := NewServer(store)
+	require.NoError(t, server.LoadEvents())
+
+	assert.Equal(t, map[string]int{"Bananas": 2}, server.state.GetNameFrequency())
+	assert.Equal(t, []string{"Coffee"}, server.state.GetPinnedNames())
+}
+
+func TestCommandToEvent_HistoryManagement(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+	now := time.Now().UTC()
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Bananananas", CreatedAt: now, SortOrder: 1000})
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Bananas", CreatedAt: now, SortOrder: 2000})
+	server.state.Apply(NamePinned{Type: "NamePinned", Name: "Coffee"})
+
+	tests := []struct {
+		name    string
+		cmd     Command
+		wantErr bool
+	}{
+		{"forget known name", ForgetNameCommand{BaseCommand: BaseCommand{Type: "ForgetName"}, Name: "bananananas"}, false},
+		{"forget unknown name", ForgetNameCommand{BaseCommand: BaseCommand{Type: "ForgetName"}, Name: "Eggs"}, true},
+		{"merge", MergeNamesCommand{BaseCommand: BaseCommand{Type: "MergeNames"}, From: "Bananananas", Into: "Bananas"}, false},
+		{"merge unknown source", MergeNamesCommand{BaseCommand: BaseCommand{Type: "MergeNames"}, From: "Eggs", Into: "Bananas"}, true},
+		{"merge into itself", MergeNamesCommand{BaseCommand: BaseCommand{Type: "MergeNames"}, From: "Bananas", Into: "banana"}, true},
+		{"merge into empty name", MergeNamesCommand{BaseCommand: BaseCommand{Type: "MergeNames"}, From: "Bananas", Into: " "}, true},
+		{"pin", PinNameCommand{BaseCommand: BaseCommand{Type: "PinName"}, Name: "Bananas"}, false},
+		{"pin already pinned", PinNameCommand{BaseCommand: BaseCommand{Type: "PinName"}, Name: "coffee"}, true},
+		{"pin empty name", PinNameCommand{BaseCommand: BaseCommand{Type: "PinName"}, Name: ""}, true},
+		{"unpin", UnpinNameCommand{BaseCommand: BaseCommand{Type: "UnpinName"}, Name: "Coffee"}, false},
+		{"unpin not pinned", UnpinNameCommand{BaseCommand: BaseCommand{Type: "UnpinName"}, Name: "Bananas"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.commandToEvent(tt.cmd)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
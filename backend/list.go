@@ -0,0 +1,16 @@
+package main
+
+type SetListTitleCommand struct {
+	BaseCommand
+	Title string `json:"title"`
+}
+
+func init() {
+	registerCommand("SetListTitle", nil, func(_ *State, c SetListTitleCommand) (Event, error) {
+		return ListTitleChanged{Type: "ListTitleChanged", Title: c.Title}, nil
+	})
+
+	registerProjector(func(s *State, e ListTitleChanged) {
+		s.listTitle = e.Title
+	})
+}
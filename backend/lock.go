@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrStoreLocked is returned when another process already holds the data directory
+var ErrStoreLocked = errors.New("event store is locked by another process")
+
+// ErrStoreReadOnly is returned by Append on a store opened read-only
+var ErrStoreReadOnly = errors.New("event store is read-only")
+
+// lockFileName is the lock file created in the data directory
+const lockFileName = "foodlist.lock"
+
+// dirLock is an exclusive advisory lock on a data directory, held by a writable store
+// so two processes sharing a DATA_DIR can't interleave appends.
+// The lock file records the holder's PID for the error message of the process refused.
+type dirLock struct {
+	file *os.File
+}
+
+// lockDataDir takes the exclusive lock on dir without waiting.
+// Fails with ErrStoreLocked, naming the holder's PID, if another process holds it.
+func lockDataDir(dir string) (*dirLock, error) {
+	path := filepath.Join(dir, lockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	locked, err := tryLockFile(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	if !locked {
+		holder := "an unknown process"
+		if pid, ok := readLockPID(file); ok {
+			holder = fmt.Sprintf("pid %d", pid)
+		}
+		file.Close()
+		return nil, fmt.Errorf("%w: %s is held by %s", ErrStoreLocked, dir, holder)
+	}
+
+	// Record our PID for anyone refused while we hold the lock
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	return &dirLock{file: file}, nil
+}
+
+// readLockPID reads the PID written by the lock's holder
+func readLockPID(file *os.File) (int, bool) {
+	data := make([]byte, 32)
+	n, _ := file.ReadAt(data, 0)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data[:n])))
+	return pid, err == nil && pid > 0
+}
+
+// release unlocks the data directory. The lock file is left in place, since removing
+// it could race with another process that is about to lock it.
+func (l *dirLock) release() error {
+	if l == nil {
+		return nil
+	}
+	// Closing the file drops the lock
+	return l.file.Close()
+}
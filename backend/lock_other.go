@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// tryLockFile can't lock on this platform, so the data directory is left unprotected
+func tryLockFile(file *os.File) (bool, error) {
+	slog.Warn("file locking is not supported on this platform, data directory is not protected", "file", file.Name())
+	return true, nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
@@ -18,11 +22,49 @@ type Config struct {
 	StaticDir string `env:"STATIC_DIR" envDefault:"../frontend/dist"`
 
 	// Data configuration
-	DataDir string `env:"DATA_DIR" envDefault:"."`
+	DataDir           string        `env:"DATA_DIR" envDefault:"."`
+	StoreBackend      string        `env:"STORE_BACKEND" envDefault:"jsonl"`
+	StoreDurability   string        `env:"STORE_DURABILITY" envDefault:"batch"`
+	StoreSyncInterval time.Duration `env:"STORE_SYNC_INTERVAL" envDefault:"10ms"`
+	StoreChecksums    string        `env:"STORE_CHECKSUMS" envDefault:"crc32c"`
+
+	// Segmenting of the JSONL log
+	StoreSegmentMaxSize  int64         `env:"STORE_SEGMENT_MAX_SIZE" envDefault:"0"`
+	StoreSegmentMaxAge   time.Duration `env:"STORE_SEGMENT_MAX_AGE" envDefault:"0"`
+	StoreSegmentCompress bool          `env:"STORE_SEGMENT_COMPRESS" envDefault:"false"`
+
+	// Encryption at rest: a base64 encoded 32 byte key, given directly or in a file
+	StoreEncryptionKey     string `env:"STORE_ENCRYPTION_KEY" envDefault:""`
+	StoreEncryptionKeyFile string `env:"STORE_ENCRYPTION_KEY_FILE" envDefault:""`
+
+	// Backup configuration
+	AdminToken      string        `env:"ADMIN_TOKEN" envDefault:""`
+	BackupInterval  time.Duration `env:"BACKUP_INTERVAL" envDefault:"0"`
+	BackupRetention int           `env:"BACKUP_RETENTION" envDefault:"7"`
 
 	// Logging configuration
 	LogFormat string `env:"LOG_FORMAT" envDefault:"logfmt"`
 
+	// WebSocket keepalive configuration
+	WSPingInterval   time.Duration `env:"WS_PING_INTERVAL" envDefault:"30s"`
+	WSPongTimeout    time.Duration `env:"WS_PONG_TIMEOUT" envDefault:"60s"`
+	WSWriteTimeout   time.Duration `env:"WS_WRITE_TIMEOUT" envDefault:"10s"`
+	WSMaxMessageSize int64         `env:"WS_MAX_MESSAGE_SIZE" envDefault:"65536"`
+	WSHelloTimeout   time.Duration `env:"WS_HELLO_TIMEOUT" envDefault:"2s"`
+
+	// WebSocket permessage-deflate configuration
+	WSCompression        bool `env:"WS_COMPRESSION" envDefault:"true"`
+	WSCompressionMinSize int  `env:"WS_COMPRESSION_MIN_SIZE" envDefault:"1024"`
+
+	// Oldest client protocol version accepted; older clients are asked to reload
+	MinProtocolVersion int `env:"MIN_PROTOCOL_VERSION" envDefault:"1"`
+
+	// Shutdown configuration
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"8s"`
+
+	// Autocomplete configuration
+	NameLanguages []string `env:"NAME_LANGUAGES" envDefault:"en,sv" envSeparator:","`
+
 	// Security configuration
 	SharedSecret    string   `env:"SHARED_SECRET" envDefault:""`
 	CIDRWhitelist   []string `env:"CIDR_WHITELIST" envSeparator:","`
@@ -40,15 +82,51 @@ func main() {
 		os.Exit(1)
 	}
 
+	cipher, err := LoadEventCipher(cfg.StoreEncryptionKey, cfg.StoreEncryptionKeyFile)
+	if err != nil {
+		slog.Error("invalid encryption configuration", "error", err)
+		os.Exit(1)
+	}
+
+	storeOpts := StoreOptions{
+		Durability:   DurabilityMode(cfg.StoreDurability),
+		SyncInterval: cfg.StoreSyncInterval,
+		Cipher:       cipher,
+		Checksums:    ChecksumMode(cfg.StoreChecksums),
+
+		SegmentMaxSize:   cfg.StoreSegmentMaxSize,
+		SegmentMaxAge:    cfg.StoreSegmentMaxAge,
+		CompressSegments: cfg.StoreSegmentCompress,
+	}
+
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:], cfg.DataDir, storeOpts, os.Stdout, os.Stderr))
+		case "rotate-key":
+			os.Exit(runRotateKey(os.Args[2:], StoreBackend(cfg.StoreBackend), cfg.DataDir, storeOpts, os.Stdout, os.Stderr))
+		case "verify":
+			os.Exit(runVerify(os.Args[2:], StoreBackend(cfg.StoreBackend), cfg.DataDir, storeOpts, os.Stdout, os.Stderr))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:], StoreBackend(cfg.StoreBackend), cfg.DataDir, cipher, os.Stdout, os.Stderr))
+		}
+	}
+
 	// Configure structured logging
 	setupLogger(cfg.LogFormat)
 
 	// Initialize event store
-	eventFile := filepath.Join(cfg.DataDir, "events.jsonl")
+	backend := StoreBackend(cfg.StoreBackend)
+	eventFile, err := backend.Path(cfg.DataDir)
+	if err != nil {
+		slog.Error("invalid store configuration", "error", err)
+		os.Exit(1)
+	}
 	absEventFile, _ := filepath.Abs(eventFile)
-	slog.Info("initializing event store", "file", absEventFile)
+	slog.Info("initializing event store", "backend", backend, "file", absEventFile, "durability", storeOpts.Durability, "checksums", storeOpts.Checksums, "encrypted", cipher != nil)
 
-	store, err := NewEventStore(eventFile)
+	store, err := OpenEventStore(backend, eventFile, storeOpts)
 	if err != nil {
 		slog.Error("failed to initialize event store", "error", err)
 		os.Exit(1)
@@ -57,6 +135,42 @@ func main() {
 
 	// Create server and load existing events
 	server := NewServer(store)
+	wsConfig := WebSocketConfig{
+		PingInterval:   cfg.WSPingInterval,
+		PongTimeout:    cfg.WSPongTimeout,
+		WriteTimeout:   cfg.WSWriteTimeout,
+		MaxMessageSize: cfg.WSMaxMessageSize,
+		HelloTimeout:   cfg.WSHelloTimeout,
+
+		Compression:        cfg.WSCompression,
+		CompressionMinSize: cfg.WSCompressionMinSize,
+	}
+	if err := wsConfig.Validate(); err != nil {
+		slog.Error("invalid websocket configuration", "error", err)
+		return // defer will close store
+	}
+	server.SetWebSocketConfig(wsConfig)
+	slog.Info("websocket keepalive configured",
+		"ping_interval", wsConfig.PingInterval,
+		"pong_timeout", wsConfig.PongTimeout,
+		"write_timeout", wsConfig.WriteTimeout,
+		"max_message_size", wsConfig.MaxMessageSize,
+		"hello_timeout", wsConfig.HelloTimeout,
+		"compression", wsConfig.Compression,
+		"compression_min_size", wsConfig.CompressionMinSize,
+	)
+	if err := server.SetMinProtocolVersion(cfg.MinProtocolVersion); err != nil {
+		slog.Error("invalid protocol configuration", "error", err)
+		return // defer will close store
+	}
+	slog.Info("protocol configured",
+		"version", version,
+		"protocol_version", currentProtocolVersion,
+		"min_protocol_version", cfg.MinProtocolVersion,
+	)
+	normalizer := NewNameNormalizer(cfg.NameLanguages...)
+	server.state.SetNormalizer(normalizer)
+	slog.Info("name normalization configured", "languages", normalizer.Languages())
 	if err := server.LoadEvents(); err != nil {
 		slog.Error("failed to load events", "error", err)
 		return // defer will close store
@@ -65,6 +179,25 @@ func main() {
 	// Start server event loop
 	go server.Run()
 
+	// Scheduled local backups
+	backupCtx, stopBackups := context.WithCancel(context.Background())
+	defer stopBackups()
+	backupsDone := make(chan struct{})
+	if cfg.BackupInterval > 0 {
+		if cfg.BackupRetention < 1 {
+			slog.Error("invalid backup configuration", "error", "BACKUP_RETENTION must be at least 1")
+			return // defer will close store
+		}
+		dir := backupDir(cfg.DataDir)
+		slog.Info("scheduled backups enabled", "dir", dir, "interval", cfg.BackupInterval, "retention", cfg.BackupRetention)
+		go func() {
+			defer close(backupsDone)
+			RunScheduledBackups(backupCtx, store, backend, dir, cfg.BackupInterval, cfg.BackupRetention)
+		}()
+	} else {
+		close(backupsDone)
+	}
+
 	// Set up HTTP routes
 	mux := http.NewServeMux()
 
@@ -84,6 +217,17 @@ func main() {
 		mux.HandleFunc("/ws", server.HandleWebSocket)
 	}
 
+	// Server-Sent Events fallback for networks that break WebSocket upgrades
+	server.RegisterSSE(mux, pathPrefix)
+
+	// REST/JSON API mirroring the WebSocket commands
+	server.RegisterAPI(mux, pathPrefix)
+
+	// Admin backup download, only with a token
+	if cfg.AdminToken != "" {
+		server.RegisterBackup(mux, pathPrefix, cfg.AdminToken, backend)
+	}
+
 	// Serve static files under secret path
 	staticPath := pathPrefix
 	fileServer := http.FileServer(http.Dir(cfg.StaticDir))
@@ -124,15 +268,59 @@ func main() {
 		"port", cfg.Port,
 		"address", addr,
 		"websocket_endpoint", "ws://"+cfg.BindAddr+":"+cfg.Port+wsPath,
+		"sse_endpoint", "http://"+cfg.BindAddr+":"+cfg.Port+pathPrefix+"sse",
+		"api_endpoint", "http://"+cfg.BindAddr+":"+cfg.Port+pathPrefix+"api/",
 		"static_dir", cfg.StaticDir,
 		"data_dir", cfg.DataDir,
 		"path_prefix", pathPrefix,
 	)
 
-	if err := http.ListenAndServe(addr, handler); err != nil {
+	httpServer := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	// Wait for SIGINT/SIGTERM (e.g. docker stop)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serveErr:
 		slog.Error("server failed", "error", err)
-		// defer will close store
+		return // defer will close store
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections; open SSE streams end once the server closes its clients
+	httpDone := make(chan error, 1)
+	go func() {
+		httpDone <- httpServer.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to drain server", "error", err)
+	}
+	if err := <-httpDone; err != nil {
+		slog.Error("failed to shut down http server", "error", err)
+	}
+
+	// Let a running backup finish before the store closes
+	stopBackups()
+	<-backupsDone
+
+	if err := store.Close(); err != nil {
+		slog.Error("failed to close event store", "error", err)
+		return
 	}
+	slog.Info("shutdown complete")
 }
 
 // setupLogger configures the global logger based on the provided format
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// migrateBatchSize is how many events the migration copies per AppendBatch
+const migrateBatchSize = 500
+
+// MigrateEvents copies every event from src to the empty store dst, in order and in batches,
+// then reads dst back to check nothing was lost. Returns the number of events copied.
+func MigrateEvents(src, dst EventStore) (int, error) {
+	existing, err := dst.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read destination store: %w", err)
+	}
+	if len(existing) > 0 {
+		return 0, fmt.Errorf("destination store already holds %d events", len(existing))
+	}
+
+	events, err := src.ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read source store: %w", err)
+	}
+
+	for start := 0; start < len(events); start += migrateBatchSize {
+		end := min(start+migrateBatchSize, len(events))
+		if err := dst.AppendBatch(events[start:end]); err != nil {
+			return start, fmt.Errorf("failed to write events %d-%d: %w", start, end-1, err)
+		}
+	}
+
+	copied, err := dst.ReadAll()
+	if err != nil {
+		return len(events), fmt.Errorf("failed to verify destination store: %w", err)
+	}
+	if len(copied) != len(events) {
+		return len(events), fmt.Errorf("destination store holds %d events, expected %d", len(copied), len(events))
+	}
+	return len(events), nil
+}
+
+// runMigrate implements the "migrate" subcommand, which copies the event log of one store
+// backend into another within the data directory:
+//
+//	foodlist migrate -from jsonl -to bolt [-data-dir DIR]
+//
+// Both stores use the configured options, so encrypted stores stay encrypted with the configured key.
+// Fails with ErrStoreLocked while the server is using the data directory. Returns the process exit code.
+func runMigrate(args []string, dataDir string, opts StoreOptions, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	from := flags.String("from", string(StoreBackendJSONL), "backend to copy events from (jsonl or bolt)")
+	to := flags.String("to", string(StoreBackendBolt), "backend to copy events to (jsonl or bolt)")
+	flags.StringVar(&dataDir, "data-dir", dataDir, "directory holding the event stores")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := migrate(StoreBackend(*from), StoreBackend(*to), dataDir, opts, stdout); err != nil {
+		fmt.Fprintf(stderr, "migrate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func migrate(from, to StoreBackend, dataDir string, opts StoreOptions, stdout io.Writer) error {
+	if from == to {
+		return errors.New("source and destination backends are the same")
+	}
+	srcPath, err := from.Path(dataDir)
+	if err != nil {
+		return err
+	}
+	dstPath, err := to.Path(dataDir)
+	if err != nil {
+		return err
+	}
+
+	// Read-only, so a missing source isn't created
+	srcOpts := opts
+	srcOpts.ReadOnly = true
+	src, err := OpenEventStore(from, srcPath, srcOpts)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := OpenEventStore(to, dstPath, opts)
+	if err != nil {
+		return err
+	}
+
+	count, migrateErr := MigrateEvents(src, dst)
+	if err := dst.Close(); err != nil && migrateErr == nil {
+		migrateErr = fmt.Errorf("failed to close destination store: %w", err)
+	}
+	if migrateErr != nil {
+		return migrateErr
+	}
+
+	fmt.Fprintf(stdout, "migrated %d events from %s to %s\n", count, srcPath, dstPath)
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// minStemLength is the shortest stem a suffix rule may leave behind.
+// Short words like "ost" or "ägg" are left untouched.
+const minStemLength = 3
+
+// minBareStemLength is the shortest stem a bare ending rule may leave behind, see stemRule
+const minBareStemLength = 4
+
+// stemRule strips a suffix from a word and optionally appends a replacement
+type stemRule struct {
+	suffix      string
+	replacement string
+	// bare marks an ending that singular words end in too ("peppar", "socker", "butter"),
+	// only stripped from stems of at least minBareStemLength runes that end in a single
+	// consonant, which plural stems like "tomat" or "korv" do
+	bare bool
+}
+
+// stemRules holds the plural/singular rules per language code.
+// Rules are tried in order and the first matching rule wins, so longer suffixes come first.
+// Single-letter suffixes are left out, since stripping a final "a" or "e" merges unrelated
+// words like "pasta" and "paste". Words of different languages ("tomat", "tomato") have
+// different stems and are grouped through synonyms instead.
+var stemRules = map[string][]stemRule{
+	// English plurals: berries -> berry, tomatoes -> tomato, boxes -> box, eggs -> egg
+	"en": {
+		{suffix: "ies", replacement: "y"},
+		{suffix: "oes", replacement: "o"},
+		{suffix: "ches", replacement: "ch"},
+		{suffix: "shes", replacement: "sh"},
+		{suffix: "sses", replacement: "ss"},
+		{suffix: "xes", replacement: "x"},
+		{suffix: "ss", replacement: "ss"},
+		{suffix: "s", replacement: ""},
+	},
+	// Swedish plurals and definite plurals: tomater -> tomat, gurkor -> gurka, korvarna -> korv
+	"sv": {
+		{suffix: "orna", replacement: "a"},
+		{suffix: "arna", replacement: ""},
+		{suffix: "erna", replacement: ""},
+		{suffix: "or", replacement: "a"},
+		{suffix: "ar", replacement: "", bare: true},
+		{suffix: "er", replacement: "", bare: true},
+	},
+}
+
+// defaultNameLanguages are the languages whose rules apply unless configured otherwise
+var defaultNameLanguages = []string{"en", "sv"}
+
+// NameNormalizer turns todo names into grouping keys so that case, whitespace and
+// plural/singular variants of the same item ("Tomato", "tomatoes ") share history
+type NameNormalizer struct {
+	languages []string
+}
+
+// NewNameNormalizer creates a normalizer applying the stemming rules of the given languages,
+// in order. Unknown language codes are ignored; without any known one stemming is disabled.
+func NewNameNormalizer(languages ...string) *NameNormalizer {
+	var known []string
+	for _, language := range languages {
+		language = strings.ToLower(strings.TrimSpace(language))
+		if _, ok := stemRules[language]; ok && !slices.Contains(known, language) {
+			known = append(known, language)
+		}
+	}
+	return &NameNormalizer{languages: known}
+}
+
+// Languages returns the language codes whose rules are applied, in order
+func (n *NameNormalizer) Languages() []string {
+	return slices.Clone(n.languages)
+}
+
+// Key returns the normalized grouping key for a name:
+// lowercased, whitespace collapsed and every word stemmed
+func (n *NameNormalizer) Key(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		words[i] = n.stem(word)
+	}
+	return strings.Join(words, " ")
+}
+
+// stem applies the first matching rule of each configured language in turn to a single word.
+// Each language stems the previous one's result, so a plural and its singular end up with
+// the same key even when a later language has a rule for the singular ("burgers", "burger").
+func (n *NameNormalizer) stem(word string) string {
+	for _, language := range n.languages {
+		word = stemWith(stemRules[language], word)
+	}
+	return word
+}
+
+// stemWith applies the first matching rule to a word
+func stemWith(rules []stemRule, word string) string {
+	for _, rule := range rules {
+		if !strings.HasSuffix(word, rule.suffix) {
+			continue
+		}
+		stem := strings.TrimSuffix(word, rule.suffix)
+		if utf8.RuneCountInString(stem) < minStemLength || (rule.bare && !bareStem(stem)) {
+			// Too short to be a plural form of anything
+			return word
+		}
+		return stem + rule.replacement
+	}
+	return word
+}
+
+// bareStem reports whether a bare ending may be stripped to leave stem: it must be long
+// enough and end in a single consonant, not a vowel, a doubled consonant or "ck"
+func bareStem(stem string) bool {
+	runes := []rune(stem)
+	if len(runes) < minBareStemLength {
+		return false
+	}
+	last, prev := runes[len(runes)-1], runes[len(runes)-2]
+	return !isVowel(last) && last != prev && !(prev == 'c' && last == 'k')
+}
+
+// isVowel reports whether a lowercase rune is an English or Swedish vowel
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiouyåäö", r)
+}
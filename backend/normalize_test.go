@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameNormalizer_Key(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected bool
+	}{
+		{"case", "Milk", "milk", true},
+		{"whitespace", "  whole   milk ", "Whole Milk", true},
+		{"english plural", "tomato", "tomatoes", true},
+		{"english ies plural", "Berries", "berry", true},
+		{"english s plural", "Eggs", "egg", true},
+		{"swedish plural", "Tomater", "tomat", true},
+		{"swedish ar plural", "korvar", "korv", true},
+		{"swedish or plural", "gurkor", "gurka", true},
+		{"swedish definite plural", "gurkorna", "gurka", true},
+		{"english plural of a word swedish rules stem", "burgers", "burger", true},
+		{"short words untouched", "bus", "bu", false},
+		{"different items", "Milk", "Silk", false},
+		{"emoji kept", "Milk 🥛", "Milk", false},
+		{"no final vowel stripping", "pasta", "paste", false},
+		{"singular ar kept after a double consonant", "peppar", "pepp", false},
+		{"singular er kept after ck", "socker", "sock", false},
+		{"english er kept after a double consonant", "butter", "butt", false},
+		{"short stems keep a bare ending", "paper", "pap", false},
+		{"short words keep their s", "ris", "ri", false},
+		{"different languages need a synonym", "tomater", "tomato", false},
+	}
+
+	normalizer := NewNameNormalizer(defaultNameLanguages...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizer.Key(tt.a) == normalizer.Key(tt.b),
+				"keys: %q vs %q", normalizer.Key(tt.a), normalizer.Key(tt.b))
+		})
+	}
+}
+
+func TestNameNormalizer_LanguageSelection(t *testing.T) {
+	english := NewNameNormalizer("en")
+	assert.Equal(t, english.Key("tomato"), english.Key("tomatoes"))
+	assert.NotEqual(t, english.Key("tomat"), english.Key("tomater"))
+
+	swedish := NewNameNormalizer("sv")
+	assert.NotEqual(t, swedish.Key("tomato"), swedish.Key("tomatoes"))
+	assert.Equal(t, swedish.Key("tomat"), swedish.Key("tomater"))
+
+	none := NewNameNormalizer()
+	assert.Equal(t, "tomatoes", none.Key("Tomatoes"))
+
+	assert.Equal(t, []string{"en", "sv"}, NewNameNormalizer(" EN ", "xx", "sv", "en").Languages())
+	assert.Empty(t, NewNameNormalizer("xx").Languages())
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+)
+
+// currentProtocolVersion is the version of the message protocol this server speaks. Bump it
+// when messages change in a way clients built for the previous version can't handle.
+const currentProtocolVersion = 2
+
+// legacyProtocolVersion is assumed for clients that connect without sending a Hello
+const legacyProtocolVersion = 1
+
+// version is the server build, set with -ldflags "-X main.version=..."
+var version = "dev"
+
+// serverFeatures are advertised to clients in the Welcome
+var serverFeatures = []string{"batch", "errorCodes", "duplicatePolicy", "synonyms", "pinnedNames", "autocompletePaging"}
+
+// reloadRequiredClose is the close frame sent after a ReloadRequired.
+// Codes 4000-4999 are reserved for applications.
+var reloadRequiredClose = websocket.FormatCloseMessage(4000, "reload required")
+
+// buildCommit returns the VCS revision the binary was built from, if Go recorded it
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
+
+// SetMinProtocolVersion sets the oldest client protocol version accepted from now on.
+// Must be called before the server starts accepting connections.
+func (s *Server) SetMinProtocolVersion(minVersion int) error {
+	if minVersion < legacyProtocolVersion || minVersion > currentProtocolVersion {
+		return fmt.Errorf("min protocol version must be between %d and %d, got %d", legacyProtocolVersion, currentProtocolVersion, minVersion)
+	}
+	s.minProtocol = minVersion
+	return nil
+}
+
+// negotiate answers a client speaking the given protocol version with a Welcome,
+// or with a ReloadRequired if the client is too old
+func (s *Server) negotiate(clientVersion int) (message []byte, accepted bool) {
+	var reply any
+	if clientVersion < s.minProtocol {
+		params := map[string]string{
+			"version": strconv.Itoa(clientVersion),
+			"min":     strconv.Itoa(s.minProtocol),
+		}
+		reply = ReloadRequired{
+			Type:               "ReloadRequired",
+			ProtocolVersion:    currentProtocolVersion,
+			MinProtocolVersion: s.minProtocol,
+			Error:              errorMessage(ErrorCodeClientTooOld, params),
+			Code:               ErrorCodeClientTooOld,
+			Params:             params,
+		}
+	} else {
+		accepted = true
+		reply = Welcome{
+			Type:               "Welcome",
+			ProtocolVersion:    currentProtocolVersion,
+			MinProtocolVersion: s.minProtocol,
+			ServerVersion:      version,
+			ServerCommit:       buildCommit(),
+			Features:           serverFeatures,
+		}
+	}
+	message, _ = json.Marshal(reply)
+	return message, accepted
+}
+
+// finishHandshake admits or rejects a WebSocket client speaking the given protocol version.
+// Clients that sent a Hello are answered with a Welcome before their StateRollup; legacy
+// clients only get the state. A Hello arriving after a legacy client was admitted is still
+// answered, so slow clients learn the protocol version too. Returns whether the client's
+// messages should be handled.
+func (s *Server) finishHandshake(client *Client, clientVersion int, sentHello bool) bool {
+	client.handshakeMu.Lock()
+	defer client.handshakeMu.Unlock()
+
+	admitted := client.handshake == handshakeAdmitted
+	if client.handshake != handshakePending && !(admitted && sentHello) {
+		return admitted
+	}
+
+	reply, accepted := s.negotiate(clientVersion)
+	if !accepted {
+		slog.Info("rejecting client with outdated protocol", "protocol_version", clientVersion, "min_protocol_version", s.minProtocol)
+		client.handshake = handshakeRejected
+		client.send(reply)
+		client.setCloseFrame(reloadRequiredClose)
+		if admitted {
+			s.unregisterClient(client)
+		} else {
+			client.close()
+		}
+		return false
+	}
+
+	if sentHello {
+		client.send(reply)
+	}
+	if !admitted {
+		client.handshake = handshakeAdmitted
+		s.registerClient(client)
+	}
+	return true
+}
+
+// endHandshake marks a client's connection as gone, so a pending hello timeout can't
+// register it anymore. Returns whether the client was registered with Run.
+func (c *Client) endHandshake() bool {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	admitted := c.handshake == handshakeAdmitted
+	c.handshake = handshakeClosed
+	return admitted
+}
+
+// parseHello returns the Hello a message carries. ok is false for any other message;
+// a Hello that doesn't match the schema is an error.
+func parseHello(message []byte) (hello Hello, ok bool, err error) {
+	value, messageType, isObject := decodeMessage(message)
+	if !isObject || messageType != "Hello" {
+		return Hello{}, false, nil
+	}
+	if err := messages.validate("Hello", value); err != nil {
+		return Hello{}, true, err
+	}
+	if err := json.Unmarshal(message, &hello); err != nil {
+		return Hello{}, true, err
+	}
+	return hello, true, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readMessageType reads the next message and returns its type along with the raw data
+func readMessageType(t *testing.T, conn *websocket.Conn) (string, []byte) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var typeCheck struct {
+		Type string `json:"type"`
+	}
+	require.NoError(t, json.Unmarshal(msg, &typeCheck))
+	return typeCheck.Type, msg
+}
+
+// requireReloadRequired reads a ReloadRequired and the close frame that follows it
+func requireReloadRequired(t *testing.T, conn *websocket.Conn, clientVersion int) {
+	msgType, msg := readMessageType(t, conn)
+	require.Equal(t, "ReloadRequired", msgType)
+	var reload ReloadRequired
+	require.NoError(t, json.Unmarshal(msg, &reload))
+	assert.Equal(t, currentProtocolVersion, reload.ProtocolVersion)
+	assert.Equal(t, 2, reload.MinProtocolVersion)
+	assert.Equal(t, ErrorCodeClientTooOld, reload.Code)
+	assert.Equal(t, map[string]string{"version": strconv.Itoa(clientVersion), "min": "2"}, reload.Params)
+	assert.Contains(t, reload.Error, "reload")
+
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr), "expected close frame, got %v", err)
+	assert.Equal(t, 4000, closeErr.Code)
+}
+
+func TestHandshake_WelcomePrecedesRollup(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion, ClientVersion: "test"}))
+
+	msgType, msg := readMessageType(t, conn)
+	require.Equal(t, "Welcome", msgType)
+	var welcome Welcome
+	require.NoError(t, json.Unmarshal(msg, &welcome))
+	assert.Equal(t, currentProtocolVersion, welcome.ProtocolVersion)
+	assert.Equal(t, legacyProtocolVersion, welcome.MinProtocolVersion)
+	assert.Equal(t, "dev", welcome.ServerVersion)
+	assert.Contains(t, welcome.Features, "batch")
+
+	msgType, _ = readMessageType(t, conn)
+	assert.Equal(t, "StateRollup", msgType)
+	assert.Equal(t, 1, readClientCount(t, conn))
+}
+
+func TestHandshake_WelcomeMatchesSchema(t *testing.T) {
+	server := NewServer(nil)
+	reply, accepted := server.negotiate(currentProtocolVersion)
+	require.True(t, accepted)
+	value, _, ok := decodeMessage(reply)
+	require.True(t, ok)
+	assert.NoError(t, messages.validate("Welcome", value))
+
+	require.NoError(t, server.SetMinProtocolVersion(2))
+	reply, accepted = server.negotiate(legacyProtocolVersion)
+	require.False(t, accepted)
+	value, _, ok = decodeMessage(reply)
+	require.True(t, ok)
+	assert.NoError(t, messages.validate("ReloadRequired", value))
+}
+
+func TestHandshake_LegacyClientAdmittedOnFirstMessage(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	// Old clients send commands without saying hello first
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"SetListTitle","commandId":"old-1","title":"Groceries"}`)))
+
+	// The response is sent directly, so it may overtake the rollup Run sends
+	received := map[string][]byte{}
+	for received["CommandResponse"] == nil || received["ListTitleChanged"] == nil {
+		msgType, msg := readMessageType(t, conn)
+		if received["StateRollup"] == nil {
+			assert.NotEqual(t, "ListTitleChanged", msgType, "events follow the rollup")
+		}
+		received[msgType] = msg
+	}
+	assert.NotContains(t, received, "Welcome", "legacy clients get no Welcome")
+	assert.Contains(t, received, "StateRollup")
+	var response CommandResponse
+	require.NoError(t, json.Unmarshal(received["CommandResponse"], &response))
+	assert.True(t, response.Success)
+}
+
+func TestHandshake_SilentLegacyClientAdmittedAfterTimeout(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	cfg := DefaultWebSocketConfig()
+	cfg.HelloTimeout = 20 * time.Millisecond
+	server.SetWebSocketConfig(cfg)
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	msgType, _ := readMessageType(t, conn)
+	assert.Equal(t, "StateRollup", msgType)
+	assert.Equal(t, 1, readClientCount(t, conn))
+
+	// A Hello arriving late is still answered
+	require.NoError(t, conn.WriteJSON(Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion}))
+	msgType, _ = readMessageType(t, conn)
+	assert.Equal(t, "Welcome", msgType)
+}
+
+func TestHandshake_LegacyClientGetsRollupAfterHelloTimeout(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	server.state.Apply(ListTitleChanged{Type: "ListTitleChanged", Title: "Groceries"})
+
+	// Clients from before the handshake never send a Hello, so their first load waits out
+	// the hello timeout: 2s by default, testHelloTimeout on test servers
+	assert.Equal(t, 2*time.Second, DefaultWebSocketConfig().HelloTimeout)
+	start := time.Now()
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+
+	msgType, msg := readMessageType(t, conn)
+	require.Equal(t, "StateRollup", msgType, "legacy clients get no Welcome")
+	assert.GreaterOrEqual(t, time.Since(start), testHelloTimeout)
+	var rollup StateRollup
+	require.NoError(t, json.Unmarshal(msg, &rollup))
+	assert.Equal(t, "Groceries", rollup.ListTitle)
+	assert.Equal(t, 1, readClientCount(t, conn))
+}
+
+func TestHandshake_TooOldClientMustReload(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	require.NoError(t, server.SetMinProtocolVersion(2))
+
+	// A connected client doesn't hear about the rejected one
+	live := connectWSHello(t, wsURL)
+	defer live.Close()
+	readMessageType(t, live) // rollup
+	assert.Equal(t, 1, readClientCount(t, live))
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	require.NoError(t, conn.WriteJSON(Hello{Type: "Hello", ProtocolVersion: 1}))
+	requireReloadRequired(t, conn, 1)
+
+	live.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err := live.ReadMessage()
+	assert.Error(t, err, "no client count change expected")
+}
+
+func TestHandshake_LegacyClientMustReloadWhenNotAccepted(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	require.NoError(t, server.SetMinProtocolVersion(2))
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"SetListTitle","commandId":"old-1","title":"Groceries"}`)))
+	requireReloadRequired(t, conn, 1)
+	assert.Equal(t, "My Todo List", server.state.GetListTitle(), "commands of rejected clients are ignored")
+}
+
+func TestHandshake_InvalidHelloLeftToTimeout(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	cfg := DefaultWebSocketConfig()
+	cfg.HelloTimeout = 50 * time.Millisecond
+	server.SetWebSocketConfig(cfg)
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"Hello","protocolVersion":"two"}`)))
+
+	msgType, _ := readMessageType(t, conn)
+	assert.Equal(t, "StateRollup", msgType)
+}
+
+func TestSetMinProtocolVersion(t *testing.T) {
+	server := NewServer(nil)
+	assert.NoError(t, server.SetMinProtocolVersion(legacyProtocolVersion))
+	assert.NoError(t, server.SetMinProtocolVersion(currentProtocolVersion))
+	assert.Error(t, server.SetMinProtocolVersion(0))
+	assert.Error(t, server.SetMinProtocolVersion(currentProtocolVersion+1))
+}
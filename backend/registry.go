@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Commands and events are dispatched through registries rather than type switches, so a
+// domain's commands, their checks and its projectors live together in the domain's file.
+// Each file registers its types from an init function; events_gen.go registers the event
+// decoders generated from the schema.
+
+// commandHandler decodes one command type and produces its event
+type commandHandler struct {
+	decode  func(data []byte) (Command, error)
+	check   func(state *State, cmd Command) error          // Rejects commands the state doesn't allow; may be nil
+	produce func(state *State, cmd Command) (Event, error) // Nil for commands executed elsewhere, like Batch
+}
+
+// eventHandler decodes one event type and projects it onto the state
+type eventHandler struct {
+	decode  func(data []byte) (Event, error)
+	project func(state *State, event Event)
+}
+
+var (
+	commandHandlers = map[string]*commandHandler{}
+	eventHandlers   = map[string]*eventHandler{}
+)
+
+// registerCommand registers a command type decoded from JSON into C. check may be nil;
+// produce runs only for commands check accepted, with the same state.
+func registerCommand[C Command](commandType string, check func(*State, C) error, produce func(*State, C) (Event, error)) {
+	handler := &commandHandler{
+		decode: func(data []byte) (Command, error) {
+			var cmd C
+			if err := json.Unmarshal(data, &cmd); err != nil {
+				return nil, err
+			}
+			return cmd, nil
+		},
+		produce: func(state *State, cmd Command) (Event, error) {
+			c, ok := cmd.(C)
+			if !ok {
+				return nil, invalid(ErrorCodeCommandTypeMismatch, "got", fmt.Sprintf("%T", cmd), "type", commandType)
+			}
+			return produce(state, c)
+		},
+	}
+	if check != nil {
+		handler.check = func(state *State, cmd Command) error {
+			c, ok := cmd.(C)
+			if !ok {
+				return invalid(ErrorCodeCommandTypeMismatch, "got", fmt.Sprintf("%T", cmd), "type", commandType)
+			}
+			return check(state, c)
+		}
+	}
+	registerCommandHandler(commandType, handler)
+}
+
+// registerCommandHandler registers a command type that needs its own decoding
+func registerCommandHandler(commandType string, handler *commandHandler) {
+	if _, ok := commandHandlers[commandType]; ok {
+		panic(fmt.Sprintf("command %s registered twice", commandType))
+	}
+	commandHandlers[commandType] = handler
+}
+
+// registerEvent registers the decoder of an event type
+func registerEvent[E Event]() {
+	var zero E
+	eventType := zero.EventType()
+	handler := eventHandlerFor(eventType)
+	if handler.decode != nil {
+		panic(fmt.Sprintf("event %s registered twice", eventType))
+	}
+	handler.decode = func(data []byte) (Event, error) {
+		var e E
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", eventType, err)
+		}
+		return e, nil
+	}
+}
+
+// registerProjector registers how an event type changes the state. Projectors run with the
+// state's lock held and must not call its locking methods.
+func registerProjector[E Event](project func(*State, E)) {
+	var zero E
+	eventType := zero.EventType()
+	handler := eventHandlerFor(eventType)
+	if handler.project != nil {
+		panic(fmt.Sprintf("projector for %s registered twice", eventType))
+	}
+	handler.project = func(state *State, event Event) {
+		if e, ok := event.(E); ok {
+			project(state, e)
+		}
+	}
+}
+
+// eventHandlerFor returns the handler of an event type, adding it on first use: decoders
+// and projectors are registered from different files, in no particular order
+func eventHandlerFor(eventType string) *eventHandler {
+	handler, ok := eventHandlers[eventType]
+	if !ok {
+		handler = &eventHandler{}
+		eventHandlers[eventType] = handler
+	}
+	return handler
+}
+
+// decodeCommand unmarshals JSON that was validated against the schema into the correct
+// command type. Unknown command types return a nil command.
+func decodeCommand(data []byte) (Command, error) {
+	var base BaseCommand
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	handler, ok := commandHandlers[base.Type]
+	if !ok {
+		return nil, nil
+	}
+	return handler.decode(data)
+}
+
+// convertCommand validates a command against the given state and maps it to a domain event.
+// Commands without an event producer return a nil event.
+func convertCommand(state *State, cmd Command) (Event, error) {
+	handler, ok := commandHandlers[cmd.GetType()]
+	if !ok || handler.produce == nil {
+		return nil, nil
+	}
+	if handler.check != nil {
+		if err := handler.check(state, cmd); err != nil {
+			return nil, err
+		}
+	}
+	return handler.produce(state, cmd)
+}
+
+// ParseEvent parses a JSON event into the appropriate Event type
+func ParseEvent(data []byte) (Event, error) {
+	var typeCheck struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &typeCheck); err != nil {
+		return nil, fmt.Errorf("failed to parse event type: %w", err)
+	}
+
+	handler, ok := eventHandlers[typeCheck.Type]
+	if !ok || handler.decode == nil {
+		return nil, fmt.Errorf("unknown event type: %s", typeCheck.Type)
+	}
+	return handler.decode(data)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRegistry_CoversSchema fails when a command or event added to the schema has no
+// handler registered for it
+func TestRegistry_CoversSchema(t *testing.T) {
+	for _, commandType := range messages.commands {
+		handler, ok := commandHandlers[commandType]
+		if assert.True(t, ok, "no handler registered for command %s", commandType) {
+			assert.NotNil(t, handler.decode, commandType)
+			if commandType != "Batch" {
+				assert.NotNil(t, handler.produce, commandType)
+			}
+		}
+	}
+	for _, eventType := range messages.events {
+		handler, ok := eventHandlers[eventType]
+		if assert.True(t, ok, "no handler registered for event %s", eventType) {
+			assert.NotNil(t, handler.decode, "%s has no decoder", eventType)
+			assert.NotNil(t, handler.project, "%s has no projector", eventType)
+		}
+	}
+	assert.Len(t, commandHandlers, len(messages.commands), "commands registered but missing from the schema")
+	assert.Len(t, eventHandlers, len(messages.events), "events registered but missing from the schema")
+}
+
+func TestRegistry_RejectsDuplicateRegistration(t *testing.T) {
+	assert.Panics(t, func() {
+		registerCommand("CreateTodo", nil, func(*State, CreateTodoCommand) (Event, error) { return nil, nil })
+	})
+	assert.Panics(t, func() { registerEvent[TodoCreated]() })
+	assert.Panics(t, func() { registerProjector(func(*State, TodoCreated) {}) })
+}
+
+func TestConvertCommand_MismatchedType(t *testing.T) {
+	// The type field picks the handler, so it must agree with the Go type
+	_, err := convertCommand(NewState(), RenameTodoCommand{
+		BaseCommand: BaseCommand{Type: "CompleteTodo"},
+		ID:          "todo-1",
+	})
+	var commandErr *CommandError
+	require.ErrorAs(t, err, &commandErr)
+	assert.Equal(t, ErrorKindInvalid, commandErr.Kind)
+}
+
+func TestConvertCommand_CheckRunsBeforeProduce(t *testing.T) {
+	event, err := convertCommand(NewState(), DeleteCategoryCommand{
+		BaseCommand: BaseCommand{Type: "DeleteCategory"},
+		ID:          "missing",
+	})
+	assert.Nil(t, event)
+	var commandErr *CommandError
+	require.ErrorAs(t, err, &commandErr)
+	assert.Equal(t, ErrorKindNotFound, commandErr.Kind)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// runRotateKey implements the "rotate-key" subcommand, which rewrites the event log with
+// a new encryption key. The current key comes from the configuration, if any, so the same
+// command also encrypts a plain log or, with -decrypt, turns an encrypted one back into plain JSON:
+//
+//	foodlist rotate-key -new-key-file FILE [-backend jsonl] [-data-dir DIR]
+//	foodlist rotate-key -decrypt [-backend jsonl] [-data-dir DIR]
+//
+// The log is rewritten to a new file that replaces the old one only once complete.
+// Fails with ErrStoreLocked while the server is using the data directory. Returns the process exit code.
+func runRotateKey(args []string, backend StoreBackend, dataDir string, opts StoreOptions, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	newKeyFile := flags.String("new-key-file", "", "file holding the new base64 encoded 32 byte key")
+	decrypt := flags.Bool("decrypt", false, "rewrite the log without encryption")
+	flags.StringVar((*string)(&backend), "backend", string(backend), "store backend (jsonl or bolt)")
+	flags.StringVar(&dataDir, "data-dir", dataDir, "directory holding the event store")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if err := rotateKey(backend, dataDir, opts, *newKeyFile, *decrypt, stdout); err != nil {
+		fmt.Fprintf(stderr, "rotate-key: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func rotateKey(backend StoreBackend, dataDir string, opts StoreOptions, newKeyFile string, decrypt bool, stdout io.Writer) error {
+	if (newKeyFile == "") == !decrypt {
+		return errors.New("give either -new-key-file or -decrypt")
+	}
+	var next *EventCipher
+	if !decrypt {
+		var err error
+		if next, err = LoadEventCipher("", newKeyFile); err != nil {
+			return err
+		}
+	}
+
+	count, err := rewriteEventLog(backend, dataDir, opts, next)
+	if err != nil {
+		return err
+	}
+
+	if next == nil {
+		fmt.Fprintf(stdout, "decrypted %d events; unset the encryption key before starting the server\n", count)
+	} else {
+		fmt.Fprintf(stdout, "encrypted %d events with key %s; configure the new key before starting the server\n", count, next.KeyID())
+	}
+	return nil
+}
+
+// rewriteEventLog copies the event log, decrypted with opts.Cipher, into a new log encrypted
+// with next (either may be nil for plain JSON), then replaces the old log with it.
+// Holds the data directory lock throughout. Returns the number of events rewritten.
+func rewriteEventLog(backend StoreBackend, dataDir string, opts StoreOptions, next *EventCipher) (int, error) {
+	path, err := backend.Path(dataDir)
+	if err != nil {
+		return 0, err
+	}
+
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.release()
+
+	// The new log is written in its own directory, which it locks, then moved into place
+	tmpDir, err := os.MkdirTemp(dataDir, ".rotate-key-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	keepTmpDir := false
+	defer func() {
+		if !keepTmpDir {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+	tmpPath := filepath.Join(tmpDir, filepath.Base(path))
+
+	srcOpts := opts
+	srcOpts.ReadOnly = true
+	src, err := OpenEventStore(backend, path, srcOpts)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	// The new log is a single file, only that is moved into place
+	dstOpts := opts
+	dstOpts.Cipher = next
+	dstOpts.SegmentMaxSize = 0
+	dstOpts.SegmentMaxAge = 0
+	dst, err := OpenEventStore(backend, tmpPath, dstOpts)
+	if err != nil {
+		return 0, err
+	}
+
+	count, rewriteErr := MigrateEvents(src, dst)
+	if err := errors.Join(dst.Close(), src.Close()); err != nil && rewriteErr == nil {
+		rewriteErr = err
+	}
+	if rewriteErr != nil {
+		return 0, rewriteErr
+	}
+
+	// Move the old log, all its segments, out of the way first. Should this be interrupted,
+	// the old log is left in the temporary directory rather than mixed with the new one.
+	previous, err := backend.Files(path)
+	if err != nil {
+		return 0, err
+	}
+	previousDir := filepath.Join(tmpDir, "previous")
+	if err := moveFiles(previous, previousDir); err != nil {
+		return 0, fmt.Errorf("failed to move old event log aside: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		// Put the old log back before the temporary directory is removed
+		for _, file := range previous {
+			if restoreErr := os.Rename(filepath.Join(previousDir, filepath.Base(file)), file); restoreErr != nil {
+				keepTmpDir = true
+				return 0, fmt.Errorf("failed to replace event log: %w; old log left in %s", err, previousDir)
+			}
+		}
+		return 0, fmt.Errorf("failed to replace event log: %w", err)
+	}
+	if err := syncDir(dataDir); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// syncDir syncs a directory so a rename within it is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
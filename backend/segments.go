@@ -0,0 +1,231 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// segment is a sealed part of a JSONL log. Once the active file reaches the size or age
+// threshold it is renamed to the next numbered segment, e.g. events.jsonl becomes
+// events.000001.jsonl, and optionally gzipped to events.000001.jsonl.gz.
+// Sealed segments never change, so their event counts can be cached.
+type segment struct {
+	path       string
+	number     int
+	compressed bool
+}
+
+// segmentPath returns the path of sealed segment number n of the log at filePath
+func segmentPath(filePath string, n int) string {
+	ext := filepath.Ext(filePath)
+	return fmt.Sprintf("%s.%06d%s", strings.TrimSuffix(filePath, ext), n, ext)
+}
+
+// listSegments returns the sealed segments of the log at filePath, oldest first.
+// If a segment exists both plain and compressed, compression was interrupted after the
+// compressed file was complete; the plain one is used.
+func listSegments(filePath string) ([]segment, error) {
+	ext := filepath.Ext(filePath)
+	stem := strings.TrimSuffix(filePath, ext)
+	matches, err := filepath.Glob(stem + ".*" + ext + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	byNumber := make(map[int]segment)
+	for _, match := range matches {
+		name, compressed := strings.CutSuffix(match, ".gz")
+		digits, ok := strings.CutSuffix(strings.TrimPrefix(name, stem+"."), ext)
+		if !ok || len(digits) != 6 {
+			continue
+		}
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 {
+			continue
+		}
+		if existing, ok := byNumber[n]; ok && !existing.compressed {
+			continue
+		}
+		byNumber[n] = segment{path: match, number: n, compressed: compressed}
+	}
+
+	segments := make([]segment, 0, len(byNumber))
+	for _, seg := range byNumber {
+		segments = append(segments, seg)
+	}
+	slices.SortFunc(segments, func(a, b segment) int { return a.number - b.number })
+	return segments, nil
+}
+
+// open opens the segment for reading, decompressing it if needed
+func (seg segment) open() (io.ReadCloser, error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	if !seg.compressed {
+		return file, nil
+	}
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open compressed segment %s: %w", seg.path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
+
+// jsonlLogFiles returns every file of the JSONL log at filePath that exists:
+// its sealed segments, oldest first, then the active file
+func jsonlLogFiles(filePath string) ([]string, error) {
+	segments, err := listSegments(filePath)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(segments)+1)
+	for _, seg := range segments {
+		files = append(files, seg.path)
+	}
+	if _, err := os.Stat(filePath); err == nil {
+		files = append(files, filePath)
+	}
+	return files, nil
+}
+
+// shouldRollOver reports whether the active file has reached a segment threshold (writerLoop only)
+func (s *JSONLStore) shouldRollOver() bool {
+	if s.activeSince.IsZero() {
+		// Nothing written to the active file yet
+		return false
+	}
+	if s.opts.SegmentMaxSize > 0 && s.size() >= s.opts.SegmentMaxSize {
+		return true
+	}
+	return s.opts.SegmentMaxAge > 0 && time.Since(s.activeSince) >= s.opts.SegmentMaxAge
+}
+
+// maybeRollOver seals the active file as the next segment once it reaches a threshold and
+// starts a new one, then compresses sealed segments if enabled. Must only be called when
+// every write is synced. Readers hold segmentsMu while listing and opening files, so if
+// any are reading the roll-over is left for a later append rather than blocking the writer.
+// This should only be called from the writerLoop goroutine.
+func (s *JSONLStore) maybeRollOver() {
+	if !s.shouldRollOver() || !s.segmentsMu.TryLock() {
+		return
+	}
+	err := s.rollOver()
+	s.segmentsMu.Unlock()
+	if err != nil {
+		slog.Error("failed to roll over event store segment", "error", err)
+		return
+	}
+
+	if s.opts.CompressSegments {
+		s.compressSegments()
+	}
+}
+
+// rollOver renames the active file to the next segment and opens a new active file.
+// Must be called with segmentsMu held (writerLoop only).
+func (s *JSONLStore) rollOver() error {
+	segments, err := listSegments(s.filePath)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(segments) > 0 {
+		next = segments[len(segments)-1].number + 1
+	}
+
+	sealed := segmentPath(s.filePath, next)
+	if err := os.Rename(s.filePath, sealed); err != nil {
+		return fmt.Errorf("failed to seal segment: %w", err)
+	}
+	file, err := os.OpenFile(s.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		// Keep appending to the sealed file rather than losing writes; it is still last
+		os.Rename(sealed, s.filePath)
+		return fmt.Errorf("failed to open new active file: %w", err)
+	}
+	if err := syncDir(filepath.Dir(s.filePath)); err != nil {
+		slog.Warn("failed to sync data directory after roll-over", "error", err)
+	}
+
+	s.file.Close()
+	s.file = file
+	s.activeSince = time.Time{}
+	slog.Info("event store segment sealed", "segment", sealed)
+	return nil
+}
+
+// compressSegments gzips every plain sealed segment. Each is compressed next to the plain
+// one, which is only swapped out if no reader holds segmentsMu. (writerLoop only)
+func (s *JSONLStore) compressSegments() {
+	segments, err := listSegments(s.filePath)
+	if err != nil {
+		slog.Error("failed to list event store segments", "error", err)
+		return
+	}
+	for _, seg := range segments {
+		if seg.compressed {
+			continue
+		}
+		compressed, err := compressFile(seg.path)
+		if err != nil {
+			slog.Error("failed to compress event store segment", "segment", seg.path, "error", err)
+			continue
+		}
+		if !s.segmentsMu.TryLock() {
+			os.Remove(compressed)
+			return
+		}
+		err = os.Rename(compressed, seg.path+".gz")
+		if err == nil {
+			err = os.Remove(seg.path)
+		}
+		s.segmentsMu.Unlock()
+		if err != nil {
+			slog.Error("failed to replace event store segment with compressed one", "segment", seg.path, "error", err)
+		}
+	}
+}
+
+// compressFile gzips path into a synced temporary file next to it and returns its path
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".compress-*")
+	if err != nil {
+		return "", err
+	}
+	gz := gzip.NewWriter(tmp)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
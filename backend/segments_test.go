@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openSegmentedStore(t *testing.T, path string, mutate func(*StoreOptions)) *JSONLStore {
+	opts := DefaultStoreOptions()
+	opts.SegmentMaxSize = 300
+	if mutate != nil {
+		mutate(&opts)
+	}
+	store, err := NewJSONLStoreWithOptions(path, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func segmentNames(t *testing.T, path string) []string {
+	segments, err := listSegments(path)
+	require.NoError(t, err)
+	names := make([]string, len(segments))
+	for i, seg := range segments {
+		names[i] = filepath.Base(seg.path)
+	}
+	return names
+}
+
+func todoIDs(from, to int) []string {
+	ids := []string{}
+	for i := from; i < to; i++ {
+		ids = append(ids, fmt.Sprintf("todo-%d", i))
+	}
+	return ids
+}
+
+func TestJSONLStore_RollsOverAtSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store := openSegmentedStore(t, path, nil)
+
+	for i := range 20 {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+
+	names := segmentNames(t, path)
+	require.NotEmpty(t, names)
+	assert.Equal(t, "events.000001.jsonl", names[0])
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+		require.NoError(t, err)
+		assert.Less(t, info.Size(), int64(300+200), "segment %s should be sealed soon after passing the size", name)
+	}
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(0, 20), eventIDs(events))
+
+	// Incremental reads span segments, both before and after segment counts are cached
+	for _, position := range []int{0, 1, 7, 13, 19, 20, 25} {
+		events, err := store.ReadFrom(position)
+		require.NoError(t, err)
+		assert.Equal(t, todoIDs(min(position, 20), 20), eventIDs(events), "ReadFrom(%d)", position)
+	}
+
+	// Reopening continues after the last segment
+	require.NoError(t, store.Close())
+	reopened := openSegmentedStore(t, path, nil)
+	for i := 20; i < 30; i++ {
+		require.NoError(t, reopened.Append(createdEvent(i)))
+	}
+	assert.Greater(t, len(segmentNames(t, path)), len(names))
+	events, err = reopened.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(0, 30), eventIDs(events))
+}
+
+func TestJSONLStore_RollsOverAtAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store := openSegmentedStore(t, path, func(opts *StoreOptions) {
+		opts.SegmentMaxSize = 0
+		opts.SegmentMaxAge = 20 * time.Millisecond
+	})
+
+	require.NoError(t, store.Append(createdEvent(0)))
+	assert.Empty(t, segmentNames(t, path))
+
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, store.Append(createdEvent(1)))
+	assert.Equal(t, []string{"events.000001.jsonl"}, segmentNames(t, path))
+
+	// The new active file starts its own clock
+	require.NoError(t, store.Append(createdEvent(2)))
+	assert.Len(t, segmentNames(t, path), 1)
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(0, 3), eventIDs(events))
+}
+
+func TestJSONLStore_CompressesSealedSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	_, cipher := newTestKey(t)
+	store := openSegmentedStore(t, path, func(opts *StoreOptions) {
+		opts.CompressSegments = true
+		opts.Cipher = cipher
+	})
+
+	for i := range 20 {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+	// Segments are compressed after appends are acknowledged; closing waits for the writer
+	require.NoError(t, store.Close())
+
+	names := segmentNames(t, path)
+	require.NotEmpty(t, names)
+	for _, name := range names {
+		assert.Equal(t, ".gz", filepath.Ext(name))
+	}
+	leftovers, err := filepath.Glob(filepath.Join(filepath.Dir(path), ".compress-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+
+	store = openSegmentedStore(t, path, func(opts *StoreOptions) {
+		opts.CompressSegments = true
+		opts.Cipher = cipher
+	})
+	events, err := store.ReadFrom(3)
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(3, 20), eventIDs(events))
+
+	// A backup is one plain JSONL file, events still encrypted
+	var buf bytes.Buffer
+	count, err := store.Backup(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 20, count)
+	assert.Equal(t, 20, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte(encryptedPrefix)))
+
+	// Read-only stores read segments too
+	reader, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true, Cipher: cipher})
+	require.NoError(t, err)
+	events, err = reader.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(0, 20), eventIDs(events))
+}
+
+func TestListSegments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+	for _, name := range []string{
+		"events.jsonl",
+		"events.000002.jsonl.gz",
+		"events.000001.jsonl",
+		"events.000003.jsonl",
+		"events.000003.jsonl.gz", // Compression interrupted before the plain file was removed
+		"events.1.jsonl",
+		"events.jsonl.bak",
+		"other.000004.jsonl",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	assert.Equal(t, []string{"events.000001.jsonl", "events.000002.jsonl.gz", "events.000003.jsonl"}, segmentNames(t, path))
+
+	files, err := StoreBackendJSONL.Files(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "events.000001.jsonl"),
+		filepath.Join(dir, "events.000002.jsonl.gz"),
+		filepath.Join(dir, "events.000003.jsonl"),
+		path,
+	}, files)
+}
+
+func TestRotateKey_RewritesSegmentedLogAsOneFile(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "events.jsonl")
+	store := openSegmentedStore(t, path, func(opts *StoreOptions) { opts.CompressSegments = true })
+	for i := range 20 {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+	require.NoError(t, store.Close())
+	require.NotEmpty(t, segmentNames(t, path))
+
+	key, cipher := newTestKey(t)
+	keyFile := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte(key), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	require.Equal(t, 0, runRotateKey([]string{"-new-key-file", keyFile}, StoreBackendJSONL, dataDir, DefaultStoreOptions(), &stdout, &stderr), stderr.String())
+
+	assert.Empty(t, segmentNames(t, path))
+	reader, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true, Cipher: cipher})
+	require.NoError(t, err)
+	events, err := reader.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, todoIDs(0, 20), eventIDs(events))
+}
@@ -2,177 +2,271 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(_ *http.Request) bool {
-		return true // Allow all origins for development
-	},
+// newUpgrader returns the upgrader for the given settings. Clients pick the message
+// encoding through the subprotocol and permessage-deflate through the extension they offer.
+func newUpgrader(cfg WebSocketConfig) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: func(_ *http.Request) bool {
+			return true // Allow all origins for development
+		},
+		Subprotocols:      messageSubprotocols,
+		EnableCompression: cfg.Compression,
+	}
 }
 
-// Client represents a connected WebSocket client
+// Client represents a connected WebSocket or SSE client
 type Client struct {
-	conn   *websocket.Conn
-	sendCh chan []byte
-}
+	conn         *websocket.Conn       // nil for SSE clients
+	encoding     messageEncoding       // How messages are written to conn; they are queued as JSON
+	sendCh       chan *outgoingMessage // Outgoing messages; only send and close may touch it
+	autocomplete *autocompleteQueue
 
-// Server manages WebSocket connections and event broadcasting
-type Server struct {
-	store      *EventStore
-	state      *State
-	clients    map[*Client]bool
-	register   chan *Client
-	unregister chan *Client
-	broadcast  chan []byte
-}
+	mu         sync.Mutex // Guards closed, closeFrame and sends on sendCh
+	closed     bool
+	closeFrame []byte // Close frame the WebSocket writer sends once sendCh is closed
 
-// ClientCountMessage informs clients of current connected user count
-type ClientCountMessage struct {
-	Type  string `json:"type"`
-	Count int    `json:"count"`
+	handshakeMu sync.Mutex // Guards handshake; held while registering with Run
+	handshake   handshakeState
 }
 
-// CommandResponse is sent to a client in response to a command
-type CommandResponse struct {
-	Type      string `json:"type"`
-	CommandID string `json:"commandId"`
-	Success   bool   `json:"success"`
-	Error     string `json:"error,omitempty"`
-}
+// handshakeState tracks whether a WebSocket client has been admitted to Run yet
+type handshakeState int
 
-// Command represents an incoming action from the client
-type Command interface {
-	GetType() string
-	GetCommandID() string
+const (
+	handshakePending  handshakeState = iota // Waiting for a Hello
+	handshakeAdmitted                       // Registered with Run
+	handshakeRejected                       // Told to reload; its messages are ignored
+	handshakeClosed                         // Connection gone
+)
+
+// newClient creates a client with an empty send buffer, encoding messages as negotiated
+// when conn was upgraded
+func newClient(conn *websocket.Conn) *Client {
+	encoding := encodingJSON
+	if conn != nil {
+		encoding = encodingFor(conn.Subprotocol())
+	}
+	return &Client{
+		conn:         conn,
+		encoding:     encoding,
+		sendCh:       make(chan *outgoingMessage, 256),
+		autocomplete: newAutocompleteQueue(),
+	}
 }
 
-type BaseCommand struct {
-	Type      string `json:"type"`
-	CommandID string `json:"commandId"`
+// send queues a message for the client without blocking.
+// Returns false if the client's buffer is full or the client has been closed.
+func (c *Client) send(message []byte) bool {
+	return c.sendMessage(newOutgoingMessage(message))
 }
 
-func (c BaseCommand) GetType() string      { return c.Type }
-func (c BaseCommand) GetCommandID() string { return c.CommandID }
+// sendMessage queues an already wrapped message, which may be shared with other clients,
+// like send
+func (c *Client) sendMessage(message *outgoingMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-type CreateTodoCommand struct {
-	BaseCommand
-	ID         string  `json:"id"`
-	Name       string  `json:"name"`
-	SortOrder  float64 `json:"sortOrder,omitempty"`
-	CategoryID *string `json:"categoryId,omitempty"`
+	if c.closed {
+		return false
+	}
+	select {
+	case c.sendCh <- message:
+		return true
+	default:
+		return false
+	}
 }
 
-type CategorizeTodoCommand struct {
-	BaseCommand
-	ID         string  `json:"id"`
-	CategoryID *string `json:"categoryId"`
+// setCloseFrame replaces the close frame sent when the client is closed
+func (c *Client) setCloseFrame(frame []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeFrame = frame
 }
 
-type CreateCategoryCommand struct {
-	BaseCommand
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	SortOrder float64 `json:"sortOrder,omitempty"`
-}
+// close closes the send channel, ending the client's writer. Safe to call more than once.
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-type RenameCategoryCommand struct {
-	BaseCommand
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	if !c.closed {
+		c.closed = true
+		close(c.sendCh)
+	}
 }
 
-type DeleteCategoryCommand struct {
-	BaseCommand
-	ID string `json:"id"`
-}
+// WebSocketConfig controls keepalive and limits of WebSocket connections
+type WebSocketConfig struct {
+	PingInterval   time.Duration // How often the server pings each client
+	PongTimeout    time.Duration // How long a connection may stay silent before it is considered dead
+	WriteTimeout   time.Duration // Deadline for writing a single message
+	MaxMessageSize int64         // Largest message accepted from a client, in bytes
+	HelloTimeout   time.Duration // How long to wait for a Hello before treating the client as legacy
 
-type ReorderCategoryCommand struct {
-	BaseCommand
-	ID        string  `json:"id"`
-	SortOrder float64 `json:"sortOrder"`
+	Compression        bool // Offer permessage-deflate to clients that support it
+	CompressionMinSize int  // Messages smaller than this many bytes are sent uncompressed
 }
 
-type CompleteTodoCommand struct {
-	BaseCommand
-	ID string `json:"id"`
+// DefaultWebSocketConfig returns the keepalive settings used unless configured otherwise
+func DefaultWebSocketConfig() WebSocketConfig {
+	return WebSocketConfig{
+		PingInterval:   30 * time.Second,
+		PongTimeout:    60 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxMessageSize: 64 * 1024,
+		HelloTimeout:   2 * time.Second,
+
+		Compression:        true,
+		CompressionMinSize: 1024,
+	}
 }
 
-type UncompleteTodoCommand struct {
-	BaseCommand
-	ID string `json:"id"`
+// Validate checks that the settings can detect dead connections
+func (c WebSocketConfig) Validate() error {
+	if c.PingInterval <= 0 || c.PongTimeout <= 0 || c.WriteTimeout <= 0 || c.HelloTimeout <= 0 {
+		return errors.New("websocket intervals and timeouts must be positive")
+	}
+	if c.PongTimeout <= c.PingInterval {
+		return fmt.Errorf("pong timeout (%s) must be longer than ping interval (%s)", c.PongTimeout, c.PingInterval)
+	}
+	if c.MaxMessageSize <= 0 {
+		return errors.New("websocket max message size must be positive")
+	}
+	if c.CompressionMinSize < 0 {
+		return errors.New("websocket compression min size must not be negative")
+	}
+	return nil
 }
 
-type StarTodoCommand struct {
-	BaseCommand
-	ID string `json:"id"`
+// Server manages WebSocket connections and event broadcasting
+type Server struct {
+	store       EventStore
+	state       *State
+	wsConfig    WebSocketConfig
+	upgrader    *websocket.Upgrader
+	minProtocol int            // Oldest client protocol version accepted
+	commandMu   sync.Mutex     // Serializes validate-queue-apply so concurrent commands see each other's effects
+	draining    bool           // Set under commandMu once shutdown starts; later commands are rejected
+	lastTurn    chan struct{}  // Closed once the latest queued command is published (commandMu); nil if none yet
+	stateEpoch  int            // Bumped whenever recoverState rebuilds the state (commandMu)
+	pending     sync.WaitGroup // Commands queued but not yet published; Shutdown waits for them
+	appending   sync.WaitGroup // Commands whose store append hasn't completed; recoverState waits for them
+	clients     map[*Client]bool
+	sseMu       sync.RWMutex       // Guards sseClients
+	sseClients  map[string]*Client // SSE clients by session ID, for routing posted messages
+	register    chan *Client
+	unregister  chan *Client
+	broadcast   chan []byte
+
+	stopMu      sync.Mutex     // Guards stopping and adding to connections
+	stopping    bool           // Set when shutdown closes stop
+	stop        chan struct{}  // Closed to stop Run and close all connections
+	stopped     chan struct{}  // Closed when Run has returned
+	connections sync.WaitGroup // Open WebSocket write pumps and SSE streams
 }
 
-type UnstarTodoCommand struct {
-	BaseCommand
-	ID string `json:"id"`
+// ClientCountMessage informs clients of current connected user count
+type ClientCountMessage struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
 }
 
-type ReorderTodoCommand struct {
-	BaseCommand
-	ID        string  `json:"id"`
-	SortOrder float64 `json:"sortOrder"`
+// CommandResponse is sent to a client in response to a command
+type CommandResponse struct {
+	Type      string            `json:"type"`
+	CommandID string            `json:"commandId"`
+	Success   bool              `json:"success"`
+	Error     string            `json:"error,omitempty"`     // English message of the code
+	Code      ErrorCode         `json:"code,omitempty"`      // Why the command was rejected
+	Params    map[string]string `json:"params,omitempty"`    // Values of the placeholders in the code's message template
+	Duplicate *Todo             `json:"duplicate,omitempty"` // Existing todo a CreateTodo was rejected for or merged into
+	Results   []CommandResult   `json:"results,omitempty"`   // Per-command outcome of a Batch
+	Errors    []FieldError      `json:"errors,omitempty"`    // Every field of a command that doesn't match the schema
 }
 
-type RenameTodoCommand struct {
-	BaseCommand
-	ID   string `json:"id"`
-	Name string `json:"name"`
+// errPersistFailed is reported to clients when an event could not be written to the store
+var errPersistFailed = errors.New("failed to persist event")
+
+// Command represents an incoming action from the client
+type Command interface {
+	GetType() string
+	GetCommandID() string
 }
 
-type SetListTitleCommand struct {
-	BaseCommand
-	Title string `json:"title"`
+type BaseCommand struct {
+	Type      string `json:"type"`
+	CommandID string `json:"commandId"`
 }
 
+func (c BaseCommand) GetType() string      { return c.Type }
+func (c BaseCommand) GetCommandID() string { return c.CommandID }
+
 // NewServer creates a new WebSocket server
-func NewServer(store *EventStore) *Server {
+func NewServer(store EventStore) *Server {
+	wsConfig := DefaultWebSocketConfig()
 	return &Server{
-		store:      store,
-		state:      NewState(),
-		clients:    make(map[*Client]bool),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		broadcast:  make(chan []byte, 256),
+		store:       store,
+		state:       NewState(),
+		wsConfig:    wsConfig,
+		upgrader:    newUpgrader(wsConfig),
+		minProtocol: legacyProtocolVersion,
+		clients:     make(map[*Client]bool),
+		sseClients:  make(map[string]*Client),
+		register:    make(chan *Client),
+		unregister:  make(chan *Client),
+		broadcast:   make(chan []byte, 256),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}
 }
 
-// Run starts the server's main event loop
+// SetWebSocketConfig replaces the keepalive settings for connections accepted from now on.
+// Must be called before the server starts accepting connections.
+func (s *Server) SetWebSocketConfig(cfg WebSocketConfig) {
+	s.wsConfig = cfg
+	s.upgrader = newUpgrader(cfg)
+}
+
+// Run starts the server's main event loop and runs it
+// until Shutdown is called
 func (s *Server) Run() {
+	defer close(s.stopped)
+
 	for {
 		select {
+		case <-s.stop:
+			// Connections close themselves: write pumps send a close frame, SSE streams end
+			slog.Info("server event loop stopped", "total_clients", len(s.clients))
+			return
+
 		case client := <-s.register:
 			s.clients[client] = true
 			slog.Info("client connected", "total_clients", len(s.clients))
+			// The rollup goes out first, so every later broadcast applies on top of it
+			s.sendStateRollup(client)
 			s.broadcastClientCount()
 
 		case client := <-s.unregister:
 			if _, ok := s.clients[client]; ok {
-				delete(s.clients, client)
-				close(client.sendCh)
+				s.removeClient(client)
 				slog.Info("client disconnected", "total_clients", len(s.clients))
 				s.broadcastClientCount()
 			}
 
 		case message := <-s.broadcast:
-			for client := range s.clients {
-				select {
-				case client.sendCh <- message:
-				default:
-					// Client's send buffer is full, disconnect
-					close(client.sendCh)
-					delete(s.clients, client)
-				}
+			if s.sendToAll(message) {
+				s.broadcastClientCount()
 			}
 		}
 	}
@@ -180,56 +274,92 @@ func (s *Server) Run() {
 
 // HandleWebSocket handles WebSocket upgrade and client communication
 func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Extract client IP and proxy headers
-	clientIP := r.RemoteAddr
-	xForwardedFor := r.Header.Get("X-Forwarded-For")
-	xRealIP := r.Header.Get("X-Real-IP")
-
 	// Log new WebSocket connection with IP and proxy headers
-	logAttrs := []any{
-		"remote_addr", clientIP,
-	}
-	if xForwardedFor != "" {
-		logAttrs = append(logAttrs, "x_forwarded_for", xForwardedFor)
-	}
-	if xRealIP != "" {
-		logAttrs = append(logAttrs, "x_real_ip", xRealIP)
-	}
-	slog.Info("new websocket connection", logAttrs...)
+	slog.Info("new websocket connection", connectionLogAttrs(r)...)
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		slog.Error("failed to upgrade connection", "error", err)
 		return
 	}
 
-	client := &Client{
-		conn:   conn,
-		sendCh: make(chan []byte, 256),
+	client := newClient(conn)
+
+	if !s.trackConnection() {
+		// Shutting down: tell the client to come back later
+		conn.WriteControl(websocket.CloseMessage, serverRestartingClose, time.Now().Add(s.wsConfig.WriteTimeout))
+		conn.Close()
+		return
 	}
 
-	s.register <- client
+	// Start goroutines for reading and writing; readPump registers the client after the handshake
+	go s.writePump(client)
+	go s.readPump(client)
+	go s.autocompletePump(client)
+}
+
+// connectionLogAttrs returns the client IP and proxy headers of a new connection for logging
+func connectionLogAttrs(r *http.Request) []any {
+	logAttrs := []any{
+		"remote_addr", r.RemoteAddr,
+	}
+	if xForwardedFor := r.Header.Get("X-Forwarded-For"); xForwardedFor != "" {
+		logAttrs = append(logAttrs, "x_forwarded_for", xForwardedFor)
+	}
+	if xRealIP := r.Header.Get("X-Real-IP"); xRealIP != "" {
+		logAttrs = append(logAttrs, "x_real_ip", xRealIP)
+	}
+	return logAttrs
+}
 
-	// Send state rollup to new client
-	rollup := StateRollup{
-		Type:       "StateRollup",
-		Todos:      s.state.GetTodos(),
-		Categories: s.state.GetCategories(),
-		ListTitle:  s.state.GetListTitle(),
+// stateRollup snapshots the current state for a newly connected client
+func (s *Server) stateRollup() StateRollup {
+	return StateRollup{
+		Type:            "StateRollup",
+		Todos:           s.state.GetTodos(),
+		Categories:      s.state.GetCategories(),
+		ListTitle:       s.state.GetListTitle(),
+		Synonyms:        s.state.GetSynonyms(),
+		DuplicatePolicy: s.state.GetDuplicatePolicy(),
+		PinnedNames:     s.state.GetPinnedNames(),
 	}
-	rollupData, err := json.Marshal(rollup)
+}
+
+// sendStateRollup sends the current state to a newly registered client (Run only)
+func (s *Server) sendStateRollup(client *Client) {
+	rollupData, err := json.Marshal(s.stateRollup())
 	if err != nil {
 		slog.Error("failed to marshal state rollup", "error", err)
-	} else {
-		client.sendCh <- rollupData
+		return
 	}
+	client.send(rollupData)
+}
 
-	// Start goroutines for reading and writing
-	go s.writePump(client)
-	go s.readPump(client)
+// sendToAll delivers a message to every client without blocking (Run only). All clients share
+// one outgoingMessage, so it is encoded once per encoding rather than once per client.
+// Clients whose buffer is full have fallen behind and are disconnected; returns true if any were.
+func (s *Server) sendToAll(message []byte) bool {
+	shared := newOutgoingMessage(message)
+	dropped := false
+	for client := range s.clients {
+		if !client.sendMessage(shared) {
+			slog.Warn("client send buffer full, disconnecting client")
+			s.removeClient(client)
+			dropped = true
+		}
+	}
+	return dropped
 }
 
-// broadcastClientCount sends the current number of connected clients to all clients
+// removeClient forgets a client and closes its send channel, which ends its writer (Run only).
+// Sends from the client's other goroutines are safely dropped from then on.
+func (s *Server) removeClient(client *Client) {
+	delete(s.clients, client)
+	client.close()
+}
+
+// broadcastClientCount sends the current number of connected clients to all clients.
+// Delivered directly rather than through the broadcast channel, which Run itself drains.
 func (s *Server) broadcastClientCount() {
 	msg := ClientCountMessage{
 		Type:  "ClientCount",
@@ -240,403 +370,430 @@ func (s *Server) broadcastClientCount() {
 		slog.Error("failed to marshal client count", "error", err)
 		return
 	}
-	s.broadcast <- data
+	for s.sendToAll(data) {
+		// Dropping slow clients changed the count; tell the remaining ones
+		data, _ = json.Marshal(ClientCountMessage{Type: "ClientCount", Count: len(s.clients)})
+	}
 }
 
-// writePump sends messages from the send channel to the WebSocket
+// writePump sends messages from the send channel to the WebSocket and pings the client
+// periodically, so dead connections are noticed by the read deadline in readPump
 func (s *Server) writePump(client *Client) {
+	ticker := time.NewTicker(s.wsConfig.PingInterval)
 	defer func() {
+		ticker.Stop()
 		client.conn.Close()
+		s.connections.Done()
 	}()
 
-	for message := range client.sendCh {
-		err := client.conn.WriteMessage(websocket.TextMessage, message)
-		if err != nil {
-			slog.Error("error writing message", "error", err)
+	for {
+		select {
+		case <-s.stop:
+			client.conn.SetWriteDeadline(time.Now().Add(s.wsConfig.WriteTimeout))
+			client.conn.WriteMessage(websocket.CloseMessage, serverRestartingClose)
 			return
+
+		case message, ok := <-client.sendCh:
+			client.conn.SetWriteDeadline(time.Now().Add(s.wsConfig.WriteTimeout))
+			if !ok {
+				// Unregistered by the server; closeFrame was set before sendCh was closed
+				client.conn.WriteMessage(websocket.CloseMessage, client.closeFrame)
+				return
+			}
+			frameType, data, err := message.encode(client.encoding)
+			if err != nil {
+				slog.Error("failed to encode message", "error", err)
+				continue
+			}
+			// Compressing small messages costs more than it saves
+			client.conn.EnableWriteCompression(len(data) >= s.wsConfig.CompressionMinSize)
+			if err := client.conn.WriteMessage(frameType, data); err != nil {
+				slog.Error("error writing message", "error", err)
+				return
+			}
+
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(s.wsConfig.WriteTimeout))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				slog.Info("failed to ping client, closing connection", "error", err)
+				return
+			}
 		}
 	}
 }
 
-// readPump reads messages from the WebSocket and processes events
+// readPump reads messages from the WebSocket and processes events.
+// Every pong extends the read deadline; a client that stops answering pings is disconnected.
+// The client is registered with Run once it sent a Hello, or as a legacy client when its
+// first message is anything else or it stays silent for the hello timeout.
 func (s *Server) readPump(client *Client) {
+	helloTimer := time.AfterFunc(s.wsConfig.HelloTimeout, func() {
+		s.finishHandshake(client, legacyProtocolVersion, false)
+	})
 	defer func() {
-		s.unregister <- client
+		helloTimer.Stop()
+		// Stop autocomplete work before unregistering, which closes the send channel
+		client.autocomplete.stop()
+		<-client.autocomplete.exited
+		if client.endHandshake() {
+			s.unregisterClient(client)
+		}
+		client.close()
 		client.conn.Close()
 	}()
 
+	client.conn.SetReadLimit(s.wsConfig.MaxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(s.wsConfig.PongTimeout))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(s.wsConfig.PongTimeout))
+	})
+
 	for {
-		_, message, err := client.conn.ReadMessage()
+		frameType, frame, err := client.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, websocket.ErrReadLimit):
+				slog.Warn("closing connection after oversized message", "limit", s.wsConfig.MaxMessageSize)
+			case errors.As(err, &netErr) && netErr.Timeout():
+				slog.Info("closing dead connection, no pong received", "timeout", s.wsConfig.PongTimeout)
+			case websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure):
 				slog.Error("websocket error", "error", err)
 			}
 			return
 		}
 
-		// Check if this is an autocomplete request first
-		if handled := s.handleAutocompleteRequest(client, message); handled {
-			continue
-		}
+		// Any message proves the connection is alive
+		client.conn.SetReadDeadline(time.Now().Add(s.wsConfig.PongTimeout))
 
-		// Parse and validate command
-		cmd, err := ParseCommand(message)
+		message, err := decodeFrame(frameType, frame)
 		if err != nil {
-			slog.Warn("invalid command received", "error", err, "message", string(message))
-			continue
-		}
-		if cmd == nil {
-			slog.Warn("unknown command received", "message", string(message))
+			slog.Warn("invalid message received", "error", err)
 			continue
 		}
 
-		// Log received command
-		slog.Info("command received", "type", cmd.GetType(), "commandId", cmd.GetCommandID(), "message", string(message))
-
-		// Convert command to event
-		event, err := s.commandToEvent(cmd)
-		if err != nil {
-			slog.Error("failed to convert command", "error", err, "command_type", cmd.GetType(), "commandId", cmd.GetCommandID())
-			// Send error response back to the client
-			response := CommandResponse{
-				Type:      "CommandResponse",
-				CommandID: cmd.GetCommandID(),
-				Success:   false,
-				Error:     err.Error(),
-			}
-			if responseData, marshalErr := json.Marshal(response); marshalErr == nil {
-				client.sendCh <- responseData
+		if hello, ok, err := parseHello(message); ok {
+			if err != nil {
+				// Left to the hello timeout
+				slog.Warn("invalid hello received", "error", err, "message", string(message))
+				continue
 			}
+			helloTimer.Stop()
+			slog.Info("client hello", "protocol_version", hello.ProtocolVersion, "client_version", hello.ClientVersion)
+			s.finishHandshake(client, hello.ProtocolVersion, true)
 			continue
 		}
-
-		// Persist event to store
-		if err := s.store.Append(event); err != nil {
-			slog.Error("failed to persist event", "error", err, "event_type", event.EventType())
-			// Send error response
-			response := CommandResponse{
-				Type:      "CommandResponse",
-				CommandID: cmd.GetCommandID(),
-				Success:   false,
-				Error:     "failed to persist event",
-			}
-			if responseData, marshalErr := json.Marshal(response); marshalErr == nil {
-				client.sendCh <- responseData
-			}
+		helloTimer.Stop()
+		if !s.finishHandshake(client, legacyProtocolVersion, false) {
 			continue
 		}
 
-		// Apply event to state
-		s.state.Apply(event)
-
-		// Send success response to the client
-		response := CommandResponse{
-			Type:      "CommandResponse",
-			CommandID: cmd.GetCommandID(),
-			Success:   true,
-		}
-		if responseData, err := json.Marshal(response); err == nil {
-			client.sendCh <- responseData
+		if err := s.handleClientMessage(client, message); err != nil {
+			slog.Warn("invalid message received", "error", err, "message", string(message))
 		}
+	}
+}
 
-		// Broadcast resulting event to all clients (including sender for confirmation)
-		eventData, err := MarshalEvent(event)
-		if err != nil {
-			slog.Error("failed to marshal event", "error", err, "event_type", event.EventType())
-			continue
+// errUnknownCommand is returned for messages whose type is not a known command
+var errUnknownCommand = errors.New("unknown command type")
+
+// handleClientMessage processes one message from a client: autocomplete requests are queued,
+// commands are executed and answered, and resulting events are broadcast to all clients.
+// Returns an error only if the message could not be parsed; rejected commands are answered instead.
+func (s *Server) handleClientMessage(client *Client, message []byte) error {
+	// Check if this is an autocomplete request first
+	if handled := s.handleAutocompleteRequest(client, message); handled {
+		return nil
+	}
+
+	// Parse and validate command
+	cmd, err := ParseCommand(message)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		slog.Warn("invalid command received", "error", err, "message", string(message))
+		s.sendCommandResponse(client, invalidCommandResponse(message, validationErr))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cmd == nil {
+		return errUnknownCommand
+	}
+
+	// Log received command
+	slog.Info("command received", "type", cmd.GetType(), "commandId", cmd.GetCommandID(), "message", string(message))
+
+	s.handleCommand(cmd, func(response CommandResponse, _ error) {
+		s.sendCommandResponse(client, response)
+	})
+	return nil
+}
+
+// sendCommandResponse answers the client that sent a command
+func (s *Server) sendCommandResponse(client *Client, response CommandResponse) {
+	if responseData, err := json.Marshal(response); err == nil {
+		if !client.send(responseData) {
+			slog.Warn("client gone or send buffer full, dropping command response", "commandId", response.CommandID)
 		}
-		s.broadcast <- eventData
 	}
 }
 
-// handleAutocompleteRequest checks if the message is an autocomplete request and handles it
-// Returns true if the message was an autocomplete request, false otherwise
-func (s *Server) handleAutocompleteRequest(client *Client, message []byte) bool {
-	var typeCheck struct {
-		Type string `json:"type"`
+// invalidCommandResponse rejects a command that doesn't match the schema
+func invalidCommandResponse(message []byte, err *ValidationError) CommandResponse {
+	// The commandId is only known if it is a string
+	var base struct {
+		CommandID any `json:"commandId"`
 	}
-	if err := json.Unmarshal(message, &typeCheck); err != nil {
-		return false
+	json.Unmarshal(message, &base)
+	commandID, _ := base.CommandID.(string)
+
+	return CommandResponse{
+		Type:      "CommandResponse",
+		CommandID: commandID,
+		Error:     err.Error(),
+		Code:      ErrorCodeInvalidFields,
+		Params:    err.params(),
+		Errors:    err.Errors,
 	}
+}
 
-	if typeCheck.Type != "AutocompleteRequest" {
-		return false
+// handleCommand executes a command, answers its sender through respond and broadcasts the
+// resulting event to all clients (including the sender, for confirmation). Commands are
+// validated and applied one at a time but wait for the store concurrently, so a store that
+// groups writes can make many of them durable with one sync; answers and broadcasts still go
+// out in the order the commands were applied. Returns the event, or the command's error.
+func (s *Server) handleCommand(cmd Command, respond func(CommandResponse, error)) (Event, error) {
+	event, queued, err := s.executeCommand(cmd)
+	broadcast := false
+	if queued != nil {
+		defer s.finishTurn(queued)
+		broadcast, err = s.awaitTurn(queued)
 	}
 
-	var req AutocompleteRequest
-	if err := json.Unmarshal(message, &req); err != nil {
-		slog.Warn("failed to parse autocomplete request", "error", err)
-		return true
+	response := newCommandResponse(cmd, err)
+	if err != nil {
+		if errors.Is(err, errPersistFailed) {
+			slog.Error("failed to persist event", "error", err, "event_type", event.EventType())
+		} else {
+			slog.Error("failed to convert command", "error", err, "command_type", cmd.GetType(), "commandId", cmd.GetCommandID())
+		}
+		respond(response, err)
+		return nil, err
 	}
 
-	// Get suggestions
-	suggestions := s.getAutocompleteSuggestions(req.Query)
+	// Report the todo a duplicate CreateTodo was merged into
+	if merged, ok := event.(TodoQuantityChanged); ok {
+		if _, isCreate := cmd.(CreateTodoCommand); isCreate {
+			response.Duplicate, _ = s.state.GetTodo(merged.ID)
+		}
+	}
 
-	// Create response
-	response := AutocompleteResponse{
-		Type:        "AutocompleteResponse",
-		Suggestions: suggestions,
-		RequestID:   req.RequestID,
+	respond(response, nil)
+	if broadcast {
+		s.broadcastEvent(event)
 	}
+	return event, nil
+}
 
-	// Send response only to the requesting client
-	responseData, err := json.Marshal(response)
+// broadcastEvent sends an applied event to all connected clients
+func (s *Server) broadcastEvent(event Event) {
+	eventData, err := MarshalEvent(event)
 	if err != nil {
-		slog.Error("failed to marshal autocomplete response", "error", err)
-		return true
+		slog.Error("failed to marshal event", "error", err, "event_type", event.EventType())
+		return
 	}
+	s.broadcastMessage(eventData)
+}
 
-	// Send directly to client, not broadcast
+// broadcastMessage hands a message to Run for all connected clients
+func (s *Server) broadcastMessage(message []byte) {
 	select {
-	case client.sendCh <- responseData:
-	default:
-		slog.Warn("client send buffer full, dropping autocomplete response")
+	case s.broadcast <- message:
+	case <-s.stopped:
+		// Nobody left to broadcast to
 	}
+}
 
-	return true
+// queuedCommand is a command whose events have been applied to the state and queued for the
+// store, but may not be durable yet
+type queuedCommand struct {
+	persisted <-chan error    // Receives the outcome of the append
+	prevTurn  <-chan struct{} // Closed once the command queued before this one is published; nil if none
+	turn      chan struct{}   // Closed once this command is published
+	epoch     int             // stateEpoch when the command was applied
 }
 
-// ParseCommand unmarshals incoming JSON into the correct command type
-func ParseCommand(data []byte) (Command, error) {
-	var base BaseCommand
-	if err := json.Unmarshal(data, &base); err != nil {
-		return nil, err
+// executeCommand converts a command to events, applies them to the state and queues them for
+// the store. The whole sequence runs under commandMu so validation always sees every earlier
+// command; the events may not be durable yet when it returns, see awaitTurn.
+// Events that don't match the schema are never queued nor applied: that error wraps
+// errPersistFailed and comes with the event that failed.
+func (s *Server) executeCommand(cmd Command) (Event, *queuedCommand, error) {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
+
+	if s.draining {
+		return nil, nil, errShuttingDown
 	}
 
-	switch base.Type {
-	case "CreateTodo":
-		var cmd CreateTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "CategorizeTodo":
-		var cmd CategorizeTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "CreateCategory":
-		var cmd CreateCategoryCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "RenameCategory":
-		var cmd RenameCategoryCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "DeleteCategory":
-		var cmd DeleteCategoryCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "ReorderCategory":
-		var cmd ReorderCategoryCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "CompleteTodo":
-		var cmd CompleteTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
+	var result Event
+	var events []Event
+	if batch, ok := cmd.(BatchCommand); ok {
+		var err error
+		if result, events, err = s.convertBatch(batch); err != nil {
+			return nil, nil, err
 		}
-		return cmd, nil
-	case "UncompleteTodo":
-		var cmd UncompleteTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "StarTodo":
-		var cmd StarTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "UnstarTodo":
-		var cmd UnstarTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
-		}
-		return cmd, nil
-	case "ReorderTodo":
-		var cmd ReorderTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
+	} else {
+		// Convert command to event
+		event, err := s.commandToEvent(cmd)
+		if err != nil {
+			return nil, nil, err
 		}
-		return cmd, nil
-	case "RenameTodo":
-		var cmd RenameTodoCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
+		if event == nil {
+			// Never persist a null line, e.g. for a CreateTodo without an id
+			return nil, nil, invalid(ErrorCodeNoEvent)
 		}
-		return cmd, nil
-	case "SetListTitle":
-		var cmd SetListTitleCommand
-		if err := json.Unmarshal(data, &cmd); err != nil {
-			return nil, err
+		result, events = event, []Event{event}
+	}
+
+	// Never persist an event that doesn't match the schema
+	for _, event := range events {
+		if err := validateEvent(event); err != nil {
+			return result, nil, fmt.Errorf("%w: %w", errPersistFailed, err)
 		}
-		return cmd, nil
-	default:
-		return nil, nil
 	}
+
+	// Queue behind every earlier command, and apply right away so the next command is
+	// validated against these events even before they are durable
+	queued := &queuedCommand{
+		persisted: s.store.AppendAsync(events),
+		prevTurn:  s.lastTurn,
+		turn:      make(chan struct{}),
+		epoch:     s.stateEpoch,
+	}
+	s.lastTurn = queued.turn
+	s.pending.Add(1)
+	s.appending.Add(1)
+	s.state.ApplyEvents(events)
+	return result, queued, nil
 }
 
-// commandToEvent maps incoming commands to domain events
-func (s *Server) commandToEvent(cmd Command) (Event, error) {
-	switch c := cmd.(type) {
-	case CreateTodoCommand:
-		// If no ID provided, reject (client should send), but we keep as-is
-		if c.ID == "" {
-			return nil, nil
-		}
-		var categoryID *string
-		if c.CategoryID != nil {
-			categoryID = c.CategoryID
-		}
-		sortOrder := s.state.GetHighestSortOrder() + 1000
-		if c.SortOrder != 0 {
-			sortOrder = int(c.SortOrder)
-		}
-		return TodoCreated{
-			Type:       "TodoCreated",
-			ID:         c.ID,
-			Name:       c.Name,
-			CreatedAt:  time.Now().UTC(),
-			SortOrder:  sortOrder,
-			CategoryID: categoryID,
-		}, nil
-	case CategorizeTodoCommand:
-		// Validate category exists if provided
-		if c.CategoryID != nil {
-			if _, ok := s.state.GetCategory(*c.CategoryID); !ok {
-				return nil, fmt.Errorf("category does not exist")
-			}
-		}
-		if _, ok := s.state.GetTodo(c.ID); !ok {
-			return nil, fmt.Errorf("todo not found")
-		}
-		return TodoCategorized{
-			Type:       "TodoCategorized",
-			ID:         c.ID,
-			CategoryID: c.CategoryID,
-		}, nil
-	case CreateCategoryCommand:
-		if c.ID == "" {
-			return nil, fmt.Errorf("missing category id")
-		}
+// awaitTurn waits until a queued command's events are durable and every command queued
+// before it has been published. If the append failed, the state is rebuilt from the store.
+// Returns whether the command's event should be broadcast: not once the state has been
+// rebuilt since it was applied, as clients then got a rollup covering it instead.
+func (s *Server) awaitTurn(queued *queuedCommand) (bool, error) {
+	err := <-queued.persisted
+	s.appending.Done()
+	if queued.prevTurn != nil {
+		<-queued.prevTurn
+	}
 
-		// Check if an active category with this name already exists
-		if s.state.CategoryNameExists(c.Name) {
-			return nil, fmt.Errorf("category with name '%s' already exists", c.Name)
+	// stateEpoch only changes during a turn, so it is stable until this one ends
+	current := queued.epoch == s.stateEpoch
+	if err != nil {
+		if current {
+			s.recoverState()
 		}
+		return false, fmt.Errorf("%w: %w", errPersistFailed, err)
+	}
+	return current, nil
+}
 
-		// Check if there's a deleted category with the same name (case-sensitive)
-		deletedCategoryID := s.state.FindDeletedCategoryByName(c.Name)
+// finishTurn lets the command queued after this one publish its outcome
+func (s *Server) finishTurn(queued *queuedCommand) {
+	close(queued.turn)
+	s.pending.Done()
+}
 
-		// If a deleted category with this name exists, reuse its ID
-		categoryID := c.ID
-		if deletedCategoryID != "" {
-			categoryID = deletedCategoryID
-		}
+// recoverState rebuilds the state from the store after an append failed, undoing the failed
+// events, and sends every client the rebuilt state. Commands queued since were validated
+// against the failed events, so it first waits for all their appends to complete; those that
+// were stored are part of the rollup. Runs in the failed command's turn.
+func (s *Server) recoverState() {
+	s.commandMu.Lock()
+	defer s.commandMu.Unlock()
 
-		sortOrder := s.state.GetHighestCategorySortOrder() + 1000
-		if c.SortOrder != 0 {
-			sortOrder = int(c.SortOrder)
-		}
-		return CategoryCreated{
-			Type:      "CategoryCreated",
-			ID:        categoryID,
-			Name:      c.Name,
-			CreatedAt: time.Now().UTC(),
-			SortOrder: sortOrder,
-		}, nil
-	case RenameCategoryCommand:
-		if _, ok := s.state.GetCategory(c.ID); !ok {
-			return nil, fmt.Errorf("category not found")
-		}
+	s.appending.Wait()
+	events, err := s.store.ReadAll()
+	if err != nil {
+		slog.Error("failed to reload events after a failed append", "error", err)
+		return
+	}
+	s.state.Reset(events)
+	s.stateEpoch++
+	slog.Warn("state rebuilt from the store after a failed append", "event_count", len(events))
 
-		// Check if another category with this name already exists
-		if s.state.CategoryNameExists(c.Name) {
-			// Get the current category to check if it's renaming to itself
-			currentCat, _ := s.state.GetCategory(c.ID)
-			if currentCat.Name != c.Name {
-				return nil, fmt.Errorf("category with name '%s' already exists", c.Name)
-			}
-		}
+	rollupData, err := json.Marshal(s.stateRollup())
+	if err != nil {
+		slog.Error("failed to marshal state rollup", "error", err)
+		return
+	}
+	s.broadcastMessage(rollupData)
+}
 
-		return CategoryRenamed{
-			Type: "CategoryRenamed",
-			ID:   c.ID,
-			Name: c.Name,
-		}, nil
-	case DeleteCategoryCommand:
-		if s.state.CategoryHasTodos(c.ID) {
-			return nil, fmt.Errorf("cannot delete non-empty category")
-		}
-		if _, ok := s.state.GetCategory(c.ID); !ok {
-			return nil, fmt.Errorf("category not found")
-		}
-		return CategoryDeleted{
-			Type: "CategoryDeleted",
-			ID:   c.ID,
-		}, nil
-	case ReorderCategoryCommand:
-		if _, ok := s.state.GetCategory(c.ID); !ok {
-			return nil, fmt.Errorf("category not found")
-		}
-		return CategoryReordered{
-			Type:      "CategoryReordered",
-			ID:        c.ID,
-			SortOrder: int(c.SortOrder),
-		}, nil
-	case CompleteTodoCommand:
-		return TodoCompleted{
-			Type:        "TodoCompleted",
-			ID:          c.ID,
-			CompletedAt: time.Now().UTC(),
-		}, nil
-	case UncompleteTodoCommand:
-		return TodoUncompleted{
-			Type: "TodoUncompleted",
-			ID:   c.ID,
-		}, nil
-	case StarTodoCommand:
-		return TodoStarred{
-			Type:      "TodoStarred",
-			ID:        c.ID,
-			SortOrder: s.state.GetHighestSortOrder() + 1000,
-		}, nil
-	case UnstarTodoCommand:
-		return TodoUnstarred{
-			Type: "TodoUnstarred",
-			ID:   c.ID,
-		}, nil
-	case ReorderTodoCommand:
-		return TodoReordered{
-			Type:      "TodoReordered",
-			ID:        c.ID,
-			SortOrder: int(c.SortOrder),
-		}, nil
-	case RenameTodoCommand:
-		return TodoRenamed{
-			Type: "TodoRenamed",
-			ID:   c.ID,
-			Name: c.Name,
-		}, nil
-	case SetListTitleCommand:
-		return ListTitleChanged{
-			Type:  "ListTitleChanged",
-			Title: c.Title,
-		}, nil
-	default:
-		return nil, nil
+// newCommandResponse builds the response for a command from its execution error
+func newCommandResponse(cmd Command, err error) CommandResponse {
+	response := CommandResponse{
+		Type:      "CommandResponse",
+		CommandID: cmd.GetCommandID(),
+		Success:   err == nil,
+	}
+	if batch, ok := cmd.(BatchCommand); ok {
+		response.Results = batch.results(err)
+	}
+	if err == nil {
+		return response
+	}
+
+	response.Code, response.Params = errorCode(err)
+	response.Error = errorMessage(response.Code, response.Params)
+	var duplicateErr *DuplicateTodoError
+	if errors.As(err, &duplicateErr) {
+		response.Duplicate = &duplicateErr.Existing
+	}
+	return response
+}
+
+// handleAutocompleteRequest checks if the message is an autocomplete request and queues it
+// for the client's autocomplete worker, keeping the read loop free for commands.
+// Returns true if the message was an autocomplete request, false otherwise
+func (s *Server) handleAutocompleteRequest(client *Client, message []byte) bool {
+	var typeCheck struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(message, &typeCheck); err != nil {
+		return false
+	}
+
+	if typeCheck.Type != "AutocompleteRequest" {
+		return false
+	}
+
+	var req AutocompleteRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		slog.Warn("failed to parse autocomplete request", "error", err)
+		return true
+	}
+
+	client.autocomplete.push(req)
+	return true
+}
+
+// ParseCommand validates incoming JSON against the schema and unmarshals it into the correct
+// command type. Commands that don't match the schema return a *ValidationError; unknown
+// command types return a nil command.
+func ParseCommand(data []byte) (Command, error) {
+	if err := validateCommand(data); err != nil {
+		return nil, err
 	}
+	return decodeCommand(data)
+}
+
+// commandToEvent maps incoming commands to domain events
+func (s *Server) commandToEvent(cmd Command) (Event, error) {
+	return convertCommand(s.state, cmd)
 }
 
 // LoadEvents loads events from the store and applies them to the state
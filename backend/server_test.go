@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,10 +24,11 @@ func setupTestServer(t *testing.T) (*Server, *httptest.Server, string) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 
 	server := NewServer(store)
+	useTestHelloTimeout(server)
 
 	// Start the server's event loop in background
 	go server.Run()
@@ -35,12 +41,39 @@ func setupTestServer(t *testing.T) (*Server, *httptest.Server, string) {
 	return server, ts, wsURL
 }
 
-func connectWS(t *testing.T, wsURL string) *websocket.Conn {
+func dialWS(t *testing.T, wsURL string) *websocket.Conn {
 	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	require.NoError(t, err)
 	return conn
 }
 
+// testHelloTimeout is how long test servers wait for a Hello. Silent legacy clients get their
+// rollup once it passes, which takes 2s with the default config.
+const testHelloTimeout = 50 * time.Millisecond
+
+// useTestHelloTimeout lets connectWS clients in after testHelloTimeout
+func useTestHelloTimeout(server *Server) {
+	cfg := DefaultWebSocketConfig()
+	cfg.HelloTimeout = testHelloTimeout
+	server.SetWebSocketConfig(cfg)
+}
+
+// connectWS dials like a legacy client that never sends a Hello, so the server admits it
+// once the hello timeout passes and its rollup is the first message
+func connectWS(t *testing.T, wsURL string) *websocket.Conn {
+	return dialWS(t, wsURL)
+}
+
+// connectWSHello dials and completes the handshake, leaving the rollup as the next message
+func connectWSHello(t *testing.T, wsURL string) *websocket.Conn {
+	conn := dialWS(t, wsURL)
+	require.NoError(t, conn.WriteJSON(Hello{Type: "Hello", ProtocolVersion: currentProtocolVersion}))
+	var welcome Welcome
+	require.NoError(t, conn.ReadJSON(&welcome))
+	require.Equal(t, "Welcome", welcome.Type)
+	return conn
+}
+
 func TestServer_AcceptConnection(t *testing.T) {
 	_, ts, wsURL := setupTestServer(t)
 	defer ts.Close()
@@ -126,15 +159,13 @@ func TestServer_BroadcastEventToAllClients(t *testing.T) {
 	_, ts, wsURL := setupTestServer(t)
 	defer ts.Close()
 
-	// Connect two clients
+	// Connect two clients, one after the other was admitted
 	conn1 := connectWS(t, wsURL)
 	defer conn1.Close()
-	conn2 := connectWS(t, wsURL)
-	defer conn2.Close()
-
-	// Read initial rollups and client counts
 	conn1.ReadMessage() // rollup
 	conn1.ReadMessage() // client count (1)
+	conn2 := connectWS(t, wsURL)
+	defer conn2.Close()
 	conn2.ReadMessage() // rollup
 	conn2.ReadMessage() // client count (2)
 	conn1.ReadMessage() // client count (2) to first client
@@ -248,13 +279,12 @@ func TestServer_HandleClientDisconnect(t *testing.T) {
 	_, ts, wsURL := setupTestServer(t)
 	defer ts.Close()
 
+	// Read rollups and client counts, admitting one client after the other
 	conn1 := connectWS(t, wsURL)
-	conn2 := connectWS(t, wsURL)
-	defer conn2.Close()
-
-	// Read rollups and client counts
 	conn1.ReadMessage() // rollup
 	conn1.ReadMessage() // client count (1)
+	conn2 := connectWS(t, wsURL)
+	defer conn2.Close()
 	conn2.ReadMessage() // rollup
 	conn2.ReadMessage() // client count (2)
 	conn1.ReadMessage() // client count (2) to first client
@@ -338,7 +368,7 @@ func TestServer_LoadExistingEventsOnStart(t *testing.T) {
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
 	// Create store and add events
-	store1, _ := NewEventStore(filePath)
+	store1, _ := NewJSONLStore(filePath)
 	now := time.Now().UTC()
 	store1.Append(TodoCreated{
 		Type:      "TodoCreated",
@@ -350,8 +380,9 @@ func TestServer_LoadExistingEventsOnStart(t *testing.T) {
 	store1.Close()
 
 	// Create new store and server
-	store2, _ := NewEventStore(filePath)
+	store2, _ := NewJSONLStore(filePath)
 	srv := NewServer(store2)
+	useTestHelloTimeout(srv)
 
 	// Load existing events
 	events, _ := store2.ReadAll()
@@ -384,7 +415,7 @@ func TestServer_ServeStaticFiles(t *testing.T) {
 	os.MkdirAll(staticDir, 0o755)
 	os.WriteFile(filepath.Join(staticDir, "index.html"), []byte("<html>test</html>"), 0o644)
 
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	server := NewServer(store)
 
 	mux := http.NewServeMux()
@@ -406,7 +437,7 @@ func TestServer_LoadEvents(t *testing.T) {
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
 	// Create store with some events
-	store1, _ := NewEventStore(filePath)
+	store1, _ := NewJSONLStore(filePath)
 	now := time.Now().UTC()
 	store1.Append(TodoCreated{
 		Type:      "TodoCreated",
@@ -418,7 +449,7 @@ func TestServer_LoadEvents(t *testing.T) {
 	store1.Close()
 
 	// Create new server with existing events
-	store2, _ := NewEventStore(filePath)
+	store2, _ := NewJSONLStore(filePath)
 	defer store2.Close()
 
 	server := NewServer(store2)
@@ -444,7 +475,7 @@ func TestServer_LoadEvents_InvalidStore(t *testing.T) {
 	// Create store with invalid event
 	os.WriteFile(filePath, []byte(`{"type":"UnknownEvent","id":"1"}`), 0o644)
 
-	store, _ := NewEventStore(filePath)
+	store, _ := NewJSONLStore(filePath)
 	defer store.Close()
 
 	server := NewServer(store)
@@ -458,20 +489,18 @@ func TestServer_Run_BroadcastToMultipleClients(t *testing.T) {
 	_, ts, wsURL := setupTestServer(t)
 	defer ts.Close()
 
-	// Connect three clients
+	// Connect three clients, each after the one before was admitted
 	conn1 := connectWS(t, wsURL)
 	defer conn1.Close()
-	conn2 := connectWS(t, wsURL)
-	defer conn2.Close()
-	conn3 := connectWS(t, wsURL)
-	defer conn3.Close()
-
-	// Read initial rollups and client counts
 	conn1.ReadMessage() // rollup
 	conn1.ReadMessage() // client count (1)
+	conn2 := connectWS(t, wsURL)
+	defer conn2.Close()
 	conn2.ReadMessage() // rollup
 	conn2.ReadMessage() // client count (2)
 	conn1.ReadMessage() // client count (2) to first client
+	conn3 := connectWS(t, wsURL)
+	defer conn3.Close()
 	conn3.ReadMessage() // rollup
 	conn3.ReadMessage() // client count (3)
 	conn1.ReadMessage() // client count (3) to first client
@@ -623,15 +652,13 @@ func TestServer_SetListTitle_BroadcastsToAllClients(t *testing.T) {
 	_, ts, wsURL := setupTestServer(t)
 	defer ts.Close()
 
-	// Connect two clients
+	// Connect two clients, one after the other was admitted
 	conn1 := connectWS(t, wsURL)
 	defer conn1.Close()
-	conn2 := connectWS(t, wsURL)
-	defer conn2.Close()
-
-	// Read initial rollups and client counts
 	conn1.ReadMessage() // rollup
 	conn1.ReadMessage() // client count (1)
+	conn2 := connectWS(t, wsURL)
+	defer conn2.Close()
 	conn2.ReadMessage() // rollup
 	conn2.ReadMessage() // client count (2)
 	conn1.ReadMessage() // client count (2) to first client
@@ -666,7 +693,7 @@ func TestServer_SetListTitle_BroadcastsToAllClients(t *testing.T) {
 
 func TestCommandToEvent_DeleteCategoryRejectedWhenNotEmpty(t *testing.T) {
 	tmpDir := t.TempDir()
-	store, err := NewEventStore(filepath.Join(tmpDir, "events.jsonl"))
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
 	require.NoError(t, err)
 	server := NewServer(store)
 
@@ -698,7 +725,7 @@ func TestCommandToEvent_DeleteCategoryRejectedWhenNotEmpty(t *testing.T) {
 
 func TestCommandToEvent_CategorizeRequiresExistingCategory(t *testing.T) {
 	tmpDir := t.TempDir()
-	store, err := NewEventStore(filepath.Join(tmpDir, "events.jsonl"))
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
 	require.NoError(t, err)
 	server := NewServer(store)
 
@@ -1151,3 +1178,475 @@ func TestServer_SendErrorMessageOnDuplicateCategory(t *testing.T) {
 	assert.False(t, response.Success)
 	assert.Contains(t, response.Error, "already exists")
 }
+
+func TestCommandToEvent_AddSynonym(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+
+	event, err := server.commandToEvent(AddSynonymCommand{
+		BaseCommand: BaseCommand{Type: "AddSynonym"},
+		Name:        " Tomat ",
+		Canonical:   "Tomato",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SynonymAdded{Type: "SynonymAdded", Name: "Tomat", Canonical: "Tomato"}, event)
+	server.state.Apply(event)
+
+	// Aliasing onto an alias points at the end of the chain
+	event, err = server.commandToEvent(AddSynonymCommand{
+		BaseCommand: BaseCommand{Type: "AddSynonym"},
+		Name:        "Pomodoro",
+		Canonical:   "tomat",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Tomato", event.(SynonymAdded).Canonical)
+}
+
+func TestCommandToEvent_AddSynonymRejectsInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+	server.state.Apply(SynonymAdded{Type: "SynonymAdded", Name: "tomat", Canonical: "tomato"})
+
+	tests := []struct {
+		name      string
+		alias     string
+		canonical string
+	}{
+		{"empty name", "", "tomato"},
+		{"empty canonical", "tomato", "  "},
+		{"already grouped by stemming", "tomatoes", "tomato"},
+		{"cycle", "tomato", "tomat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := server.commandToEvent(AddSynonymCommand{
+				BaseCommand: BaseCommand{Type: "AddSynonym"},
+				Name:        tt.alias,
+				Canonical:   tt.canonical,
+			})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCommandToEvent_RemoveSynonym(t *testing.T) {
+	tmpDir := t.TempDir()
+	store, err := NewJSONLStore(filepath.Join(tmpDir, "events.jsonl"))
+	require.NoError(t, err)
+	server := NewServer(store)
+
+	_, err = server.commandToEvent(RemoveSynonymCommand{
+		BaseCommand: BaseCommand{Type: "RemoveSynonym"},
+		Name:        "tomat",
+	})
+	assert.Error(t, err)
+
+	server.state.Apply(SynonymAdded{Type: "SynonymAdded", Name: "cherry tomato", Canonical: "tomato"})
+
+	// Matched by normalized key, removed under the stored alias name
+	event, err := server.commandToEvent(RemoveSynonymCommand{
+		BaseCommand: BaseCommand{Type: "RemoveSynonym"},
+		Name:        "Cherry Tomatoes",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SynonymRemoved{Type: "SynonymRemoved", Name: "cherry tomato"}, event)
+}
+
+func TestServer_DuplicateTodoResponseCarriesExistingTodo(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	server.state.Apply(DuplicatePolicyChanged{Type: "DuplicatePolicyChanged", Policy: DuplicatePolicyReject})
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Milk", CreatedAt: time.Now().UTC(), SortOrder: 1000})
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // rollup
+	conn.ReadMessage() // client count
+
+	cmdData, _ := json.Marshal(CreateTodoCommand{
+		BaseCommand: BaseCommand{Type: "CreateTodo", CommandID: "cmd-dup"},
+		ID:          "todo-2",
+		Name:        "milk",
+	})
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, cmdData))
+
+	_, msg, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var response CommandResponse
+	require.NoError(t, json.Unmarshal(msg, &response))
+	assert.False(t, response.Success)
+	assert.Equal(t, "cmd-dup", response.CommandID)
+	require.NotNil(t, response.Duplicate)
+	assert.Equal(t, "todo-1", response.Duplicate.ID)
+	assert.Equal(t, 1, server.state.TodoCount())
+}
+
+// readClientCount reads messages until a ClientCount message arrives
+func readClientCount(t *testing.T, conn *websocket.Conn) int {
+	for {
+		_, msg, err := conn.ReadMessage()
+		require.NoError(t, err)
+		var count ClientCountMessage
+		if json.Unmarshal(msg, &count) == nil && count.Type == "ClientCount" {
+			return count.Count
+		}
+	}
+}
+
+func fastKeepalive() WebSocketConfig {
+	return WebSocketConfig{
+		PingInterval:   20 * time.Millisecond,
+		PongTimeout:    100 * time.Millisecond,
+		WriteTimeout:   100 * time.Millisecond,
+		MaxMessageSize: 1024,
+		HelloTimeout:   testHelloTimeout,
+	}
+}
+
+func TestServer_Keepalive_ReapsSilentConnection(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	server.SetWebSocketConfig(fastKeepalive())
+
+	live := connectWS(t, wsURL)
+	defer live.Close()
+	assert.Equal(t, 1, readClientCount(t, live))
+
+	// A client that never reads never answers pings, like a phone that dropped off Wi-Fi
+	silent := connectWS(t, wsURL)
+	defer silent.Close()
+	assert.Equal(t, 2, readClientCount(t, live))
+
+	// The silent client is reaped and the live one stays connected
+	live.SetReadDeadline(time.Now().Add(2 * time.Second))
+	assert.Equal(t, 1, readClientCount(t, live))
+}
+
+func TestServer_Keepalive_AnsweringClientStaysConnected(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	server.SetWebSocketConfig(fastKeepalive())
+
+	pings := make(chan struct{}, 100)
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.SetPingHandler(func(data string) error {
+		pings <- struct{}{}
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+
+	// Keep reading well past several pong timeouts
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(400 * time.Millisecond)
+
+	assert.GreaterOrEqual(t, len(pings), 5)
+	// Verify through a command that the connection is still alive
+	require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"SetListTitle","commandId":"alive","title":"Still here"}`)))
+	assert.Eventually(t, func() bool {
+		return server.state.GetListTitle() == "Still here"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestServer_Keepalive_RejectsOversizedMessage(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	server.SetWebSocketConfig(fastKeepalive())
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // skip rollup
+	conn.ReadMessage() // skip client count
+
+	title := strings.Repeat("x", 2048)
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"SetListTitle","commandId":"big","title":"`+title+`"}`))
+
+	// The server closes the connection instead of processing the message
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) {
+				assert.False(t, netErr.Timeout(), "connection should be closed, not time out")
+			}
+			break
+		}
+	}
+	assert.Equal(t, "My Todo List", server.state.GetListTitle())
+}
+
+func TestWebSocketConfig_Validate(t *testing.T) {
+	assert.NoError(t, DefaultWebSocketConfig().Validate())
+
+	cfg := DefaultWebSocketConfig()
+	cfg.PongTimeout = cfg.PingInterval
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultWebSocketConfig()
+	cfg.WriteTimeout = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultWebSocketConfig()
+	cfg.MaxMessageSize = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultWebSocketConfig()
+	cfg.HelloTimeout = 0
+	assert.Error(t, cfg.Validate())
+
+	cfg = DefaultWebSocketConfig()
+	cfg.CompressionMinSize = -1
+	assert.Error(t, cfg.Validate())
+}
+
+func TestClient_SendAfterCloseIsSafe(t *testing.T) {
+	client := newClient(nil)
+	assert.True(t, client.send([]byte("first")))
+
+	client.close()
+	client.close() // closing twice is safe
+	assert.False(t, client.send([]byte("late")), "send after close should be dropped")
+
+	// Buffered messages are still delivered before the channel reports closed
+	msg, ok := <-client.sendCh
+	assert.True(t, ok)
+	assert.Equal(t, "first", string(msg.json))
+	_, ok = <-client.sendCh
+	assert.False(t, ok)
+}
+
+func TestServer_SlowClientDroppedWhileStillSending(t *testing.T) {
+	server, ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	// A client nobody drains, as if its network had stalled
+	slow := newClient(nil)
+	server.registerClient(slow)
+
+	// Its read loop keeps answering commands while the hub drops it
+	stopSending := make(chan struct{})
+	sending := make(chan struct{})
+	go func() {
+		defer close(sending)
+		for {
+			select {
+			case <-stopSending:
+				return
+			default:
+				slow.send([]byte(`{"type":"CommandResponse"}`))
+			}
+		}
+	}()
+
+	for i := 0; i < 600; i++ {
+		server.broadcastEvent(ListTitleChanged{Type: "ListTitleChanged", Title: fmt.Sprintf("Title %d", i)})
+	}
+
+	assert.Eventually(t, func() bool {
+		slow.mu.Lock()
+		defer slow.mu.Unlock()
+		return slow.closed
+	}, 2*time.Second, 10*time.Millisecond)
+	close(stopSending)
+	<-sending
+}
+
+func TestServer_StressConcurrentClients(t *testing.T) {
+	if testing.Short() {
+		t.Skip("stress test")
+	}
+
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+	// Generated names are near-duplicates of each other
+	server.state.Apply(DuplicatePolicyChanged{Type: "DuplicatePolicyChanged", Policy: DuplicatePolicyAllow})
+
+	const clients = 200
+	const commandsPerClient = 3
+
+	var ackedMu sync.Mutex
+	var acked []string
+
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer conn.Close()
+
+			for j := 0; j < commandsPerClient; j++ {
+				cmd := fmt.Sprintf(`{"type":"CreateTodo","commandId":"todo-%d-%d","id":"todo-%d-%d","name":"Item %d %d"}`, i, j, i, j, i, j)
+				if err := conn.WriteMessage(websocket.TextMessage, []byte(cmd)); err != nil {
+					// Dropped for falling behind before it got to read
+					return
+				}
+			}
+
+			// Every third client vanishes without waiting for its answers
+			if i%3 == 0 {
+				return
+			}
+
+			// The rest read until their commands are acknowledged
+			conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+			for received := 0; received < commandsPerClient; {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					// Dropped for falling behind, which the hub is allowed to do under load
+					return
+				}
+				var resp CommandResponse
+				if json.Unmarshal(msg, &resp) == nil && resp.Type == "CommandResponse" && strings.HasPrefix(resp.CommandID, fmt.Sprintf("todo-%d-", i)) {
+					assert.True(t, resp.Success, resp.Error)
+					ackedMu.Lock()
+					acked = append(acked, resp.CommandID)
+					ackedMu.Unlock()
+					received++
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Every acknowledged command was applied, and nothing was applied twice
+	for _, id := range acked {
+		_, ok := server.state.GetTodo(id)
+		assert.True(t, ok, "acknowledged todo %s missing", id)
+	}
+	assert.LessOrEqual(t, len(server.state.GetTodos()), clients*commandsPerClient)
+	assert.NotEmpty(t, acked)
+
+	// All clients are gone from the count once a new one connects
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for readClientCount(t, conn) != 1 {
+	}
+}
+
+// failingStore fails appends containing an event matching fail and delegates everything else
+type failingStore struct {
+	EventStore
+	fail func(Event) bool
+}
+
+func (s *failingStore) AppendAsync(events []Event) <-chan error {
+	if slices.ContainsFunc(events, s.fail) {
+		resultCh := make(chan error, 1)
+		resultCh <- errors.New("disk full")
+		return resultCh
+	}
+	return s.EventStore.AppendAsync(events)
+}
+
+func TestServer_ConcurrentCommandsPublishInStoreOrder(t *testing.T) {
+	opts := DefaultStoreOptions()
+	opts.Durability = DurabilityInterval
+	store, err := NewJSONLStoreWithOptions(filepath.Join(t.TempDir(), "events.jsonl"), opts)
+	require.NoError(t, err)
+	defer store.Close()
+	server := NewServer(store) // Not running, so broadcasts stay queued for the test to read
+
+	const commands = 50
+	var wg sync.WaitGroup
+	for i := 0; i < commands; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			cmd := SetListTitleCommand{BaseCommand: BaseCommand{Type: "SetListTitle", CommandID: fmt.Sprint(i)}, Title: fmt.Sprint("List ", i)}
+			_, err := server.handleCommand(cmd, func(response CommandResponse, _ error) {
+				assert.True(t, response.Success)
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, events, commands)
+	for _, stored := range events {
+		var broadcast ListTitleChanged
+		require.NoError(t, json.Unmarshal(<-server.broadcast, &broadcast))
+		assert.Equal(t, stored.(ListTitleChanged).Title, broadcast.Title)
+	}
+	assert.Equal(t, events[commands-1].(ListTitleChanged).Title, server.state.GetListTitle())
+}
+
+func TestServer_FailedAppendRebuildsState(t *testing.T) {
+	jsonl, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+	defer jsonl.Close()
+	store := &failingStore{EventStore: jsonl, fail: func(event Event) bool {
+		changed, ok := event.(ListTitleChanged)
+		return ok && changed.Title == "Lost"
+	}}
+	server := NewServer(store) // Not running, so broadcasts stay queued for the test to read
+
+	setTitle := func(title string) error {
+		cmd := SetListTitleCommand{BaseCommand: BaseCommand{Type: "SetListTitle", CommandID: title}, Title: title}
+		_, err := server.handleCommand(cmd, func(CommandResponse, error) {})
+		return err
+	}
+	require.NoError(t, setTitle("Kept"))
+	<-server.broadcast
+
+	err = setTitle("Lost")
+	assert.ErrorIs(t, err, errPersistFailed)
+	assert.Equal(t, "Kept", server.state.GetListTitle())
+
+	// Clients get the rebuilt state instead of the failed event
+	var rollup StateRollup
+	require.NoError(t, json.Unmarshal(<-server.broadcast, &rollup))
+	assert.Equal(t, "StateRollup", rollup.Type)
+	assert.Equal(t, "Kept", rollup.ListTitle)
+	assert.Empty(t, server.broadcast)
+}
+
+// BenchmarkServer_HandleCommand measures concurrent commands from validation to durable
+// storage, in each durability mode, so store group commit is measured on the command path.
+// Run on the target device to compare: go test -run '^$' -bench Server_HandleCommand
+func BenchmarkServer_HandleCommand(b *testing.B) {
+	for _, mode := range []DurabilityMode{DurabilityAlways, DurabilityBatch, DurabilityInterval} {
+		b.Run(string(mode), func(b *testing.B) {
+			opts := DefaultStoreOptions()
+			opts.Durability = mode
+			store, err := NewJSONLStoreWithOptions(filepath.Join(b.TempDir(), "events.jsonl"), opts)
+			require.NoError(b, err)
+			defer store.Close()
+			server := NewServer(store)
+			go server.Run()
+			defer server.Shutdown(context.Background())
+
+			cmd := SetListTitleCommand{BaseCommand: BaseCommand{Type: "SetListTitle", CommandID: "bench"}, Title: "Groceries"}
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := server.handleCommand(cmd, func(CommandResponse, error) {}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
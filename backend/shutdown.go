@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/gorilla/websocket"
+)
+
+// errShuttingDown is reported for commands received after shutdown has started
+var errShuttingDown = errors.New("server is shutting down")
+
+// serverRestartingClose is the close frame sent to WebSocket clients on shutdown
+var serverRestartingClose = websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting")
+
+// Shutdown drains the server: it rejects new commands and waits for those in flight to be
+// persisted, then stops Run and closes every WebSocket (with a "server restarting" close frame)
+// and SSE stream. Returns the context's error if draining doesn't finish in time.
+// The HTTP listener should already be shutting down so no new connections arrive;
+// the store can be closed once Shutdown returns.
+func (s *Server) Shutdown(ctx context.Context) error {
+	// Reject new commands and wait for those in flight, including their store writes
+	drained := make(chan struct{})
+	go func() {
+		s.commandMu.Lock()
+		s.draining = true
+		s.commandMu.Unlock()
+		s.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		slog.Info("pending commands finished")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Stop the event loop and close all connections
+	s.stopMu.Lock()
+	if !s.stopping {
+		s.stopping = true
+		close(s.stop)
+	}
+	s.stopMu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		<-s.stopped
+		s.connections.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		slog.Info("all connections closed")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// trackConnection counts a new WebSocket or SSE connection towards those Shutdown waits for.
+// Returns false if the server is shutting down and the connection should be refused.
+func (s *Server) trackConnection() bool {
+	s.stopMu.Lock()
+	defer s.stopMu.Unlock()
+
+	if s.stopping {
+		return false
+	}
+	s.connections.Add(1)
+	return true
+}
+
+// registerClient hands a new client to Run, unless Run has already stopped
+func (s *Server) registerClient(client *Client) {
+	select {
+	case s.register <- client:
+	case <-s.stopped:
+	}
+}
+
+// unregisterClient removes a client from Run, unless Run has already stopped
+func (s *Server) unregisterClient(client *Client) {
+	select {
+	case s.unregister <- client:
+	case <-s.stopped:
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdown_SendsRestartCloseFrame(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+	conn.ReadMessage() // skip rollup
+	conn.ReadMessage() // skip client count
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	require.True(t, errors.As(err, &closeErr), "expected close frame, got %v", err)
+	assert.Equal(t, websocket.CloseServiceRestart, closeErr.Code)
+	assert.Equal(t, "server restarting", closeErr.Text)
+
+	// Run has stopped
+	select {
+	case <-server.stopped:
+	default:
+		t.Fatal("Run should have stopped")
+	}
+}
+
+func TestShutdown_RejectsNewConnectionsAndCommands(t *testing.T) {
+	server, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	require.NoError(t, server.Shutdown(context.Background()))
+
+	conn := dialWS(t, wsURL)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseServiceRestart), "got %v", err)
+
+	cmd := SetListTitleCommand{BaseCommand: BaseCommand{Type: "SetListTitle", CommandID: "late"}, Title: "Too late"}
+	_, _, err = server.executeCommand(cmd)
+	assert.ErrorIs(t, err, errShuttingDown)
+	assert.Equal(t, http.StatusServiceUnavailable, commandErrorStatus(err))
+	assert.Equal(t, "My Todo List", server.state.GetListTitle())
+}
+
+func TestShutdown_WaitsForCommandInFlight(t *testing.T) {
+	server, ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	// Simulate a command that is still being persisted
+	server.commandMu.Lock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while a command was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.commandMu.Unlock()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not finish after the command completed")
+	}
+}
+
+func TestShutdown_TimesOut(t *testing.T) {
+	server, ts, _ := setupTestServer(t)
+	defer ts.Close()
+
+	server.commandMu.Lock()
+	defer server.commandMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, server.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestShutdown_EndsSSEStreams(t *testing.T) {
+	server, ts := setupTestSSE(t, nil)
+
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	stream.session(t)
+
+	require.NoError(t, server.Shutdown(context.Background()))
+
+	// The stream ends after any messages already queued
+	for stream.scanner.Scan() {
+	}
+	assert.NoError(t, stream.scanner.Err())
+}
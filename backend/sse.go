@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAliveInterval is how often an idle SSE stream gets a comment line,
+// so proxies and captive portals don't time out the connection
+const sseKeepAliveInterval = 15 * time.Second
+
+// SSESession is sent as the first "session" event of an SSE stream. Clients pass the
+// session ID when posting messages so responses are delivered on their stream.
+type SSESession struct {
+	SessionID string `json:"sessionId"`
+}
+
+// RegisterSSE registers the Server-Sent Events fallback transport under the given path prefix,
+// for networks that break WebSocket upgrades:
+//
+//	GET  <prefix>sse?protocolVersion=<n>    stream of the same messages a WebSocket client receives
+//	POST <prefix>sse/messages?session=<id>  send a command or autocomplete request, as over the WebSocket
+func (s *Server) RegisterSSE(mux *http.ServeMux, prefix string) {
+	mux.HandleFunc("GET "+prefix+"sse", s.HandleSSE)
+	mux.HandleFunc("POST "+prefix+"sse/messages", s.HandleSSEMessage)
+}
+
+// HandleSSE streams the state rollup, events and client counts to an SSE client.
+// The stream starts before the client can post, so the protocolVersion query parameter
+// stands in for the Hello; without it the client is treated as legacy.
+func (s *Server) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	slog.Info("new sse connection", connectionLogAttrs(r)...)
+
+	clientVersion, sentHello := legacyProtocolVersion, false
+	if param := r.URL.Query().Get("protocolVersion"); param != "" {
+		v, err := strconv.Atoi(param)
+		if err != nil || v < 1 {
+			http.Error(w, "invalid protocolVersion", http.StatusBadRequest)
+			return
+		}
+		clientVersion, sentHello = v, true
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	if !s.trackConnection() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.connections.Done()
+
+	client := newClient(nil)
+	sessionID := rand.Text()
+
+	s.sseMu.Lock()
+	s.sseClients[sessionID] = client
+	s.sseMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+
+	sessionData, _ := json.Marshal(SSESession{SessionID: sessionID})
+	if err := writeSSE(w, "session", sessionData); err != nil {
+		s.closeSSE(sessionID, client, false)
+		return
+	}
+	flusher.Flush()
+
+	reply, accepted := s.negotiate(clientVersion)
+	if !accepted {
+		slog.Info("rejecting client with outdated protocol", "protocol_version", clientVersion, "min_protocol_version", s.minProtocol)
+		writeSSE(w, "", reply)
+		flusher.Flush()
+		s.closeSSE(sessionID, client, false)
+		return
+	}
+	if sentHello {
+		// Queued before registering, so it precedes the rollup
+		client.send(reply)
+	}
+	s.registerClient(client)
+
+	go s.autocompletePump(client)
+	defer s.closeSSE(sessionID, client, true)
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-s.stop:
+			// Shutting down; EventSource reconnects on its own
+			return
+
+		case message, ok := <-client.sendCh:
+			if !ok {
+				// Dropped by the server, e.g. because it fell behind
+				return
+			}
+			if err := writeSSE(w, "", message.json); err != nil {
+				slog.Error("error writing sse message", "error", err)
+				return
+			}
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// closeSSE removes an SSE session once its stream ends, so later posts get a 404
+func (s *Server) closeSSE(sessionID string, client *Client, registered bool) {
+	s.sseMu.Lock()
+	delete(s.sseClients, sessionID)
+	s.sseMu.Unlock()
+
+	if !registered {
+		return
+	}
+
+	client.autocomplete.stop()
+	<-client.autocomplete.exited
+	s.unregisterClient(client)
+	slog.Info("sse connection closed")
+}
+
+// HandleSSEMessage handles a message posted by an SSE client. The message is processed exactly
+// like one received over a WebSocket; responses are delivered on the client's stream.
+func (s *Server) HandleSSEMessage(w http.ResponseWriter, r *http.Request) {
+	message, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, APIError{Error: "request body too large"})
+		return
+	}
+
+	s.sseMu.RLock()
+	client, ok := s.sseClients[r.URL.Query().Get("session")]
+	s.sseMu.RUnlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, APIError{Error: "unknown sse session"})
+		return
+	}
+
+	if err := s.handleClientMessage(client, message); err != nil {
+		slog.Warn("invalid message received", "error", err, "message", string(message))
+		writeJSON(w, http.StatusBadRequest, APIError{Error: "invalid message: " + err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// writeSSE writes one SSE message with an optional event name.
+// JSON never contains raw newlines, so each message fits on a single data line.
+func writeSSE(w io.Writer, event string, data []byte) error {
+	if event != "" {
+		if _, err := fmt.Fprintf(w, "event: %s\n", event); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseMessage is one message read from an SSE stream
+type sseMessage struct {
+	event string
+	data  string
+}
+
+// sseStream reads messages from an open SSE response
+type sseStream struct {
+	resp    *http.Response
+	scanner *bufio.Scanner
+}
+
+func setupTestSSE(t *testing.T, wrap func(http.Handler) http.Handler) (*Server, *httptest.Server) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+
+	server := NewServer(store)
+	go server.Run()
+
+	mux := http.NewServeMux()
+	server.RegisterSSE(mux, "/secret/")
+
+	var handler http.Handler = mux
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return server, ts
+}
+
+func openSSE(t *testing.T, url string) *sseStream {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	t.Cleanup(func() { resp.Body.Close() })
+	return &sseStream{resp: resp, scanner: bufio.NewScanner(resp.Body)}
+}
+
+// next returns the next message, skipping keep-alive comments
+func (s *sseStream) next(t *testing.T) sseMessage {
+	var msg sseMessage
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "":
+			if msg.data != "" {
+				return msg
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("sse stream ended: %v", s.scanner.Err())
+	return msg
+}
+
+// nextOfType returns the next message with the given JSON type
+func (s *sseStream) nextOfType(t *testing.T, msgType string) string {
+	for {
+		msg := s.next(t)
+		var typeCheck struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(msg.data), &typeCheck)
+		if typeCheck.Type == msgType {
+			return msg.data
+		}
+	}
+}
+
+// session reads the session event and the initial state rollup
+func (s *sseStream) session(t *testing.T) (string, StateRollup) {
+	msg := s.next(t)
+	require.Equal(t, "session", msg.event)
+	var session SSESession
+	require.NoError(t, json.Unmarshal([]byte(msg.data), &session))
+	require.NotEmpty(t, session.SessionID)
+
+	var rollup StateRollup
+	require.NoError(t, json.Unmarshal([]byte(s.next(t).data), &rollup))
+	require.Equal(t, "StateRollup", rollup.Type)
+	return session.SessionID, rollup
+}
+
+func postSSE(t *testing.T, ts *httptest.Server, sessionID, body string) int {
+	resp, err := http.Post(ts.URL+"/secret/sse/messages?session="+sessionID, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSSE_StreamSendsRollupAndClientCount(t *testing.T) {
+	_, ts := setupTestSSE(t, nil)
+
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	_, rollup := stream.session(t)
+	assert.Equal(t, "My Todo List", rollup.ListTitle)
+
+	var count ClientCountMessage
+	require.NoError(t, json.Unmarshal([]byte(stream.nextOfType(t, "ClientCount")), &count))
+	assert.Equal(t, 1, count.Count)
+}
+
+func TestSSE_ProtocolVersionGetsWelcome(t *testing.T) {
+	_, ts := setupTestSSE(t, nil)
+
+	stream := openSSE(t, ts.URL+"/secret/sse?protocolVersion=2")
+	require.Equal(t, "session", stream.next(t).event)
+
+	var welcome Welcome
+	require.NoError(t, json.Unmarshal([]byte(stream.next(t).data), &welcome))
+	assert.Equal(t, "Welcome", welcome.Type)
+	assert.Equal(t, currentProtocolVersion, welcome.ProtocolVersion)
+
+	var rollup StateRollup
+	require.NoError(t, json.Unmarshal([]byte(stream.next(t).data), &rollup))
+	assert.Equal(t, "StateRollup", rollup.Type)
+}
+
+func TestSSE_TooOldClientMustReload(t *testing.T) {
+	server, ts := setupTestSSE(t, nil)
+	require.NoError(t, server.SetMinProtocolVersion(2))
+
+	for _, url := range []string{"/secret/sse?protocolVersion=1", "/secret/sse"} {
+		stream := openSSE(t, ts.URL+url)
+		require.Equal(t, "session", stream.next(t).event)
+
+		var reload ReloadRequired
+		require.NoError(t, json.Unmarshal([]byte(stream.next(t).data), &reload))
+		assert.Equal(t, "ReloadRequired", reload.Type, url)
+		assert.Equal(t, ErrorCodeClientTooOld, reload.Code, url)
+		assert.False(t, stream.scanner.Scan(), "stream should end for %s", url)
+	}
+
+	resp, err := http.Get(ts.URL + "/secret/sse?protocolVersion=latest")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSSE_PostedCommandIsAnsweredAndBroadcast(t *testing.T) {
+	_, ts := setupTestSSE(t, nil)
+
+	sender := openSSE(t, ts.URL+"/secret/sse")
+	sessionID, _ := sender.session(t)
+	other := openSSE(t, ts.URL+"/secret/sse")
+	other.session(t)
+
+	status := postSSE(t, ts, sessionID, `{"type":"SetListTitle","commandId":"sse-1","title":"Weekend"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+
+	var cmdResp CommandResponse
+	require.NoError(t, json.Unmarshal([]byte(sender.nextOfType(t, "CommandResponse")), &cmdResp))
+	assert.Equal(t, "sse-1", cmdResp.CommandID)
+	assert.True(t, cmdResp.Success)
+
+	for _, stream := range []*sseStream{sender, other} {
+		var event ListTitleChanged
+		require.NoError(t, json.Unmarshal([]byte(stream.nextOfType(t, "ListTitleChanged")), &event))
+		assert.Equal(t, "Weekend", event.Title)
+	}
+}
+
+func TestSSE_PostedAutocompleteRequest(t *testing.T) {
+	server, ts := setupTestSSE(t, nil)
+	server.state.Apply(TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Bread", CreatedAt: time.Now().UTC()})
+	server.state.Apply(TodoCompleted{Type: "TodoCompleted", ID: "todo-1", CompletedAt: time.Now().UTC()})
+
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	sessionID, _ := stream.session(t)
+
+	status := postSSE(t, ts, sessionID, `{"type":"AutocompleteRequest","query":"bre","requestId":"ac-1"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+
+	var acResp AutocompleteResponse
+	require.NoError(t, json.Unmarshal([]byte(stream.nextOfType(t, "AutocompleteResponse")), &acResp))
+	assert.Equal(t, "ac-1", acResp.RequestID)
+	require.Len(t, acResp.Suggestions, 1)
+	assert.Equal(t, "Bread", acResp.Suggestions[0].Name)
+}
+
+func TestSSE_RejectUnknownSessionAndMalformedMessage(t *testing.T) {
+	_, ts := setupTestSSE(t, nil)
+
+	assert.Equal(t, http.StatusNotFound, postSSE(t, ts, "nope", `{"type":"SetListTitle","commandId":"x","title":"t"}`))
+
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	sessionID, _ := stream.session(t)
+	assert.Equal(t, http.StatusBadRequest, postSSE(t, ts, sessionID, `not json`))
+	assert.Equal(t, http.StatusBadRequest, postSSE(t, ts, sessionID, `{"type":"NoSuchCommand"}`))
+}
+
+func TestSSE_DisconnectRemovesSession(t *testing.T) {
+	server, ts := setupTestSSE(t, nil)
+
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	sessionID, _ := stream.session(t)
+	stream.resp.Body.Close()
+
+	assert.Eventually(t, func() bool {
+		server.sseMu.RLock()
+		defer server.sseMu.RUnlock()
+		return len(server.sseClients) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, postSSE(t, ts, sessionID, `{"type":"SetListTitle","commandId":"x","title":"t"}`))
+}
+
+func TestSSE_HonoursIPWhitelist(t *testing.T) {
+	_, ts := setupTestSSE(t, func(next http.Handler) http.Handler {
+		return IPWhitelistMiddleware([]string{"10.0.0.0/8"}, "secret", 0, next)
+	})
+
+	// Secret path is reachable from anywhere
+	stream := openSSE(t, ts.URL+"/secret/sse")
+	stream.session(t)
+
+	// Without the secret, a non-whitelisted client gets nothing
+	resp, err := http.Get(ts.URL + "/sse")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
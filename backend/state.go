@@ -1,6 +1,8 @@
 package main
 
 import (
+	"maps"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -13,9 +15,25 @@ type State struct {
 	categories        map[string]*Category
 	deletedCategories map[string]string // Maps deleted category IDs to their names (case-sensitive)
 	listTitle         string
+	duplicatePolicy   string
 	nameFrequency     map[string]int     // Tracks frequency of todo names (case-insensitive key -> count)
 	nameCanonical     map[string]string  // Maps lowercase name to most recent casing
 	nameLastCategory  map[string]*string // Tracks last categoryId used for a name (lowercase)
+	nameLastSeen      map[string]int     // Maps lowercase name to the clock value of its last use
+	nameCategorySeen  map[string]int     // Maps lowercase name to the clock value of its last category assignment
+	nameClock         int                // Monotonic counter ordering name usage across variants
+	synonyms          map[string]Synonym // Maps normalized alias key to its synonym entry
+	pinnedNames       map[string]string  // Maps normalized key to a pinned name as it was pinned
+	normalizer        *NameNormalizer
+}
+
+// NameGroup is a set of historical todo names that normalize to the same key
+type NameGroup struct {
+	Key        string
+	Display    string   // Most recently used casing within the group
+	Variants   []string // Canonical casing of every lowercase variant in the group
+	Frequency  int
+	CategoryID *string // Most recent category assignment within the group
 }
 
 // NewState creates a new empty state
@@ -25,9 +43,41 @@ func NewState() *State {
 		categories:        make(map[string]*Category),
 		deletedCategories: make(map[string]string),
 		listTitle:         "My Todo List",
+		duplicatePolicy:   defaultDuplicatePolicy,
 		nameFrequency:     make(map[string]int),
 		nameCanonical:     make(map[string]string),
 		nameLastCategory:  make(map[string]*string),
+		nameLastSeen:      make(map[string]int),
+		nameCategorySeen:  make(map[string]int),
+		synonyms:          make(map[string]Synonym),
+		pinnedNames:       make(map[string]string),
+		normalizer:        NewNameNormalizer(defaultNameLanguages...),
+	}
+}
+
+// SetNormalizer replaces the normalizer used to group names.
+// Name history is grouped on read, but synonyms and pinned names are keyed when their
+// events are applied, so they are re-keyed here. Entries that collapse onto the same key
+// under the new normalizer keep the one with the greatest name, so the result doesn't
+// depend on map order.
+func (s *State) SetNormalizer(normalizer *NameNormalizer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.normalizer = normalizer
+
+	synonyms := slices.SortedFunc(maps.Values(s.synonyms), func(a, b Synonym) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	clear(s.synonyms)
+	for _, synonym := range synonyms {
+		s.synonyms[normalizer.Key(synonym.Name)] = synonym
+	}
+
+	pinned := slices.Sorted(maps.Values(s.pinnedNames))
+	clear(s.pinnedNames)
+	for _, name := range pinned {
+		s.pinnedNames[normalizer.Key(name)] = name
 	}
 }
 
@@ -39,91 +89,11 @@ func (s *State) Apply(event Event) {
 	s.applyEvent(event)
 }
 
-// applyEvent applies a single event without locking (internal use only)
+// applyEvent applies a single event without locking (internal use only).
+// Events without a registered projector leave the state unchanged.
 func (s *State) applyEvent(event Event) {
-	switch e := event.(type) {
-	case TodoCreated:
-		s.todos[e.ID] = &Todo{
-			ID:         e.ID,
-			Name:       e.Name,
-			CreatedAt:  e.CreatedAt,
-			SortOrder:  e.SortOrder,
-			Starred:    false,
-			CategoryID: e.CategoryID,
-		}
-		// Track name frequency for autocomplete
-		s.trackNameFrequency(e.Name)
-		s.trackLastCategory(e.Name, e.CategoryID)
-
-	case TodoCompleted:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.CompletedAt = &e.CompletedAt
-		}
-
-	case TodoUncompleted:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.CompletedAt = nil
-		}
-
-	case TodoStarred:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.Starred = true
-			todo.SortOrder = e.SortOrder
-		}
-
-	case TodoUnstarred:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.Starred = false
-		}
-
-	case TodoReordered:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.SortOrder = e.SortOrder
-		}
-
-	case TodoRenamed:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.Name = e.Name
-			// Track name frequency for autocomplete
-			s.trackNameFrequency(e.Name)
-			s.trackLastCategory(e.Name, todo.CategoryID)
-		}
-
-	case ListTitleChanged:
-		s.listTitle = e.Title
-
-	case TodoCategorized:
-		if todo, ok := s.todos[e.ID]; ok {
-			todo.CategoryID = e.CategoryID
-			s.trackLastCategory(todo.Name, e.CategoryID)
-		}
-
-	case CategoryCreated:
-		s.categories[e.ID] = &Category{
-			ID:        e.ID,
-			Name:      e.Name,
-			CreatedAt: e.CreatedAt,
-			SortOrder: e.SortOrder,
-		}
-		// Remove from deleted categories if it was deleted before
-		delete(s.deletedCategories, e.ID)
-
-	case CategoryRenamed:
-		if cat, ok := s.categories[e.ID]; ok {
-			cat.Name = e.Name
-		}
-
-	case CategoryDeleted:
-		// Before deleting, store the category name for potential reuse
-		if cat, ok := s.categories[e.ID]; ok {
-			s.deletedCategories[e.ID] = cat.Name
-		}
-		delete(s.categories, e.ID)
-
-	case CategoryReordered:
-		if cat, ok := s.categories[e.ID]; ok {
-			cat.SortOrder = e.SortOrder
-		}
+	if handler, ok := eventHandlers[event.EventType()]; ok && handler.project != nil {
+		handler.project(s, event)
 	}
 }
 
@@ -133,11 +103,15 @@ func (s *State) trackNameFrequency(name string) {
 	s.nameFrequency[nameLower]++
 	// Always update canonical to most recent casing
 	s.nameCanonical[nameLower] = name
+	s.nameClock++
+	s.nameLastSeen[nameLower] = s.nameClock
 }
 
 // trackLastCategory remembers the most recent category assignment for a name
 func (s *State) trackLastCategory(name string, categoryID *string) {
 	nameLower := strings.ToLower(name)
+	s.nameClock++
+	s.nameCategorySeen[nameLower] = s.nameClock
 	if categoryID == nil {
 		s.nameLastCategory[nameLower] = nil
 		return
@@ -157,6 +131,66 @@ func (s *State) ApplyEvents(events []Event) {
 	}
 }
 
+// Reset replaces the state with the projection of events, keeping the normalizer
+func (s *State) Reset(events []Event) {
+	fresh := NewState()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fresh.normalizer = s.normalizer
+	for _, event := range events {
+		fresh.applyEvent(event)
+	}
+
+	s.todos = fresh.todos
+	s.categories = fresh.categories
+	s.deletedCategories = fresh.deletedCategories
+	s.listTitle = fresh.listTitle
+	s.duplicatePolicy = fresh.duplicatePolicy
+	s.nameFrequency = fresh.nameFrequency
+	s.nameCanonical = fresh.nameCanonical
+	s.nameLastCategory = fresh.nameLastCategory
+	s.nameLastSeen = fresh.nameLastSeen
+	s.nameCategorySeen = fresh.nameCategorySeen
+	s.nameClock = fresh.nameClock
+	s.synonyms = fresh.synonyms
+	s.pinnedNames = fresh.pinnedNames
+}
+
+// clone returns a deep copy of the state, for validating commands against
+// the effects of earlier ones without touching the live state
+func (s *State) clone() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := &State{
+		todos:             make(map[string]*Todo, len(s.todos)),
+		categories:        make(map[string]*Category, len(s.categories)),
+		deletedCategories: maps.Clone(s.deletedCategories),
+		listTitle:         s.listTitle,
+		duplicatePolicy:   s.duplicatePolicy,
+		nameFrequency:     maps.Clone(s.nameFrequency),
+		nameCanonical:     maps.Clone(s.nameCanonical),
+		nameLastCategory:  maps.Clone(s.nameLastCategory), // Pointees are never modified
+		nameLastSeen:      maps.Clone(s.nameLastSeen),
+		nameCategorySeen:  maps.Clone(s.nameCategorySeen),
+		nameClock:         s.nameClock,
+		synonyms:          maps.Clone(s.synonyms),
+		pinnedNames:       maps.Clone(s.pinnedNames),
+		normalizer:        s.normalizer,
+	}
+	for id, todo := range s.todos {
+		todoCopy := *todo
+		c.todos[id] = &todoCopy
+	}
+	for id, cat := range s.categories {
+		catCopy := *cat
+		c.categories[id] = &catCopy
+	}
+	return c
+}
+
 // GetTodos returns all todos sorted by sortOrder (descending - highest first)
 func (s *State) GetTodos() []Todo {
 	s.mu.RLock()
@@ -260,19 +294,120 @@ func (s *State) GetCategory(id string) (*Category, bool) {
 	return cat, true
 }
 
-// GetNameFrequency returns a map of todo names (canonical casing) to their frequency count
+// IsCategoryDeleted returns true if the category existed and was deleted
+func (s *State) IsCategoryDeleted(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.deletedCategories[id]
+	return ok
+}
+
+// GetNameFrequency returns a map of todo names (canonical casing) to their frequency count.
+// Names that normalize to the same key are grouped under the most recently used casing.
 func (s *State) GetNameFrequency() map[string]int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	result := make(map[string]int)
+	for _, group := range s.nameGroups() {
+		result[group.Display] = group.Frequency
+	}
+	return result
+}
+
+// GetNameGroups returns the todo name history grouped by normalized key
+func (s *State) GetNameGroups() []NameGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.nameGroups()
+}
+
+// nameGroups groups the tracked names by normalized key without locking (internal use only)
+func (s *State) nameGroups() []NameGroup {
+	groups := make(map[string]*NameGroup)
+	displaySeen := make(map[string]int)
+	categorySeen := make(map[string]int)
+
 	for nameLower, count := range s.nameFrequency {
+		key := s.nameKey(nameLower)
+		group, ok := groups[key]
+		if !ok {
+			group = &NameGroup{Key: key}
+			groups[key] = group
+		}
 		canonicalName := s.nameCanonical[nameLower]
-		result[canonicalName] = count
+		group.Frequency += count
+		group.Variants = append(group.Variants, canonicalName)
+
+		if seen := s.nameLastSeen[nameLower]; group.Display == "" || seen > displaySeen[key] {
+			group.Display = canonicalName
+			displaySeen[key] = seen
+		}
+		if seen, ok := s.nameCategorySeen[nameLower]; ok && seen > categorySeen[key] {
+			group.CategoryID = s.nameLastCategory[nameLower]
+			categorySeen[key] = seen
+		}
+	}
+
+	result := make([]NameGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.Variants)
+		result = append(result, *group)
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
 	return result
 }
 
+// NameKey returns the normalized grouping key for a name, resolving synonyms
+func (s *State) NameKey(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.nameKey(name)
+}
+
+// nameKey resolves a name to its grouping key without locking (internal use only).
+// Synonym chains are followed at most len(synonyms) steps so a cycle can never hang.
+func (s *State) nameKey(name string) string {
+	key := s.normalizer.Key(name)
+	for range len(s.synonyms) {
+		synonym, ok := s.synonyms[key]
+		if !ok {
+			break
+		}
+		key = s.normalizer.Key(synonym.Canonical)
+	}
+	return key
+}
+
+// GetSynonyms returns all synonyms sorted by alias name
+func (s *State) GetSynonyms() []Synonym {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	synonyms := make([]Synonym, 0, len(s.synonyms))
+	for _, synonym := range s.synonyms {
+		synonyms = append(synonyms, synonym)
+	}
+	sort.Slice(synonyms, func(i, j int) bool {
+		return synonyms[i].Name < synonyms[j].Name
+	})
+	return synonyms
+}
+
+// GetSynonym returns the synonym registered for an alias name (matched by normalized key)
+func (s *State) GetSynonym(name string) (Synonym, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	synonym, ok := s.synonyms[s.normalizer.Key(name)]
+	return synonym, ok
+}
+
 // GetActiveTodoNames returns the names of all active (not completed) todos
 func (s *State) GetActiveTodoNames() []string {
 	s.mu.RLock()
@@ -300,12 +435,22 @@ func (s *State) CategoryHasTodos(categoryID string) bool {
 	return false
 }
 
-// GetLastCategoryForName returns the last category used for a given name (if any)
+// GetLastCategoryForName returns the last category used for a given name (if any).
+// All names in the same normalized group share their most recent category.
 func (s *State) GetLastCategoryForName(name string) *string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.nameLastCategory[strings.ToLower(name)]
+	key := s.nameKey(name)
+	var categoryID *string
+	latest := 0
+	for nameLower, seen := range s.nameCategorySeen {
+		if seen > latest && s.nameKey(nameLower) == key {
+			categoryID = s.nameLastCategory[nameLower]
+			latest = seen
+		}
+	}
+	return categoryID
 }
 
 // FindDeletedCategoryByName returns the ID of a deleted category with the given name (case-sensitive)
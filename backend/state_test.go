@@ -595,3 +595,75 @@ func TestState_CategoryNameExists(t *testing.T) {
 	// After deletion, should not exist anymore
 	assert.False(t, state.CategoryNameExists("Work"))
 }
+
+func TestState_NameFrequencyGroupsPluralsAndCase(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "tomato", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Tomatoes", CreatedAt: now, SortOrder: 2000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "3", Name: "Tomato", CreatedAt: now, SortOrder: 3000})
+
+	freq := state.GetNameFrequency()
+
+	// Grouped under the most recently used casing
+	assert.Equal(t, map[string]int{"Tomato": 3}, freq)
+}
+
+func TestState_SynonymsGroupNames(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+	catID := "cat-1"
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Tomatoes", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Tomater", CreatedAt: now, SortOrder: 2000, CategoryID: &catID})
+
+	// Without a synonym, the Swedish and English names are separate
+	assert.Len(t, state.GetNameFrequency(), 2)
+
+	state.Apply(SynonymAdded{Type: "SynonymAdded", Name: "tomater", Canonical: "tomato"})
+
+	assert.Equal(t, map[string]int{"Tomater": 2}, state.GetNameFrequency())
+	assert.Equal(t, state.NameKey("tomato"), state.NameKey("Tomater"))
+	require.NotNil(t, state.GetLastCategoryForName("tomatoes"))
+	assert.Equal(t, catID, *state.GetLastCategoryForName("tomatoes"))
+	assert.Equal(t, []Synonym{{Name: "tomater", Canonical: "tomato"}}, state.GetSynonyms())
+
+	state.Apply(SynonymRemoved{Type: "SynonymRemoved", Name: "Tomater"})
+
+	assert.Len(t, state.GetNameFrequency(), 2)
+	assert.Empty(t, state.GetSynonyms())
+}
+
+func TestState_SetNormalizerRegroupsHistory(t *testing.T) {
+	state := NewState()
+	state.SetNormalizer(NewNameNormalizer("sv"))
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Tomat", CreatedAt: now, SortOrder: 1000})
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "2", Name: "Tomater", CreatedAt: now, SortOrder: 2000})
+	assert.Len(t, state.GetNameFrequency(), 1)
+
+	state.SetNormalizer(NewNameNormalizer("en"))
+	assert.Len(t, state.GetNameFrequency(), 2)
+}
+
+func TestState_SetNormalizerRekeysSynonymsAndPins(t *testing.T) {
+	state := NewState()
+	now := time.Now().UTC()
+
+	state.Apply(TodoCreated{Type: "TodoCreated", ID: "1", Name: "Tomatoes", CreatedAt: now, SortOrder: 1000})
+	state.Apply(SynonymAdded{Type: "SynonymAdded", Name: "Cherry tomatoes", Canonical: "Tomatoes"})
+	state.Apply(NamePinned{Type: "NamePinned", Name: "Tomatoes"})
+
+	state.SetNormalizer(NewNameNormalizer("en"))
+
+	synonym, ok := state.GetSynonym("cherry tomato")
+	assert.True(t, ok, "synonyms are found under keys of the new normalizer")
+	assert.Equal(t, "Cherry tomatoes", synonym.Name)
+	assert.Equal(t, state.NameKey("Tomatoes"), state.NameKey("Cherry tomato"))
+	assert.Equal(t, []string{"Tomatoes"}, state.GetPinnedNames())
+
+	state.Apply(NameUnpinned{Type: "NameUnpinned", Name: "tomato"})
+	assert.Empty(t, state.GetPinnedNames(), "pins are found under keys of the new normalizer")
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storeBackends opens each EventStore implementation at a path, for the conformance suite
+var storeBackends = map[StoreBackend]func(path string, opts StoreOptions) (EventStore, error){
+	StoreBackendJSONL: func(path string, opts StoreOptions) (EventStore, error) { return NewJSONLStoreWithOptions(path, opts) },
+	StoreBackendBolt:  func(path string, opts StoreOptions) (EventStore, error) { return NewBoltStoreWithOptions(path, opts) },
+}
+
+func createdEvent(i int) TodoCreated {
+	return TodoCreated{
+		Type:      "TodoCreated",
+		ID:        fmt.Sprintf("todo-%d", i),
+		Name:      fmt.Sprintf("Item %d", i),
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+		SortOrder: i,
+	}
+}
+
+func eventIDs(events []Event) []string {
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.GetID()
+	}
+	return ids
+}
+
+// TestEventStore_Conformance runs the behaviour every EventStore must share against each backend
+func TestEventStore_Conformance(t *testing.T) {
+	for backend, open := range storeBackends {
+		t.Run(string(backend), func(t *testing.T) {
+			openStore := func(t *testing.T, path string) EventStore {
+				store, err := open(path, DefaultStoreOptions())
+				require.NoError(t, err)
+				t.Cleanup(func() { store.Close() })
+				return store
+			}
+			newStore := func(t *testing.T) (EventStore, string) {
+				path, err := backend.Path(t.TempDir())
+				require.NoError(t, err)
+				return openStore(t, path), path
+			}
+
+			t.Run("EmptyStore", func(t *testing.T) {
+				store, _ := newStore(t)
+				events, err := store.ReadAll()
+				require.NoError(t, err)
+				assert.Empty(t, events)
+			})
+
+			t.Run("KeepsAppendOrder", func(t *testing.T) {
+				store, _ := newStore(t)
+				require.NoError(t, store.Append(createdEvent(1)))
+				require.NoError(t, store.AppendBatch([]Event{createdEvent(2), createdEvent(3)}))
+				require.NoError(t, store.Append(TodoCompleted{Type: "TodoCompleted", ID: "todo-1", CompletedAt: time.Now().UTC()}))
+
+				events, err := store.ReadAll()
+				require.NoError(t, err)
+				assert.Equal(t, []string{"todo-1", "todo-2", "todo-3", "todo-1"}, eventIDs(events))
+				assert.Equal(t, createdEvent(2), events[1])
+				assert.IsType(t, TodoCompleted{}, events[3])
+			})
+
+			t.Run("ReadFrom", func(t *testing.T) {
+				store, _ := newStore(t)
+				for i := 1; i <= 5; i++ {
+					require.NoError(t, store.Append(createdEvent(i)))
+				}
+
+				events, err := store.ReadFrom(0)
+				require.NoError(t, err)
+				assert.Len(t, events, 5)
+
+				events, err = store.ReadFrom(3)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"todo-4", "todo-5"}, eventIDs(events))
+
+				events, err = store.ReadFrom(5)
+				require.NoError(t, err)
+				assert.Empty(t, events)
+
+				events, err = store.ReadFrom(10)
+				require.NoError(t, err)
+				assert.Empty(t, events)
+			})
+
+			t.Run("ConcurrentBatchesStayContiguous", func(t *testing.T) {
+				store, _ := newStore(t)
+				const writers, batchSize = 20, 5
+
+				var wg sync.WaitGroup
+				for w := range writers {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						batch := make([]Event, batchSize)
+						for i := range batch {
+							batch[i] = createdEvent(w*batchSize + i)
+						}
+						assert.NoError(t, store.AppendBatch(batch))
+					}()
+				}
+				wg.Wait()
+
+				events, err := store.ReadAll()
+				require.NoError(t, err)
+				require.Len(t, events, writers*batchSize)
+				for start := 0; start < len(events); start += batchSize {
+					first := events[start].(TodoCreated).SortOrder
+					for i := 1; i < batchSize; i++ {
+						assert.Equal(t, first+i, events[start+i].(TodoCreated).SortOrder, "batch split at %d", start+i)
+					}
+				}
+			})
+
+			t.Run("PersistsAcrossReopen", func(t *testing.T) {
+				store, path := newStore(t)
+				require.NoError(t, store.AppendBatch([]Event{createdEvent(1), createdEvent(2)}))
+				require.NoError(t, store.Close())
+
+				reopened := openStore(t, path)
+				require.NoError(t, reopened.Append(createdEvent(3)))
+				events, err := reopened.ReadAll()
+				require.NoError(t, err)
+				assert.Equal(t, []string{"todo-1", "todo-2", "todo-3"}, eventIDs(events))
+			})
+
+			t.Run("AppendAfterClose", func(t *testing.T) {
+				store, _ := newStore(t)
+				require.NoError(t, store.Close())
+				require.NoError(t, store.Close(), "Close must be idempotent")
+
+				assert.ErrorIs(t, store.Append(createdEvent(1)), ErrStoreClosed)
+				assert.ErrorIs(t, store.AppendBatch([]Event{createdEvent(1)}), ErrStoreClosed)
+			})
+
+			t.Run("BackupIsConsistentDuringAppends", func(t *testing.T) {
+				store, _ := newStore(t)
+				require.NoError(t, store.AppendBatch([]Event{createdEvent(0), createdEvent(1)}))
+
+				stop := make(chan struct{})
+				appended := make(chan struct{})
+				go func() {
+					defer close(appended)
+					for i := 2; ; i++ {
+						select {
+						case <-stop:
+							return
+						default:
+							assert.NoError(t, store.Append(createdEvent(i)))
+						}
+					}
+				}()
+
+				for range 5 {
+					var buf bytes.Buffer
+					count, err := store.Backup(&buf)
+					require.NoError(t, err)
+
+					// The snapshot opens as a store of the same backend and holds a prefix of the log
+					path, _ := backend.Path(t.TempDir())
+					require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+					snapshot, err := open(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true})
+					require.NoError(t, err)
+					events, err := snapshot.ReadAll()
+					require.NoError(t, err)
+					require.NoError(t, snapshot.Close())
+
+					require.Len(t, events, count)
+					assert.GreaterOrEqual(t, count, 2)
+					for i, event := range events {
+						assert.Equal(t, fmt.Sprintf("todo-%d", i), event.GetID())
+					}
+				}
+				close(stop)
+				<-appended
+
+				require.NoError(t, store.Close())
+				_, err := store.Backup(io.Discard)
+				assert.ErrorIs(t, err, ErrStoreClosed)
+			})
+
+			t.Run("SecondWriterIsRefused", func(t *testing.T) {
+				store, path := newStore(t)
+
+				_, err := open(path, DefaultStoreOptions())
+				require.ErrorIs(t, err, ErrStoreLocked)
+				assert.ErrorContains(t, err, fmt.Sprintf("pid %d", os.Getpid()))
+
+				// The lock is released on close
+				require.NoError(t, store.Close())
+				openStore(t, path)
+			})
+
+			t.Run("ReadOnly", func(t *testing.T) {
+				writer, path := newStore(t)
+				require.NoError(t, writer.Append(createdEvent(1)))
+				if backend == StoreBackendBolt {
+					// bbolt itself allows one writer or several readers per database file
+					require.NoError(t, writer.Close())
+				}
+
+				readOnly := DefaultStoreOptions()
+				readOnly.ReadOnly = true
+				reader, err := open(path, readOnly)
+				require.NoError(t, err)
+				defer reader.Close()
+
+				events, err := reader.ReadAll()
+				require.NoError(t, err)
+				assert.Equal(t, []string{"todo-1"}, eventIDs(events))
+				assert.ErrorIs(t, reader.Append(createdEvent(2)), ErrStoreReadOnly)
+				require.NoError(t, reader.Close())
+
+				_, err = open(filepath.Join(t.TempDir(), "missing"), readOnly)
+				assert.Error(t, err, "read-only store must already exist")
+			})
+		})
+	}
+}
+
+func TestOpenEventStore_UnknownBackend(t *testing.T) {
+	_, err := OpenEventStore("sqlite", filepath.Join(t.TempDir(), "events"), DefaultStoreOptions())
+	assert.ErrorContains(t, err, "unknown store backend")
+
+	_, err = StoreBackend("sqlite").Path(".")
+	assert.Error(t, err)
+}
+
+func TestMigrate_CopiesEventsBetweenBackends(t *testing.T) {
+	dataDir := t.TempDir()
+
+	jsonlPath, _ := StoreBackendJSONL.Path(dataDir)
+	src, err := NewJSONLStore(jsonlPath)
+	require.NoError(t, err)
+	var want []string
+	for i := range migrateBatchSize + 3 {
+		require.NoError(t, src.Append(createdEvent(i)))
+		want = append(want, fmt.Sprintf("todo-%d", i))
+	}
+	require.NoError(t, src.Close())
+
+	var stdout, stderr bytes.Buffer
+	code := runMigrate([]string{"-from", "jsonl", "-to", "bolt", "-data-dir", dataDir}, ".", DefaultStoreOptions(), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), fmt.Sprintf("migrated %d events", len(want)))
+
+	boltPath, _ := StoreBackendBolt.Path(dataDir)
+	dst, err := NewBoltStore(boltPath)
+	require.NoError(t, err)
+	events, err := dst.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, want, eventIDs(events))
+	require.NoError(t, dst.Close())
+
+	// And back again into a fresh JSONL store
+	require.NoError(t, os.Remove(jsonlPath))
+	code = runMigrate([]string{"-from", "bolt", "-to", "jsonl", "-data-dir", dataDir}, ".", DefaultStoreOptions(), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	roundTrip, err := NewJSONLStore(jsonlPath)
+	require.NoError(t, err)
+	defer roundTrip.Close()
+	events, err = roundTrip.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, want, eventIDs(events))
+}
+
+func TestMigrate_RefusesNonEmptyDestination(t *testing.T) {
+	dataDir := t.TempDir()
+	for _, backend := range []StoreBackend{StoreBackendJSONL, StoreBackendBolt} {
+		path, _ := backend.Path(dataDir)
+		store, err := OpenEventStore(backend, path, DefaultStoreOptions())
+		require.NoError(t, err)
+		require.NoError(t, store.Append(createdEvent(1)))
+		require.NoError(t, store.Close())
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runMigrate([]string{"-from", "jsonl", "-to", "bolt"}, dataDir, DefaultStoreOptions(), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "already holds 1 events")
+}
+
+func TestMigrate_RejectsInvalidArguments(t *testing.T) {
+	dataDir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 1, runMigrate([]string{"-from", "jsonl", "-to", "jsonl"}, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	assert.Equal(t, 1, runMigrate([]string{"-from", "csv", "-to", "bolt"}, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	assert.Equal(t, 2, runMigrate([]string{"-bogus"}, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+
+	// A missing source isn't created
+	assert.Equal(t, 1, runMigrate([]string{"-from", "jsonl", "-to", "bolt"}, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	_, err := os.Stat(filepath.Join(dataDir, "events.jsonl"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMigrate_RefusedWhileDestinationInUse(t *testing.T) {
+	dataDir := t.TempDir()
+	jsonlPath, _ := StoreBackendJSONL.Path(dataDir)
+	running, err := NewJSONLStore(jsonlPath)
+	require.NoError(t, err)
+	defer running.Close()
+	require.NoError(t, running.Append(createdEvent(1)))
+
+	var stdout, stderr bytes.Buffer
+	code := runMigrate([]string{"-from", "jsonl", "-to", "bolt"}, dataDir, DefaultStoreOptions(), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), ErrStoreLocked.Error())
+}
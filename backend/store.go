@@ -2,38 +2,168 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
-// EventStore handles append-only event storage using a JSONL file.
+// JSONLStore is an EventStore keeping events in an append-only JSONL file, optionally
+// split into sealed segments (see segment).
 // Concurrency is handled via channels - a single goroutine owns the file.
-type EventStore struct {
-	filePath string
-	file     *os.File
-	writeCh  chan writeRequest
-	done     chan struct{}
+type JSONLStore struct {
+	filePath  string
+	file      *os.File
+	opts      StoreOptions
+	lock      *dirLock // Held on the data directory unless read-only
+	writeCh   chan writeRequest
+	backupCh  chan chan int64 // Asks the writer for the size of the synced log
+	closeMu   sync.RWMutex    // Held by senders on writeCh, and by Close while it sets closing
+	closing   bool            // Set once Close starts; no requests are queued after that
+	done      chan struct{}
+	exited    chan struct{} // Closed when the writer goroutine has returned
+	closeOnce sync.Once
+	closeErr  error
+
+	// Segments
+	activeSince time.Time    // When the active file got its first event; zero while empty (writerLoop only)
+	segmentsMu  sync.RWMutex // Held by readers listing and opening files, and by the writer renaming them
+	countsMu    sync.Mutex
+	counts      map[int]int // Number of events in each sealed segment, by segment number
+
+	chainHead []byte // Hash of the last line in chain checksum mode (writerLoop only)
 }
 
 type writeRequest struct {
-	event    Event
+	events   []Event
 	resultCh chan error
 }
 
-// NewEventStore creates a new event store backed by a JSONL file.
+// DurabilityMode controls when appended events are synced to disk
+type DurabilityMode string
+
+const (
+	// DurabilityAlways syncs every append on its own
+	DurabilityAlways DurabilityMode = "always"
+	// DurabilityBatch writes appends queued at the same time together and syncs once (group commit)
+	DurabilityBatch DurabilityMode = "batch"
+	// DurabilityInterval writes appends as they come and syncs them together every SyncInterval
+	DurabilityInterval DurabilityMode = "interval"
+)
+
+// maxGroupSize limits how many queued appends are committed with a single sync
+const maxGroupSize = 256
+
+// StoreOptions configures a JSONLStore.
+// In every mode Append returns only after its events have been synced.
+type StoreOptions struct {
+	Durability   DurabilityMode
+	SyncInterval time.Duration // Time between syncs in interval mode
+	// ReadOnly opens an existing store for reading only, e.g. for tooling.
+	// It takes no lock, so it works while the server is running; Append fails with ErrStoreReadOnly.
+	ReadOnly bool
+	// Cipher encrypts each appended event and decrypts them on read; nil stores plain JSON
+	Cipher *EventCipher
+	// Checksums selects the checksum written with each line; empty means none.
+	// Lines are verified on read whatever the mode they were written in.
+	Checksums ChecksumMode
+	// SegmentMaxSize and SegmentMaxAge seal the active file as a numbered segment once it
+	// reaches the size in bytes or the age since its first event; zero disables each
+	SegmentMaxSize int64
+	SegmentMaxAge  time.Duration
+	// CompressSegments gzips segments once sealed
+	CompressSegments bool
+}
+
+// DefaultStoreOptions returns the options used by NewJSONLStore
+func DefaultStoreOptions() StoreOptions {
+	return StoreOptions{
+		Durability:   DurabilityBatch,
+		SyncInterval: 10 * time.Millisecond,
+		Checksums:    ChecksumCRC,
+	}
+}
+
+// Validate checks the durability mode, interval, segment thresholds and checksum mode
+func (o StoreOptions) Validate() error {
+	if o.SegmentMaxSize < 0 || o.SegmentMaxAge < 0 {
+		return errors.New("segment thresholds can't be negative")
+	}
+	if o.Checksums != "" {
+		if err := o.Checksums.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch o.Durability {
+	case DurabilityAlways, DurabilityBatch:
+		return nil
+	case DurabilityInterval:
+		if o.SyncInterval <= 0 {
+			return errors.New("sync interval must be positive in interval durability mode")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown durability mode '%s'", o.Durability)
+	}
+}
+
+// NewJSONLStore creates a new event store backed by a JSONL file, with default options.
 // The file is created if it doesn't exist.
-func NewEventStore(filePath string) (*EventStore, error) {
+func NewJSONLStore(filePath string) (*JSONLStore, error) {
+	return NewJSONLStoreWithOptions(filePath, DefaultStoreOptions())
+}
+
+// NewJSONLStoreWithOptions creates a new event store backed by a JSONL file.
+// The file is created if it doesn't exist. Unless opened read-only, the store holds an
+// exclusive lock on the file's directory until closed, and fails with ErrStoreLocked if
+// another process holds it.
+func NewJSONLStoreWithOptions(filePath string, opts StoreOptions) (*JSONLStore, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.ReadOnly {
+		return openJSONLStoreReadOnly(filePath, opts)
+	}
+
+	lock, err := lockDataDir(filepath.Dir(filePath))
+	if err != nil {
+		return nil, err
+	}
+
 	// Open file for appending (create if not exists)
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
 	if err != nil {
+		lock.release()
 		return nil, fmt.Errorf("failed to open event store file: %w", err)
 	}
 
-	store := &EventStore{
+	store := &JSONLStore{
 		filePath: filePath,
 		file:     file,
-		writeCh:  make(chan writeRequest),
+		opts:     opts,
+		lock:     lock,
+		writeCh:  make(chan writeRequest, maxGroupSize),
+		backupCh: make(chan chan int64),
 		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+		counts:   make(map[int]int),
+	}
+	if store.size() > 0 {
+		// The age of events from before the restart is unknown, so count from now
+		store.activeSince = time.Now()
+	}
+	if opts.Checksums == ChecksumChain {
+		if store.chainHead, err = lastChainHash(filePath); err != nil {
+			file.Close()
+			lock.release()
+			return nil, fmt.Errorf("failed to read hash chain: %w", err)
+		}
 	}
 
 	// Start the single writer goroutine
@@ -42,93 +172,519 @@ func NewEventStore(filePath string) (*EventStore, error) {
 	return store, nil
 }
 
+// openJSONLStoreReadOnly opens an existing JSONL file for reading, without a writer goroutine
+func openJSONLStoreReadOnly(filePath string, opts StoreOptions) (*JSONLStore, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, fmt.Errorf("failed to open event store file: %w", err)
+	}
+	return &JSONLStore{filePath: filePath, opts: opts, counts: make(map[int]int)}, nil
+}
+
 // writerLoop is the single goroutine that owns file writes.
 // All writes go through this goroutine via the writeCh channel.
-func (s *EventStore) writerLoop() {
+func (s *JSONLStore) writerLoop() {
+	defer close(s.exited)
+
+	// Interval mode: requests written but not yet synced, and the file size before them
+	var unsynced []writeRequest
+	var unsyncedFrom int64
+	var tick <-chan time.Time
+	if s.opts.Durability == DurabilityInterval {
+		ticker := time.NewTicker(s.opts.SyncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	for {
 		select {
 		case req := <-s.writeCh:
-			err := s.writeEvent(req.event)
-			req.resultCh <- err
+			switch s.opts.Durability {
+			case DurabilityAlways:
+				s.commit([]writeRequest{req})
+				s.maybeRollOver()
+			case DurabilityBatch:
+				s.commit(s.collect(req))
+				s.maybeRollOver()
+			case DurabilityInterval:
+				if len(unsynced) == 0 {
+					unsyncedFrom = s.size()
+				}
+				unsynced = append(unsynced, s.write(s.collect(req))...)
+			}
+
+		case <-tick:
+			s.syncWritten(unsynced, unsyncedFrom)
+			unsynced = nil
+			s.maybeRollOver()
+
+		case reply := <-s.backupCh:
+			// Only synced events belong in a backup; unsynced ones may still be rolled back
+			if len(unsynced) > 0 {
+				reply <- unsyncedFrom
+			} else {
+				reply <- s.size()
+			}
+
 		case <-s.done:
-			return
+			// Everything queued is completed before closing; nothing is queued after done
+			s.syncWritten(unsynced, unsyncedFrom)
+			for {
+				select {
+				case req := <-s.writeCh:
+					s.commit(s.collect(req))
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
-// writeEvent performs the actual write to the file.
+// collect returns req together with any other requests already queued (group commit).
 // This should only be called from the writerLoop goroutine.
-func (s *EventStore) writeEvent(event Event) error {
-	data, err := MarshalEvent(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+func (s *JSONLStore) collect(req writeRequest) []writeRequest {
+	group := []writeRequest{req}
+	for len(group) < maxGroupSize {
+		select {
+		case next := <-s.writeCh:
+			group = append(group, next)
+		default:
+			return group
+		}
+	}
+	return group
+}
+
+// commit writes a group of requests with a single write and sync, then acknowledges each.
+// If the write or sync fails, the file is truncated back and every request in the group fails.
+// This should only be called from the writerLoop goroutine.
+func (s *JSONLStore) commit(group []writeRequest) {
+	from := s.size()
+	written := s.write(group)
+	if len(written) == 0 {
+		return
 	}
+	s.syncWritten(written, from)
+}
 
-	// Write JSON followed by newline
-	_, err = s.file.Write(append(data, '\n'))
-	if err != nil {
-		return fmt.Errorf("failed to write event: %w", err)
+// write appends the events of each request to the file without syncing and returns the
+// requests that were written. Requests that fail are answered immediately.
+// This should only be called from the writerLoop goroutine.
+func (s *JSONLStore) write(group []writeRequest) []writeRequest {
+	var data []byte
+	head := s.chainHead
+	written := make([]writeRequest, 0, len(group))
+	for _, req := range group {
+		lines, next, err := s.marshalLines(req.events, head)
+		if err != nil {
+			req.resultCh <- err
+			continue
+		}
+		data = append(data, lines...)
+		head = next
+		written = append(written, req)
+	}
+	if len(written) == 0 {
+		return nil
+	}
+
+	from := s.size()
+	if _, err := s.file.Write(data); err != nil {
+		s.rollback(from)
+		s.fail(written, fmt.Errorf("failed to write event: %w", err))
+		return nil
+	}
+	s.chainHead = head
+	if s.activeSince.IsZero() {
+		s.activeSince = time.Now()
+	}
+	return written
+}
+
+// syncWritten syncs the file and acknowledges the written requests. If the sync fails, the
+// file is truncated back to size from, where the first of them started, and they all fail.
+// This should only be called from the writerLoop goroutine.
+func (s *JSONLStore) syncWritten(written []writeRequest, from int64) {
+	if len(written) == 0 {
+		return
 	}
 
 	// Sync to ensure durability
 	if err := s.file.Sync(); err != nil {
-		return fmt.Errorf("failed to sync event store: %w", err)
+		s.rollback(from)
+		s.fail(written, fmt.Errorf("failed to sync event store: %w", err))
+		return
+	}
+	for _, req := range written {
+		req.resultCh <- nil
+	}
+}
+
+// fail answers every request with err (writerLoop only)
+func (s *JSONLStore) fail(requests []writeRequest, err error) {
+	for _, req := range requests {
+		req.resultCh <- err
+	}
+}
+
+// marshalLines encodes events as JSON lines, each encrypted if a cipher is set and then
+// checksummed. head is the hash of the line before them in chain mode; the hash of the
+// last line is returned.
+func (s *JSONLStore) marshalLines(events []Event, head []byte) ([]byte, []byte, error) {
+	var data []byte
+	for _, event := range events {
+		line, err := MarshalStoredEvent(event)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal event: %w", err)
+		}
+		if line, err = s.opts.Cipher.Seal(line); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt event: %w", err)
+		}
+		line, head = addChecksum(line, s.opts.Checksums, head)
+		// JSON followed by newline
+		data = append(append(data, line...), '\n')
 	}
+	return data, head, nil
+}
 
-	return nil
+// size returns the current size of the file, or -1 if it is unknown (writerLoop only)
+func (s *JSONLStore) size() int64 {
+	info, err := s.file.Stat()
+	if err != nil {
+		slog.Error("failed to stat event store", "error", err)
+		return -1
+	}
+	return info.Size()
+}
+
+// rollback truncates a partially written append back to size (writerLoop only)
+func (s *JSONLStore) rollback(size int64) {
+	if size < 0 {
+		slog.Error("cannot roll back partial write to event store, size unknown")
+		return
+	}
+	if err := s.file.Truncate(size); err != nil {
+		slog.Error("failed to roll back partial write to event store", "error", err)
+	}
+	if s.opts.Checksums == ChecksumChain {
+		// Chain the next line to what is now the last one
+		head, err := lastChainHash(s.filePath)
+		if err != nil {
+			slog.Error("failed to re-read hash chain after roll back", "error", err)
+		}
+		s.chainHead = head
+	}
 }
 
 // Append adds an event to the store.
 // This is safe to call from multiple goroutines - writes are serialized via channels.
-func (s *EventStore) Append(event Event) error {
+func (s *JSONLStore) Append(event Event) error {
+	return s.AppendBatch([]Event{event})
+}
+
+// AppendBatch adds several events to the store atomically: they are written and synced
+// together, and either all of them are stored or, on error, none are.
+// Returns once the events are durable according to the store's durability mode.
+func (s *JSONLStore) AppendBatch(events []Event) error {
+	return <-s.AppendAsync(events)
+}
+
+// AppendAsync queues events to be appended atomically after everything queued before them.
+// The returned channel receives the outcome once they are durable, so callers can queue
+// appends in order and wait for them outside their own locks.
+func (s *JSONLStore) AppendAsync(events []Event) <-chan error {
 	resultCh := make(chan error, 1)
-	s.writeCh <- writeRequest{event: event, resultCh: resultCh}
-	return <-resultCh
+	if s.opts.ReadOnly {
+		resultCh <- ErrStoreReadOnly
+		return resultCh
+	}
+
+	s.closeMu.RLock()
+	defer s.closeMu.RUnlock()
+	if s.closing {
+		resultCh <- ErrStoreClosed
+		return resultCh
+	}
+	// A queued request is always completed, even while closing
+	s.writeCh <- writeRequest{events: events, resultCh: resultCh}
+	return resultCh
 }
 
 // ReadAll reads all events from the store.
-// This creates a new file handle for reading to avoid interfering with writes.
-func (s *EventStore) ReadAll() ([]Event, error) {
-	// Open a separate file handle for reading
+func (s *JSONLStore) ReadAll() ([]Event, error) {
+	return s.ReadFrom(0)
+}
+
+// ReadFrom reads the events after the first position events, in order, across all segments.
+// Sealed segments wholly before position are skipped without reading them once their
+// event count is known. Every line read, skipped ones included, is checked against its
+// checksum. This opens new file handles to avoid interfering with writes.
+func (s *JSONLStore) ReadFrom(position int) ([]Event, error) {
+	var events []Event
+	err := s.scan(position, func(event Event) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// scan calls fn with each event after the first position events, in order, across all
+// segments. Unreadable lines are reported as a LogCorruptionError.
+func (s *JSONLStore) scan(position int, fn func(Event) error) error {
+	return s.scanVerified(position, &lineVerifier{}, fn)
+}
+
+// scanVerified is scan with the given verifier, which sees every line read
+func (s *JSONLStore) scanVerified(position int, verifier *lineVerifier, fn func(Event) error) error {
+	s.segmentsMu.RLock()
+	defer s.segmentsMu.RUnlock()
+
+	segments, err := listSegments(s.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to list event store segments: %w", err)
+	}
+
+	skip := max(position, 0)
+	for _, seg := range segments {
+		if count, ok := s.segmentCount(seg.number); ok && count <= skip {
+			skip -= count
+			// The next segment's first link can't be checked
+			verifier.prev = nil
+			continue
+		}
+
+		reader, err := seg.open()
+		if err != nil {
+			return fmt.Errorf("failed to open event store segment: %w", err)
+		}
+		count, err := s.readEvents(reader, filepath.Base(seg.path), skip, verifier, fn)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		s.setSegmentCount(seg.number, count)
+		skip = max(skip-count, 0)
+	}
+
+	// Then the active file
 	file, err := os.Open(s.filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open event store for reading: %w", err)
+		return fmt.Errorf("failed to open event store for reading: %w", err)
 	}
 	defer file.Close()
 
-	var events []Event
-	scanner := bufio.NewScanner(file)
+	_, err = s.readEvents(file, filepath.Base(s.filePath), skip, verifier, fn)
+	return err
+}
 
-	for scanner.Scan() {
+// readEvents verifies and parses the lines of r, the file named name, and calls fn with the
+// events after the first skip ones. Returns the number of events in r, skipped ones included.
+func (s *JSONLStore) readEvents(r io.Reader, name string, skip int, verifier *lineVerifier, fn func(Event) error) (int, error) {
+	scanner := bufio.NewScanner(r)
+	count := 0
+	lineNo := 0
+	var offset int64
+
+	for ; scanner.Scan(); offset += int64(len(scanner.Bytes())) + 1 {
+		lineNo++
 		line := scanner.Bytes()
 		if len(line) == 0 {
 			continue
 		}
+		count++
+
+		corrupt := func(err error) error {
+			return &LogCorruptionError{File: name, Line: lineNo, Offset: offset, Err: err}
+		}
 
-		event, err := ParseEvent(line)
+		payload, kind, err := verifier.verify(line)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse event: %w", err)
+			return count, corrupt(err)
+		}
+		verifier.note(kind, name, lineNo)
+		if count <= skip {
+			continue
+		}
+
+		data, err := s.opts.Cipher.Open(payload)
+		if err != nil {
+			return count, corrupt(fmt.Errorf("failed to decrypt event: %w", err))
+		}
+
+		event, err := ParseStoredEvent(data)
+		if err != nil {
+			return count, corrupt(fmt.Errorf("failed to parse event: %w", err))
+		}
+		if err := fn(event); err != nil {
+			return count, err
 		}
-		events = append(events, event)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading event store: %w", err)
+		return count, fmt.Errorf("error reading event store: %w", err)
+	}
+
+	return count, nil
+}
+
+// lastChainHash returns the hash of the last line of the log at filePath if it is
+// chained, or nil, so appends in chain mode continue the chain
+func lastChainHash(filePath string) ([]byte, error) {
+	files, err := jsonlLogFiles(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// The active file is empty right after a roll-over, then the last segment ends the log
+	for i := len(files) - 1; i >= 0; i-- {
+		last, err := lastLine(files[i])
+		if err != nil {
+			return nil, err
+		}
+		if last == nil {
+			continue
+		}
+		var verifier lineVerifier
+		if _, _, err := verifier.verify(last); err != nil {
+			return nil, fmt.Errorf("last line of %s: %w", filepath.Base(files[i]), err)
+		}
+		return verifier.prev, nil
+	}
+	return nil, nil
+}
+
+// lastLine returns the last non-empty line of a log file, decompressing a sealed segment
+func lastLine(path string) ([]byte, error) {
+	seg := segment{path: path, compressed: filepath.Ext(path) == ".gz"}
+	reader, err := seg.open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	return last, scanner.Err()
+}
+
+// segmentCount returns the cached event count of a sealed segment
+func (s *JSONLStore) segmentCount(n int) (int, bool) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	count, ok := s.counts[n]
+	return count, ok
+}
+
+func (s *JSONLStore) setSegmentCount(n, count int) {
+	s.countsMu.Lock()
+	defer s.countsMu.Unlock()
+	s.counts[n] = count
+}
+
+// Backup writes a consistent snapshot of the log to w as a single JSONL file, with sealed
+// segments decompressed and concatenated, and returns the number of events in it.
+// The writer reports how far the active file is synced and it is copied up to there, so
+// appends continue meanwhile and end up after the snapshot. Events keep their encoding,
+// including encryption, so the snapshot can be restored in place of the log.
+func (s *JSONLStore) Backup(w io.Writer) (int, error) {
+	// Segments can't be sealed while this is held, so the size stays that of the active file
+	s.segmentsMu.RLock()
+	defer s.segmentsMu.RUnlock()
+
+	size := int64(-1)
+	if !s.opts.ReadOnly {
+		reply := make(chan int64, 1)
+		select {
+		case s.backupCh <- reply:
+			size = <-reply
+		case <-s.done:
+			return 0, ErrStoreClosed
+		}
+		if size < 0 {
+			return 0, errors.New("failed to determine size of event store")
+		}
+	}
+
+	segments, err := listSegments(s.filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list event store segments: %w", err)
+	}
+	total := 0
+	for _, seg := range segments {
+		reader, err := seg.open()
+		if err != nil {
+			return total, fmt.Errorf("failed to open event store segment for backup: %w", err)
+		}
+		count, err := copyCompleteLines(w, reader)
+		reader.Close()
+		total += count
+		if err != nil {
+			return total, err
+		}
 	}
 
-	return events, nil
+	file, err := os.Open(s.filePath)
+	if err != nil {
+		return total, fmt.Errorf("failed to open event store for backup: %w", err)
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	if size >= 0 {
+		src = io.LimitReader(file, size)
+	}
+	count, err := copyCompleteLines(w, src)
+	return total + count, err
 }
 
-// Close shuts down the event store, closing the file and stopping the writer goroutine.
-func (s *EventStore) Close() error {
-	close(s.done)
-	return s.file.Close()
+// copyCompleteLines copies the lines of src to w, leaving out a last line without a newline,
+// which is an append still in progress, and returns the number of non-empty lines copied
+func copyCompleteLines(w io.Writer, src io.Reader) (int, error) {
+	reader := bufio.NewReader(src)
+	count := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read event store: %w", err)
+		}
+		if _, err := w.Write(line); err != nil {
+			return count, fmt.Errorf("failed to write backup: %w", err)
+		}
+		if len(line) > 1 {
+			count++
+		}
+	}
+}
+
+// Close shuts down the event store, stopping the writer goroutine once its current write
+// has been synced, then closing the file and releasing the lock. Safe to call more than once.
+func (s *JSONLStore) Close() error {
+	if s.opts.ReadOnly {
+		return nil
+	}
+
+	s.closeOnce.Do(func() {
+		s.closeMu.Lock()
+		s.closing = true
+		s.closeMu.Unlock()
+		close(s.done)
+		<-s.exited
+		s.closeErr = errors.Join(s.file.Close(), s.lock.release())
+	})
+	return s.closeErr
 }
 
 // AppendRaw appends raw JSON bytes to the store (used when forwarding from WebSocket)
-func (s *EventStore) AppendRaw(data []byte) error {
+func (s *JSONLStore) AppendRaw(data []byte) error {
 	// Parse to validate
-	event, err := ParseEvent(data)
+	event, err := ParseStoredEvent(data)
 	if err != nil {
 		return err
 	}
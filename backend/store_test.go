@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,7 +17,7 @@ func TestEventStore_WriteAndRead(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -49,7 +51,7 @@ func TestEventStore_MultipleEvents(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -102,7 +104,7 @@ func TestEventStore_PersistenceAcrossRestart(t *testing.T) {
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
 	// Create store and write event
-	store1, err := NewEventStore(filePath)
+	store1, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 
 	event := TodoCreated{
@@ -117,7 +119,7 @@ func TestEventStore_PersistenceAcrossRestart(t *testing.T) {
 	store1.Close()
 
 	// Create new store instance and verify event persisted
-	store2, err := NewEventStore(filePath)
+	store2, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store2.Close()
 
@@ -133,7 +135,7 @@ func TestEventStore_ConcurrentWrites(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -177,7 +179,7 @@ func TestEventStore_EmptyFile(t *testing.T) {
 	_, err := os.Create(filePath)
 	require.NoError(t, err)
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -190,7 +192,7 @@ func TestEventStore_AllEventTypes(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -230,7 +232,7 @@ func TestEventStore_AppendRaw(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -265,7 +267,7 @@ func TestEventStore_AppendRaw_InvalidJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 	filePath := filepath.Join(tmpDir, "events.jsonl")
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -284,7 +286,7 @@ func TestEventStore_ReadAll_SkipEmptyLines(t *testing.T) {
 {"type":"TodoCompleted","id":"1","completedAt":"2024-01-01T00:00:00Z"}
 `), 0o644)
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -303,7 +305,7 @@ func TestEventStore_ReadAll_InvalidEvent(t *testing.T) {
 {"type":"UnknownEvent","id":"2"}
 `), 0o644)
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -322,7 +324,7 @@ func TestEventStore_ReadAll_MalformedJSON(t *testing.T) {
 not valid json
 `), 0o644)
 
-	store, err := NewEventStore(filePath)
+	store, err := NewJSONLStore(filePath)
 	require.NoError(t, err)
 	defer store.Close()
 
@@ -333,6 +335,145 @@ not valid json
 
 func TestEventStore_NewEventStore_InvalidPath(t *testing.T) {
 	// Try to create store in non-existent directory without permission
-	_, err := NewEventStore("/nonexistent/directory/that/cannot/be/created/events.jsonl")
+	_, err := NewJSONLStore("/nonexistent/directory/that/cannot/be/created/events.jsonl")
 	assert.Error(t, err)
 }
+
+func TestEventStore_AppendAfterClose(t *testing.T) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+
+	require.NoError(t, store.Append(ListTitleChanged{Type: "ListTitleChanged", Title: "Before"}))
+	require.NoError(t, store.Close())
+	assert.NoError(t, store.Close(), "closing twice should be safe")
+
+	err = store.Append(ListTitleChanged{Type: "ListTitleChanged", Title: "After"})
+	assert.ErrorIs(t, err, ErrStoreClosed)
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestEventStore_AppendBatch(t *testing.T) {
+	store, err := NewJSONLStore(filepath.Join(t.TempDir(), "events.jsonl"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.Append(ListTitleChanged{Type: "ListTitleChanged", Title: "First"}))
+	require.NoError(t, store.AppendBatch([]Event{
+		ListTitleChanged{Type: "ListTitleChanged", Title: "Second"},
+		ListTitleChanged{Type: "ListTitleChanged", Title: "Third"},
+	}))
+
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "Third", events[2].(ListTitleChanged).Title)
+}
+
+func TestEventStore_DurabilityModes(t *testing.T) {
+	for _, mode := range []DurabilityMode{DurabilityAlways, DurabilityBatch, DurabilityInterval} {
+		t.Run(string(mode), func(t *testing.T) {
+			opts := DefaultStoreOptions()
+			opts.Durability = mode
+			store, err := NewJSONLStoreWithOptions(filepath.Join(t.TempDir(), "events.jsonl"), opts)
+			require.NoError(t, err)
+			defer store.Close()
+
+			// Concurrent appends are all acknowledged and stored
+			const writers = 20
+			const perWriter = 10
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						// Batches stay contiguous even when committed with other appends
+						assert.NoError(t, store.AppendBatch([]Event{
+							TodoCreated{Type: "TodoCreated", ID: fmt.Sprintf("todo-%d-%d", w, i), Name: "Item"},
+							TodoCompleted{Type: "TodoCompleted", ID: fmt.Sprintf("todo-%d-%d", w, i)},
+						}))
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			events, err := store.ReadAll()
+			require.NoError(t, err)
+			require.Len(t, events, writers*perWriter*2)
+			for i := 0; i < len(events); i += 2 {
+				assert.Equal(t, "TodoCreated", events[i].EventType())
+				assert.Equal(t, events[i].GetID(), events[i+1].GetID())
+			}
+		})
+	}
+}
+
+func TestEventStore_IntervalModeSyncsPendingOnClose(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "events.jsonl")
+	store, err := NewJSONLStoreWithOptions(filePath, StoreOptions{Durability: DurabilityInterval, SyncInterval: time.Hour})
+	require.NoError(t, err)
+
+	appended := make(chan error, 1)
+	go func() {
+		appended <- store.Append(ListTitleChanged{Type: "ListTitleChanged", Title: "Pending"})
+	}()
+
+	// Not acknowledged before the (hour-long) interval has passed
+	select {
+	case <-appended:
+		t.Fatal("append acknowledged before it was synced")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Closing syncs it and acknowledges the append
+	require.NoError(t, store.Close())
+	assert.NoError(t, <-appended)
+
+	reopened, err := NewJSONLStore(filePath)
+	require.NoError(t, err)
+	defer reopened.Close()
+	events, err := reopened.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+func TestStoreOptions_Validate(t *testing.T) {
+	assert.NoError(t, DefaultStoreOptions().Validate())
+	assert.Error(t, StoreOptions{Durability: "sometimes"}.Validate())
+	assert.Error(t, StoreOptions{Durability: DurabilityInterval}.Validate())
+	assert.NoError(t, StoreOptions{Durability: DurabilityAlways}.Validate())
+	assert.Error(t, StoreOptions{Durability: DurabilityBatch, SegmentMaxSize: -1}.Validate())
+	assert.Error(t, StoreOptions{Durability: DurabilityBatch, SegmentMaxAge: -time.Second}.Validate())
+
+	_, err := NewJSONLStoreWithOptions(filepath.Join(t.TempDir(), "events.jsonl"), StoreOptions{Durability: "never"})
+	assert.Error(t, err)
+}
+
+// BenchmarkEventStore_Append measures concurrent appends in each durability mode.
+// Run on the target device to compare: go test -run '^$' -bench EventStore_Append
+func BenchmarkEventStore_Append(b *testing.B) {
+	for _, mode := range []DurabilityMode{DurabilityAlways, DurabilityBatch, DurabilityInterval} {
+		b.Run(string(mode), func(b *testing.B) {
+			opts := DefaultStoreOptions()
+			opts.Durability = mode
+			store, err := NewJSONLStoreWithOptions(filepath.Join(b.TempDir(), "events.jsonl"), opts)
+			require.NoError(b, err)
+			defer store.Close()
+
+			event := TodoCreated{Type: "TodoCreated", ID: "todo-1", Name: "Benchmark item", CreatedAt: time.Now().UTC()}
+			b.SetParallelism(8)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := store.Append(event); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import "time"
+
+type CreateTodoCommand struct {
+	BaseCommand
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	SortOrder  float64 `json:"sortOrder,omitempty"`
+	CategoryID *string `json:"categoryId,omitempty"`
+}
+
+type CategorizeTodoCommand struct {
+	BaseCommand
+	ID         string  `json:"id"`
+	CategoryID *string `json:"categoryId"`
+}
+
+type CompleteTodoCommand struct {
+	BaseCommand
+	ID string `json:"id"`
+}
+
+type UncompleteTodoCommand struct {
+	BaseCommand
+	ID string `json:"id"`
+}
+
+type StarTodoCommand struct {
+	BaseCommand
+	ID string `json:"id"`
+}
+
+type UnstarTodoCommand struct {
+	BaseCommand
+	ID string `json:"id"`
+}
+
+type ReorderTodoCommand struct {
+	BaseCommand
+	ID        string  `json:"id"`
+	SortOrder float64 `json:"sortOrder"`
+}
+
+type RenameTodoCommand struct {
+	BaseCommand
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func init() {
+	registerCommand("CreateTodo", nil, createTodo)
+	registerCommand("CategorizeTodo", checkCategorizeTodo, func(_ *State, c CategorizeTodoCommand) (Event, error) {
+		return TodoCategorized{Type: "TodoCategorized", ID: c.ID, CategoryID: c.CategoryID}, nil
+	})
+	registerCommand("CompleteTodo", nil, func(_ *State, c CompleteTodoCommand) (Event, error) {
+		return TodoCompleted{Type: "TodoCompleted", ID: c.ID, CompletedAt: time.Now().UTC()}, nil
+	})
+	registerCommand("UncompleteTodo", nil, func(_ *State, c UncompleteTodoCommand) (Event, error) {
+		return TodoUncompleted{Type: "TodoUncompleted", ID: c.ID}, nil
+	})
+	registerCommand("StarTodo", nil, func(state *State, c StarTodoCommand) (Event, error) {
+		return TodoStarred{Type: "TodoStarred", ID: c.ID, SortOrder: state.GetHighestSortOrder() + 1000}, nil
+	})
+	registerCommand("UnstarTodo", nil, func(_ *State, c UnstarTodoCommand) (Event, error) {
+		return TodoUnstarred{Type: "TodoUnstarred", ID: c.ID}, nil
+	})
+	registerCommand("ReorderTodo", nil, func(_ *State, c ReorderTodoCommand) (Event, error) {
+		return TodoReordered{Type: "TodoReordered", ID: c.ID, SortOrder: int(c.SortOrder)}, nil
+	})
+	registerCommand("RenameTodo", nil, func(_ *State, c RenameTodoCommand) (Event, error) {
+		return TodoRenamed{Type: "TodoRenamed", ID: c.ID, Name: c.Name}, nil
+	})
+
+	registerProjector((*State).applyTodoCreated)
+	registerProjector((*State).applyTodoCompleted)
+	registerProjector((*State).applyTodoUncompleted)
+	registerProjector((*State).applyTodoStarred)
+	registerProjector((*State).applyTodoUnstarred)
+	registerProjector((*State).applyTodoReordered)
+	registerProjector((*State).applyTodoRenamed)
+	registerProjector((*State).applyTodoCategorized)
+	registerProjector((*State).applyTodoQuantityChanged)
+}
+
+// createTodo creates a todo, or handles a near-duplicate of an active one according to the
+// list's duplicate policy
+func createTodo(state *State, c CreateTodoCommand) (Event, error) {
+	// If no ID provided, reject (client should send), but we keep as-is
+	if c.ID == "" {
+		return nil, nil
+	}
+
+	// Detect near-duplicates of active todos according to the list's policy
+	if policy := state.GetDuplicatePolicy(); policy != DuplicatePolicyAllow {
+		if existing, ok := state.FindActiveDuplicate(c.Name); ok {
+			if policy == DuplicatePolicyReject {
+				return nil, &DuplicateTodoError{Existing: *existing}
+			}
+			return TodoQuantityChanged{
+				Type:     "TodoQuantityChanged",
+				ID:       existing.ID,
+				Quantity: existing.Quantity + 1,
+			}, nil
+		}
+	}
+
+	sortOrder := state.GetHighestSortOrder() + 1000
+	if c.SortOrder != 0 {
+		sortOrder = int(c.SortOrder)
+	}
+	return TodoCreated{
+		Type:       "TodoCreated",
+		ID:         c.ID,
+		Name:       c.Name,
+		CreatedAt:  time.Now().UTC(),
+		SortOrder:  sortOrder,
+		CategoryID: c.CategoryID,
+	}, nil
+}
+
+func checkCategorizeTodo(state *State, c CategorizeTodoCommand) error {
+	// Validate category exists if provided
+	if c.CategoryID != nil {
+		if _, ok := state.GetCategory(*c.CategoryID); !ok {
+			return notFound(ErrorCodeCategoryNotFound, "id", *c.CategoryID)
+		}
+	}
+	if _, ok := state.GetTodo(c.ID); !ok {
+		return notFound(ErrorCodeTodoNotFound, "id", c.ID)
+	}
+	return nil
+}
+
+func (s *State) applyTodoCreated(e TodoCreated) {
+	s.todos[e.ID] = &Todo{
+		ID:         e.ID,
+		Name:       e.Name,
+		CreatedAt:  e.CreatedAt,
+		SortOrder:  e.SortOrder,
+		Starred:    false,
+		CategoryID: e.CategoryID,
+		Quantity:   1,
+	}
+	// Track name frequency for autocomplete
+	s.trackNameFrequency(e.Name)
+	s.trackLastCategory(e.Name, e.CategoryID)
+}
+
+func (s *State) applyTodoCompleted(e TodoCompleted) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.CompletedAt = &e.CompletedAt
+	}
+}
+
+func (s *State) applyTodoUncompleted(e TodoUncompleted) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.CompletedAt = nil
+	}
+}
+
+func (s *State) applyTodoStarred(e TodoStarred) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.Starred = true
+		todo.SortOrder = e.SortOrder
+	}
+}
+
+func (s *State) applyTodoUnstarred(e TodoUnstarred) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.Starred = false
+	}
+}
+
+func (s *State) applyTodoReordered(e TodoReordered) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.SortOrder = e.SortOrder
+	}
+}
+
+func (s *State) applyTodoRenamed(e TodoRenamed) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.Name = e.Name
+		// Track name frequency for autocomplete
+		s.trackNameFrequency(e.Name)
+		s.trackLastCategory(e.Name, todo.CategoryID)
+	}
+}
+
+func (s *State) applyTodoCategorized(e TodoCategorized) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.CategoryID = e.CategoryID
+		s.trackLastCategory(todo.Name, e.CategoryID)
+	}
+}
+
+func (s *State) applyTodoQuantityChanged(e TodoQuantityChanged) {
+	if todo, ok := s.todos[e.ID]; ok {
+		todo.Quantity = e.Quantity
+	}
+}
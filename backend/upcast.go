@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNewerEventVersion is returned for an event written by a newer build than this one
+var ErrNewerEventVersion = errors.New("event was written by a newer version")
+
+// eventVersionField is the field of a stored event holding its schema version. Lines
+// written before events were versioned don't have it and are version 1.
+const eventVersionField = "v"
+
+// upcastFunc rewrites the fields of one event into its shape at the next schema version.
+// It may rename the event by replacing fields["type"].
+type upcastFunc func(fields map[string]json.RawMessage) error
+
+// eventSchema is a schema version of the stored events, with the upcasters that bring
+// events stored at older versions up to it
+type eventSchema struct {
+	version int
+	// upcasters[v] rewrite events stored at version v into their version v+1 shape, keyed
+	// by event type at version v. Events without an upcaster are unchanged by that step.
+	upcasters map[int]map[string]upcastFunc
+}
+
+// currentEventSchema describes the event shapes in events_gen.go. When an event changes in
+// a way old lines don't parse into, bump version and register an upcaster from the
+// previous version, then add lines in the old shape to testdata/events/history.jsonl.
+var currentEventSchema = eventSchema{
+	version:   1,
+	upcasters: map[int]map[string]upcastFunc{},
+}
+
+// ParseStoredEvent parses an event as stored in the event log, upcasting it to the current
+// schema version first if it was stored at an older one
+func ParseStoredEvent(data []byte) (Event, error) {
+	return currentEventSchema.parse(data)
+}
+
+// MarshalStoredEvent serializes an event for the event log, tagged with the current
+// schema version
+func MarshalStoredEvent(e Event) ([]byte, error) {
+	return currentEventSchema.marshal(e)
+}
+
+func (s eventSchema) parse(data []byte) (Event, error) {
+	var header struct {
+		Type    string `json:"type"`
+		Version int    `json:"v"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse event type: %w", err)
+	}
+	version := max(header.Version, 1)
+	if version > s.version {
+		return nil, fmt.Errorf("%w: %s has schema version %d, this build reads up to %d",
+			ErrNewerEventVersion, header.Type, version, s.version)
+	}
+	if version < s.version {
+		upcast, err := s.upcast(data, version)
+		if err != nil {
+			return nil, err
+		}
+		data = upcast
+	}
+	return ParseEvent(data)
+}
+
+// upcast runs the upcasters from version on, returning the event in its current shape
+func (s eventSchema) upcast(data []byte, version int) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	for v := version; v < s.version; v++ {
+		var eventType string
+		if err := json.Unmarshal(fields["type"], &eventType); err != nil {
+			return nil, fmt.Errorf("failed to parse event type at version %d: %w", v, err)
+		}
+		upcast, ok := s.upcasters[v][eventType]
+		if !ok {
+			continue
+		}
+		if err := upcast(fields); err != nil {
+			return nil, fmt.Errorf("failed to upcast %s from version %d: %w", eventType, v, err)
+		}
+	}
+	fields[eventVersionField] = json.RawMessage(strconv.Itoa(s.version))
+	return json.Marshal(fields)
+}
+
+func (s eventSchema) marshal(e Event) ([]byte, error) {
+	data, err := MarshalEvent(e)
+	if err != nil {
+		return nil, err
+	}
+	// Every event is a JSON object with at least its type, so the version can be appended
+	// as a last field without decoding it again
+	data = bytes.TrimSuffix(data, []byte("}"))
+	return fmt.Appendf(data, ",%q:%d}", eventVersionField, s.version), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// historyGolden is what replaying testdata/events/history.jsonl must keep producing
+type historyGolden struct {
+	Events     []Event     `json:"events"`
+	ListTitle  string      `json:"listTitle"`
+	Todos      []Todo      `json:"todos"`
+	Categories []Category  `json:"categories"`
+	Synonyms   []Synonym   `json:"synonyms"`
+	NameGroups []NameGroup `json:"nameGroups"`
+}
+
+// TestEventHistory_Golden replays event log lines in every shape earlier versions wrote.
+// If it fails after an event type changed, register an upcaster instead of updating the
+// golden file; run with -update only when the expected output changed on purpose.
+func TestEventHistory_Golden(t *testing.T) {
+	history, err := os.ReadFile(filepath.Join("testdata", "events", "history.jsonl"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, os.WriteFile(path, history, 0o644))
+
+	store, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true})
+	require.NoError(t, err)
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, events, bytes.Count(history, []byte("\n")), "every line replays")
+
+	state := NewState()
+	state.ApplyEvents(events)
+	got, err := json.MarshalIndent(historyGolden{
+		Events:     events,
+		ListTitle:  state.GetListTitle(),
+		Todos:      state.GetTodos(),
+		Categories: state.GetCategories(),
+		Synonyms:   state.GetSynonyms(),
+		NameGroups: state.GetNameGroups(),
+	}, "", "  ")
+	require.NoError(t, err)
+	got = append(got, '\n')
+
+	goldenPath := filepath.Join("testdata", "events", "history.golden.json")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(goldenPath, got, 0o644))
+	}
+	want, err := os.ReadFile(goldenPath)
+	require.NoError(t, err)
+	assert.Equal(t, string(want), string(got))
+}
+
+func TestMarshalStoredEvent(t *testing.T) {
+	event := createdEvent(1)
+	data, err := MarshalStoredEvent(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"TodoCreated","id":"todo-1","name":"Item 1","createdAt":"2024-01-01T00:00:01Z","sortOrder":1,"categoryId":null,"v":1}`, string(data))
+
+	parsed, err := ParseStoredEvent(data)
+	require.NoError(t, err)
+	assert.Equal(t, event, parsed)
+
+	// Clients always get the current shape, without the version
+	broadcast, err := MarshalEvent(event)
+	require.NoError(t, err)
+	assert.NotContains(t, string(broadcast), `"v"`)
+}
+
+// testEventSchema is version 3 of a made up history: version 1 called TodoCreated
+// ItemAdded with a title, and version 2 stored createdAt as Unix seconds
+func testEventSchema() eventSchema {
+	return eventSchema{
+		version: 3,
+		upcasters: map[int]map[string]upcastFunc{
+			1: {
+				"ItemAdded": func(fields map[string]json.RawMessage) error {
+					fields["type"] = json.RawMessage(`"TodoCreated"`)
+					fields["name"] = fields["title"]
+					delete(fields, "title")
+					return nil
+				},
+			},
+			2: {
+				"TodoCreated": func(fields map[string]json.RawMessage) error {
+					var seconds int64
+					if err := json.Unmarshal(fields["createdAt"], &seconds); err != nil {
+						return err
+					}
+					createdAt, err := json.Marshal(time.Unix(seconds, 0).UTC())
+					fields["createdAt"] = createdAt
+					return err
+				},
+			},
+		},
+	}
+}
+
+func TestEventSchema_Upcast(t *testing.T) {
+	schema := testEventSchema()
+	want := TodoCreated{
+		Type:      "TodoCreated",
+		ID:        "todo-1",
+		Name:      "Milk",
+		CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for name, line := range map[string]string{
+		"unversioned": `{"type":"ItemAdded","id":"todo-1","title":"Milk","createdAt":1704067200}`,
+		"version 1":   `{"type":"ItemAdded","id":"todo-1","title":"Milk","createdAt":1704067200,"v":1}`,
+		"version 2":   `{"type":"TodoCreated","id":"todo-1","name":"Milk","createdAt":1704067200,"v":2}`,
+		"current":     `{"type":"TodoCreated","id":"todo-1","name":"Milk","createdAt":"2024-01-01T00:00:00Z","v":3}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			event, err := schema.parse([]byte(line))
+			require.NoError(t, err)
+			assert.Equal(t, want, event)
+		})
+	}
+
+	t.Run("events without upcasters pass through", func(t *testing.T) {
+		event, err := schema.parse([]byte(`{"type":"TodoRenamed","id":"todo-1","name":"Oat milk"}`))
+		require.NoError(t, err)
+		assert.Equal(t, TodoRenamed{Type: "TodoRenamed", ID: "todo-1", Name: "Oat milk"}, event)
+	})
+
+	t.Run("upcaster errors name the step", func(t *testing.T) {
+		_, err := schema.parse([]byte(`{"type":"TodoCreated","id":"todo-1","createdAt":"yesterday","v":2}`))
+		assert.ErrorContains(t, err, "failed to upcast TodoCreated from version 2")
+	})
+
+	t.Run("newer versions are refused", func(t *testing.T) {
+		_, err := schema.parse([]byte(`{"type":"TodoCreated","id":"todo-1","v":4}`))
+		assert.True(t, errors.Is(err, ErrNewerEventVersion))
+		assert.ErrorContains(t, err, "TodoCreated has schema version 4, this build reads up to 3")
+	})
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ValidationError is returned for a command or event that doesn't match the schema.
+// It lists every mismatching field, not just the first.
+type ValidationError struct {
+	Type   string // Type of the message
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return errorMessage(ErrorCodeInvalidFields, e.params())
+}
+
+func (e *ValidationError) params() map[string]string {
+	problems := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		problems[i] = strings.TrimSpace(fieldErr.Field + " " + fieldErr.Message)
+	}
+	return map[string]string{"type": e.Type, "problems": strings.Join(problems, "; ")}
+}
+
+// schemaNode is the subset of JSON Schema that schema/events.schema.json uses
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Const                *string                `json:"const"`
+	Enum                 []string               `json:"enum"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties schemaAdditional       `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Not                  *schemaNode            `json:"not"`
+	AllOf                []*schemaNode          `json:"allOf"`
+	OneOf                []*schemaNode          `json:"oneOf"`
+}
+
+// schemaTypes is a "type" keyword, either a single type or a list of them
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// schemaAdditional is an "additionalProperties" keyword, either a boolean or the node every
+// other property's value must match
+type schemaAdditional struct {
+	forbidden bool
+	values    *schemaNode
+}
+
+func (a *schemaAdditional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.forbidden = !allowed
+		return nil
+	}
+	a.values = &schemaNode{}
+	return json.Unmarshal(data, a.values)
+}
+
+// messageSchema validates decoded JSON messages against the definitions of a schema
+type messageSchema struct {
+	definitions map[string]*schemaNode
+	commands    []string // Members of the Command union
+	events      []string // Members of the Event union
+}
+
+// messages is schema/events.schema.json, shared with the frontend
+var messages = mustParseMessageSchema(eventsSchema)
+
+func mustParseMessageSchema(source string) *messageSchema {
+	var file struct {
+		Definitions map[string]*schemaNode `json:"definitions"`
+	}
+	if err := json.Unmarshal([]byte(source), &file); err != nil {
+		panic(fmt.Sprintf("invalid message schema: %v", err))
+	}
+	s := &messageSchema{definitions: file.Definitions}
+	s.commands = s.members("Command")
+	s.events = s.members("Event")
+	return s
+}
+
+// members returns the definition names of a oneOf union
+func (s *messageSchema) members(union string) []string {
+	var names []string
+	if definition, ok := s.definitions[union]; ok {
+		for _, member := range definition.OneOf {
+			names = append(names, strings.TrimPrefix(member.Ref, "#/definitions/"))
+		}
+	}
+	return names
+}
+
+// validateCommand checks a command message against its schema definition. Messages that
+// aren't JSON objects or aren't commands are left for the caller to reject.
+func validateCommand(data []byte) error {
+	value, messageType, ok := decodeMessage(data)
+	if !ok || !slices.Contains(messages.commands, messageType) {
+		return nil
+	}
+	return messages.validate(messageType, value)
+}
+
+// validateEvent checks an event against its schema definition before it is persisted
+func validateEvent(event Event) error {
+	data, err := MarshalEvent(event)
+	if err != nil {
+		return err
+	}
+	value, _, _ := decodeMessage(data)
+	if !slices.Contains(messages.events, event.EventType()) {
+		return fmt.Errorf("%s is not an event of the schema", event.EventType())
+	}
+	return messages.validate(event.EventType(), value)
+}
+
+// decodeMessage decodes a JSON object keeping numbers exact, and returns its type
+func decodeMessage(data []byte) (any, string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, "", false
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, "", false
+	}
+	messageType, _ := object["type"].(string)
+	return value, messageType, true
+}
+
+// validate checks a decoded message against a definition, returning a *ValidationError
+// listing every mismatch
+func (s *messageSchema) validate(definition string, value any) error {
+	var errs []FieldError
+	s.check(s.definitions[definition], value, "", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Type: definition, Errors: errs}
+	}
+	return nil
+}
+
+func (s *messageSchema) check(node *schemaNode, value any, path string, errs *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Field: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if node.Ref != "" {
+		s.check(s.definitions[strings.TrimPrefix(node.Ref, "#/definitions/")], value, path, errs)
+		return
+	}
+	for _, sub := range node.AllOf {
+		s.check(sub, value, path, errs)
+	}
+	if node.Not != nil && s.matches(node.Not, value) {
+		if name := strings.TrimPrefix(node.Not.Ref, "#/definitions/"); name != "" {
+			fail("can't be a %s", name)
+		} else {
+			fail("is not allowed")
+		}
+	}
+	if node.OneOf != nil {
+		s.checkOneOf(node, value, path, errs)
+	}
+
+	if len(node.Type) > 0 && !slices.ContainsFunc(node.Type, func(t string) bool { return hasSchemaType(value, t) }) {
+		fail("must be %s", describeTypes(node.Type))
+		return
+	}
+	if node.Const != nil && value != *node.Const {
+		fail("must be %q", *node.Const)
+	}
+	if node.Enum != nil {
+		if text, ok := value.(string); !ok || !slices.Contains(node.Enum, text) {
+			fail("must be one of %s", quoteAll(node.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		number, _ := v.Float64()
+		if node.Minimum != nil && number < *node.Minimum {
+			fail("must be at least %v", *node.Minimum)
+		}
+		if node.Maximum != nil && number > *node.Maximum {
+			fail("must be at most %v", *node.Maximum)
+		}
+	case []any:
+		if node.MinItems != nil && len(v) < *node.MinItems {
+			if *node.MinItems == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must have at least %d items", *node.MinItems)
+			}
+		}
+		if node.MaxItems != nil && len(v) > *node.MaxItems {
+			fail("must have at most %d items", *node.MaxItems)
+		}
+		if node.Items != nil {
+			for i, item := range v {
+				s.check(node.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range node.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Field: joinField(path, name), Message: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if property, ok := node.Properties[name]; ok {
+				s.check(property, v[name], joinField(path, name), errs)
+			} else if node.AdditionalProperties.values != nil {
+				s.check(node.AdditionalProperties.values, v[name], joinField(path, name), errs)
+			} else if node.AdditionalProperties.forbidden {
+				*errs = append(*errs, FieldError{Field: joinField(path, name), Message: "is not a known field"})
+			}
+		}
+	}
+}
+
+// checkOneOf checks a union. Unions of messages pick their member by the "type" field so
+// the errors are those of the intended member rather than of every member.
+func (s *messageSchema) checkOneOf(node *schemaNode, value any, path string, errs *[]FieldError) {
+	if object, ok := value.(map[string]any); ok {
+		if messageType, ok := object["type"].(string); ok {
+			for _, member := range node.OneOf {
+				name := strings.TrimPrefix(member.Ref, "#/definitions/")
+				if name == messageType && s.definitions[name] != nil {
+					s.check(member, value, path, errs)
+					return
+				}
+			}
+			*errs = append(*errs, FieldError{Field: joinField(path, "type"), Message: fmt.Sprintf("%q is not a known type", messageType)})
+			return
+		}
+	}
+
+	matches := 0
+	for _, member := range node.OneOf {
+		if s.matches(member, value) {
+			matches++
+		}
+	}
+	if matches != 1 {
+		*errs = append(*errs, FieldError{Field: path, Message: "must match exactly one of the allowed shapes"})
+	}
+}
+
+// matches reports whether a value matches a node. A message matches a message definition
+// if it has its type, even if its fields don't match.
+func (s *messageSchema) matches(node *schemaNode, value any) bool {
+	if definition := s.definitions[strings.TrimPrefix(node.Ref, "#/definitions/")]; definition != nil {
+		if typeNode := definition.Properties["type"]; typeNode != nil && typeNode.Const != nil {
+			object, ok := value.(map[string]any)
+			return ok && object["type"] == *typeNode.Const
+		}
+	}
+	var errs []FieldError
+	s.check(node, value, "", &errs)
+	return len(errs) == 0
+}
+
+func hasSchemaType(value any, schemaType string) bool {
+	switch schemaType {
+	case "null":
+		return value == nil
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := number.Float64()
+		return err == nil && f == math.Trunc(f)
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	}
+	return false
+}
+
+// describeTypes names the allowed types, e.g. "a string or null"
+func describeTypes(types []string) string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		switch t {
+		case "null":
+			names[i] = "null"
+		case "integer", "object", "array":
+			names[i] = "an " + t
+		default:
+			names[i] = "a " + t
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func quoteAll(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// joinField appends a property name to a field path
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
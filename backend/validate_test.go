@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		errors  []FieldError
+	}{
+		{
+			"valid",
+			`{"type":"CreateTodo","commandId":"c1","id":"t1","name":"Milk","sortOrder":1000}`,
+			nil,
+		},
+		{
+			"integer written as a float",
+			`{"type":"CreateTodo","commandId":"c1","id":"t1","name":"Milk","sortOrder":1000.0}`,
+			nil,
+		},
+		{
+			"wrong type",
+			`{"type":"CreateTodo","commandId":"c1","id":"t1","name":"Milk","sortOrder":"first"}`,
+			[]FieldError{{Field: "sortOrder", Message: "must be an integer"}},
+		},
+		{
+			"fraction for an integer",
+			`{"type":"CreateTodo","commandId":"c1","id":"t1","name":"Milk","sortOrder":1.5}`,
+			[]FieldError{{Field: "sortOrder", Message: "must be an integer"}},
+		},
+		{
+			"every problem is reported",
+			`{"type":"CreateTodo","commandId":"c1","name":7,"colour":"red"}`,
+			[]FieldError{
+				{Field: "id", Message: "is required"},
+				{Field: "colour", Message: "is not a known field"},
+				{Field: "name", Message: "must be a string"},
+			},
+		},
+		{
+			"enum",
+			`{"type":"SetDuplicatePolicy","commandId":"c1","policy":"sometimes"}`,
+			[]FieldError{{Field: "policy", Message: `must be one of "allow", "merge", "reject"`}},
+		},
+		{
+			"nullable",
+			`{"type":"CreateTodo","commandId":"c1","id":"t1","name":"Milk","categoryId":null}`,
+			nil,
+		},
+		{
+			"batch commands",
+			`{"type":"Batch","commandId":"b1","commands":[
+				{"type":"CompleteTodo","commandId":"b1-0"},
+				{"type":"Batch","commandId":"b1-1","commands":[{"type":"CompleteTodo","commandId":"b1-1-0","id":"t1"}]},
+				{"type":"Shout","commandId":"b1-2"}]}`,
+			[]FieldError{
+				{Field: "commands[0].id", Message: "is required"},
+				{Field: "commands[1]", Message: "can't be a Batch"},
+				{Field: "commands[2].type", Message: `"Shout" is not a known type`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCommand([]byte(tt.command))
+			if tt.errors == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.ElementsMatch(t, tt.errors, validationErr.Errors)
+		})
+	}
+}
+
+func TestValidateCommand_LeavesOtherMessagesToCaller(t *testing.T) {
+	for _, message := range []string{`not json`, `[1,2]`, `{"type":"NoSuchCommand"}`, `{"type":"TodoCreated"}`} {
+		assert.NoError(t, validateCommand([]byte(message)), message)
+	}
+}
+
+func TestValidationError_Message(t *testing.T) {
+	err := &ValidationError{Type: "CreateTodo", Errors: []FieldError{
+		{Field: "id", Message: "is required"},
+		{Field: "sortOrder", Message: "must be an integer"},
+	}}
+	assert.Equal(t, "invalid CreateTodo: id is required; sortOrder must be an integer", err.Error())
+}
+
+func TestParseCommand_RejectsSchemaMismatch(t *testing.T) {
+	_, err := ParseCommand([]byte(`{"type":"RenameTodo","commandId":"c1","id":"t1","name":["Milk"]}`))
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []FieldError{{Field: "name", Message: "must be a string"}}, validationErr.Errors)
+}
+
+func TestValidateEvent_History(t *testing.T) {
+	// Every shape earlier versions wrote must still match the schema once upcast
+	history, err := os.ReadFile(filepath.Join("testdata", "events", "history.jsonl"))
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	require.NoError(t, os.WriteFile(path, history, 0o644))
+
+	store, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true})
+	require.NoError(t, err)
+	defer store.Close()
+	events, err := store.ReadAll()
+	require.NoError(t, err)
+
+	for _, event := range events {
+		assert.NoError(t, validateEvent(event), event.EventType())
+	}
+}
+
+func TestValidateEvent_RejectsMismatch(t *testing.T) {
+	err := validateEvent(CategoryRenamed{Type: "TodoCreated", ID: "c1", Name: "Dairy"})
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "CategoryRenamed", validationErr.Type)
+	assert.Equal(t, []FieldError{{Field: "type", Message: `must be "CategoryRenamed"`}}, validationErr.Errors)
+}
+
+func TestAPI_InvalidCommandListsFieldErrors(t *testing.T) {
+	_, ts := setupTestAPI(t)
+
+	status, cmdResp := postCommand(t, ts, `{"type":"CreateTodo","commandId":"c1","id":"t1","sortOrder":"first"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, status)
+	assert.Equal(t, "c1", cmdResp.CommandID)
+	assert.False(t, cmdResp.Success)
+	assert.Equal(t, ErrorCodeInvalidFields, cmdResp.Code)
+	assert.ElementsMatch(t, []FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "sortOrder", Message: "must be an integer"},
+	}, cmdResp.Errors)
+}
+
+func TestServer_InvalidCommandAnsweredWithFieldErrors(t *testing.T) {
+	_, ts, wsURL := setupTestServer(t)
+	defer ts.Close()
+
+	conn := connectWS(t, wsURL)
+	defer conn.Close()
+
+	// Read initial rollup and client count
+	conn.ReadMessage()
+	conn.ReadMessage()
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"CompleteTodo","commandId":"c1","id":"t1","done":true}`))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, respMsg, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var cmdResp CommandResponse
+	require.NoError(t, json.Unmarshal(respMsg, &cmdResp))
+	assert.Equal(t, "c1", cmdResp.CommandID)
+	assert.False(t, cmdResp.Success)
+	assert.Equal(t, []FieldError{{Field: "done", Message: "is not a known field"}}, cmdResp.Errors)
+}
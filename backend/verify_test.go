@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksum_RoundTrip(t *testing.T) {
+	event := []byte(`{"type":"TodoRenamed","id":"todo-1","name":"a \"checksum\":\"x\"}"}`)
+
+	for _, mode := range []ChecksumMode{ChecksumCRC, ChecksumChain} {
+		line, head := addChecksum(event, mode, nil)
+		assert.True(t, json.Valid(line), "checksummed JSON stays valid JSON: %s", line)
+
+		var verifier lineVerifier
+		payload, _, err := verifier.verify(line)
+		require.NoError(t, err)
+		assert.Equal(t, event, payload)
+		if mode == ChecksumChain {
+			assert.Equal(t, head, verifier.prev)
+		}
+	}
+
+	// Encrypted records aren't JSON; the checksum follows a tab
+	record := []byte("enc:v1:abcd:Zm9v")
+	line, _ := addChecksum(record, ChecksumCRC, nil)
+	assert.Equal(t, "enc:v1:abcd:Zm9v\tcrc32c:", string(line[:len(record)+8]))
+	var verifier lineVerifier
+	payload, _, err := verifier.verify(line)
+	require.NoError(t, err)
+	assert.Equal(t, record, payload)
+
+	// No checksum, nothing to check
+	payload, kind, err := verifier.verify(event)
+	require.NoError(t, err)
+	assert.Equal(t, event, payload)
+	assert.Equal(t, lineUnchecked, kind)
+}
+
+func TestChecksum_JSONLineChecksumOnlyInField(t *testing.T) {
+	event := []byte(`{"type":"ListTitleChanged","title":"Groceries"}`)
+	crcLine, _ := addChecksum([]byte("enc:v1:abcd:Zm9v"), ChecksumCRC, nil)
+	tabSum := crcLine[bytes.IndexByte(crcLine, '\t'):]
+
+	// A tab form checksum is never split off a JSON line
+	var verifier lineVerifier
+	_, _, err := verifier.verify(append(append([]byte{}, event...), tabSum...))
+	assert.ErrorIs(t, err, errMissingChecksum)
+
+	// Not even when the line was cut short inside its checksum field
+	fieldLine, _ := addChecksum(event, ChecksumCRC, nil)
+	truncated := append(append([]byte{}, fieldLine[:len(fieldLine)-4]...), tabSum...)
+	_, _, err = verifier.verify(truncated)
+	assert.ErrorIs(t, err, errMissingChecksum)
+}
+
+func TestChecksum_DetectsChanges(t *testing.T) {
+	event := []byte(`{"type":"ListTitleChanged","title":"Groceries"}`)
+	crcLine, _ := addChecksum(event, ChecksumCRC, nil)
+	var verifier lineVerifier
+	_, _, err := verifier.verify(bytes.Replace(crcLine, []byte("Groceries"), []byte("Grocerief"), 1))
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+
+	_, _, err = verifier.verify(bytes.Replace(crcLine, []byte("crc32c:"), []byte("md5:"), 1))
+	assert.ErrorContains(t, err, "unknown checksum")
+
+	// A chained line must follow the line it was chained to
+	first, head := addChecksum(event, ChecksumChain, nil)
+	second, _ := addChecksum(event, ChecksumChain, head)
+	third, _ := addChecksum(event, ChecksumChain, chainHash(head, event))
+
+	verifier = lineVerifier{}
+	for _, line := range [][]byte{first, second, third} {
+		_, _, err := verifier.verify(line)
+		require.NoError(t, err)
+	}
+
+	verifier = lineVerifier{}
+	_, kind, err := verifier.verify(first)
+	require.NoError(t, err)
+	assert.Equal(t, lineChainStart, kind)
+	_, _, err = verifier.verify(third)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+}
+
+func TestChecksumMode_Validate(t *testing.T) {
+	assert.NoError(t, ChecksumChain.Validate())
+	assert.Error(t, ChecksumMode("md5").Validate())
+	assert.Error(t, StoreOptions{Durability: DurabilityBatch, Checksums: "md5"}.Validate())
+	assert.NoError(t, StoreOptions{Durability: DurabilityBatch}.Validate(), "no checksums")
+}
+
+func TestJSONLStore_ReportsFirstBrokenLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	store, err := NewJSONLStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendBatch([]Event{createdEvent(1), createdEvent(2), createdEvent(3)}))
+	require.NoError(t, store.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"checksum":"crc32c:`, "checksums are on by default")
+	lines := strings.SplitAfter(string(data), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+strings.Replace(lines[1], "Item 2", "Item 9", 1)+lines[2]), 0o644))
+
+	reader, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch, ReadOnly: true})
+	require.NoError(t, err)
+	_, err = reader.ReadAll()
+	var corruption *LogCorruptionError
+	require.ErrorAs(t, err, &corruption)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.Equal(t, "events.jsonl", corruption.File)
+	assert.Equal(t, 2, corruption.Line)
+	assert.Equal(t, int64(len(lines[0])), corruption.Offset)
+}
+
+func TestJSONLStore_HashChainContinuesAcrossRestartsAndSegments(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "events.jsonl")
+	chained := func(opts *StoreOptions) {
+		opts.Checksums = ChecksumChain
+		opts.CompressSegments = true
+	}
+
+	store := openSegmentedStore(t, path, chained)
+	for i := range 10 {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+	require.NoError(t, store.Close())
+
+	store = openSegmentedStore(t, path, chained)
+	for i := 10; i < 20; i++ {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+	require.NoError(t, store.Close())
+	require.NotEmpty(t, segmentNames(t, path))
+
+	report, err := verifyStore(StoreBackendJSONL, path, DefaultStoreOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 20, report.Events)
+	assert.Equal(t, 20, report.Chained)
+	assert.Equal(t, "events.000001.jsonl.gz line 1", report.ChainStart)
+	assert.Empty(t, report.Issues)
+}
+
+func TestVerify_DetectsRemovedChainedLine(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "events.jsonl")
+	opts := DefaultStoreOptions()
+	opts.Checksums = ChecksumChain
+	store, err := NewJSONLStoreWithOptions(path, opts)
+	require.NoError(t, err)
+	for i := range 4 {
+		require.NoError(t, store.Append(createdEvent(i)))
+	}
+	require.NoError(t, store.Close())
+
+	// Drop the second line
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(lines[0]+lines[2]+lines[3]), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, runVerify(nil, StoreBackendJSONL, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "first broken line is events.jsonl line 2 (offset "+strconv.Itoa(len(lines[0]))+"): checksum mismatch: hash chain broken")
+}
+
+func TestVerify_ReportsSuspiciousLinesAndOrphans(t *testing.T) {
+	dataDir := t.TempDir()
+	path := filepath.Join(dataDir, "events.jsonl")
+	groceries := "cat-1"
+
+	// Written before checksums existed
+	legacy, err := NewJSONLStoreWithOptions(path, StoreOptions{Durability: DurabilityBatch})
+	require.NoError(t, err)
+	require.NoError(t, legacy.AppendBatch([]Event{
+		createdEvent(1),
+		CategoryCreated{Type: "CategoryCreated", ID: groceries, Name: "Groceries", CreatedAt: time.Now().UTC()},
+	}))
+	require.NoError(t, legacy.Close())
+
+	store, err := NewJSONLStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendBatch([]Event{
+		CategoryDeleted{Type: "CategoryDeleted", ID: groceries},
+		TodoCategorized{Type: "TodoCategorized", ID: "todo-1", CategoryID: &groceries},
+		TodoCompleted{Type: "TodoCompleted", ID: "todo-404", CompletedAt: time.Now().UTC()},
+	}))
+	require.NoError(t, store.Close())
+
+	// A line added by hand
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"type":"ListTitleChanged","title":"Edited"}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, runVerify(nil, StoreBackendJSONL, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+	out := stdout.String()
+	assert.Contains(t, out, "6 events read: 3 with crc32c checksum, 0 hash-chained, 3 without checksum")
+	assert.Contains(t, out, "event 3 (TodoCategorized): puts todo into deleted category cat-1")
+	assert.Contains(t, out, "event 4 (TodoCompleted): refers to unknown todo todo-404")
+	assert.Contains(t, out, "events.jsonl line 6: line has no checksum, but earlier lines have")
+	assert.NotContains(t, out, "line 1:", "lines from before checksums were enabled are fine")
+	assert.Contains(t, stderr.String(), "3 issues found")
+}
+
+func TestVerify_IntactLog(t *testing.T) {
+	for _, backend := range []StoreBackend{StoreBackendJSONL, StoreBackendBolt} {
+		t.Run(string(backend), func(t *testing.T) {
+			dataDir := t.TempDir()
+			path, _ := backend.Path(dataDir)
+			store, err := OpenEventStore(backend, path, DefaultStoreOptions())
+			require.NoError(t, err)
+			require.NoError(t, store.AppendBatch([]Event{createdEvent(1), TodoCompleted{Type: "TodoCompleted", ID: "todo-1", CompletedAt: time.Now().UTC()}}))
+			// bbolt keeps the file locked, so only the JSONL log can be
+			// verified while the server is running
+			if backend == StoreBackendBolt {
+				var stdout, stderr bytes.Buffer
+				assert.Equal(t, 1, runVerify(nil, backend, dataDir, DefaultStoreOptions(), &stdout, &stderr))
+				assert.Contains(t, stderr.String(), "stop the server")
+				require.NoError(t, store.Close())
+			}
+
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, 0, runVerify(nil, backend, dataDir, DefaultStoreOptions(), &stdout, &stderr), stderr.String())
+			assert.Contains(t, stdout.String(), "2 events read")
+			assert.Contains(t, stdout.String(), "event log is intact")
+			if backend == StoreBackendJSONL {
+				require.NoError(t, store.Close())
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+import { describe, it, expect } from 'vitest';
+import { errorText } from './errors';
+
+describe('errorText', () => {
+  it('fills the template of the code in the given language', () => {
+    const failure = { code: 'category_name_taken' as const, params: { name: 'Mejeri' }, error: "category with name 'Mejeri' already exists" };
+
+    expect(errorText(failure, 'en')).toBe("category with name 'Mejeri' already exists");
+    expect(errorText(failure, 'sv')).toBe("det finns redan en kategori som heter 'Mejeri'");
+  });
+
+  it('leaves placeholders within param values alone', () => {
+    const failure = { code: 'names_already_grouped' as const, params: { name: '{other}', other: '{name}' } };
+
+    expect(errorText(failure, 'en')).toBe("'{other}' is already grouped with '{name}'");
+  });
+
+  it('falls back to the English message without a code', () => {
+    expect(errorText({ error: 'something broke' }, 'sv')).toBe('something broke');
+    expect(errorText({}, 'sv')).toBe('Command failed');
+  });
+});
@@ -0,0 +1,35 @@
+import {errorCodeMessages, type ErrorCode} from "./types"
+
+// Languages the server's error codes have message templates in
+export type Language = keyof typeof errorCodeMessages
+
+// The parts of a CommandResponse or CommandResult that say why a command failed
+export interface CommandFailure {
+  error?: string
+  code?: ErrorCode
+  params?: Record<string, string>
+}
+
+// userLanguage picks the first of the browser's languages with message templates
+export function userLanguage(): Language {
+  const preferred = typeof navigator === "undefined" ? [] : navigator.languages ?? [navigator.language]
+  for (const tag of preferred) {
+    const language = tag.toLowerCase().split("-")[0]
+    if (language in errorCodeMessages) {
+      return language as Language
+    }
+  }
+  return "en"
+}
+
+// errorText renders why a command failed in the given language, filling the {name}
+// placeholders of the code's template from its params in a single pass, so placeholders
+// within param values, which may be user text, are left alone
+export function errorText(failure: CommandFailure, language: Language = userLanguage()): string {
+  if (!failure.code) {
+    return failure.error || "Command failed"
+  }
+  const params = failure.params ?? {}
+  const fill = (placeholder: string, name: string) => (Object.hasOwn(params, name) ? params[name] : placeholder)
+  return errorCodeMessages[language][failure.code].replace(/\{(\w+)\}/g, fill)
+}
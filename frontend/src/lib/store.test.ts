@@ -85,6 +85,24 @@ describe('TodoStore', () => {
     store.destroy();
   });
 
+  it('should ask for a reload when the server requires it', () => {
+    const store = createTodoStore('ws://localhost:8080/ws');
+    expect(get(store.reloadRequired)).toBeNull();
+
+    messageHandler!({
+      type: 'ReloadRequired',
+      protocolVersion: 3,
+      minProtocolVersion: 3,
+      error: 'this version of the app is out of date (protocol 2, the server needs 3); reload to update',
+      code: 'client_too_old',
+      params: { version: '2', min: '3' },
+    });
+
+    expect(get(store.reloadRequired)).toContain('3');
+
+    store.destroy();
+  });
+
   it('should apply TodoCreated event to add new todo', () => {
     const store = createTodoStore('ws://localhost:8080/ws');
     
@@ -108,6 +126,28 @@ describe('TodoStore', () => {
     store.destroy();
   });
 
+  it('should apply every event of an EventBatch in order', () => {
+    const store = createTodoStore('ws://localhost:8080/ws');
+
+    messageHandler!({ type: 'StateRollup', todos: [], categories: [], listTitle: 'Title' });
+
+    messageHandler!({
+      type: 'EventBatch',
+      commandId: 'batch-1',
+      events: [
+        { type: 'TodoCreated', id: 'a', name: 'Flour', createdAt: '2024-01-01T00:00:00Z', sortOrder: 1000 },
+        { type: 'TodoCreated', id: 'b', name: 'Sugar', createdAt: '2024-01-01T00:00:00Z', sortOrder: 2000 },
+        { type: 'TodoRenamed', id: 'a', name: 'Rye flour' },
+      ],
+    });
+
+    const todos = get(store.todos);
+    expect(todos).toHaveLength(2);
+    expect(todos.map((t) => t.name)).toEqual(['Sugar', 'Rye flour']);
+
+    store.destroy();
+  });
+
   it('should load categories from rollup and expose categoryLookup', () => {
     const store = createTodoStore('ws://localhost:8080/ws');
 
@@ -198,6 +238,68 @@ describe('TodoStore', () => {
     store.destroy();
   });
 
+  it('should apply quantity changes', () => {
+    const store = createTodoStore('ws://localhost:8080/ws');
+
+    messageHandler!({
+      type: 'StateRollup',
+      todos: [{ id: '1', name: 'Milk', createdAt: '2024-01-01T00:00:00Z', completedAt: null, sortOrder: 1000, starred: false, quantity: 1 }],
+      categories: [],
+      listTitle: 'My Todo List',
+    });
+    messageHandler!({ type: 'TodoQuantityChanged', id: '1', quantity: 3 });
+
+    expect(get(store.todos)[0].quantity).toBe(3);
+
+    store.destroy();
+  });
+
+  it('should drop the optimistic todo when the create is merged into an existing one', async () => {
+    const store = createTodoStore('ws://localhost:8080/ws');
+    const milk = { id: '1', name: 'Milk', createdAt: '2024-01-01T00:00:00Z', completedAt: null, sortOrder: 1000, starred: false, quantity: 1 };
+
+    messageHandler!({ type: 'StateRollup', todos: [milk], categories: [], listTitle: 'My Todo List' });
+    store.createTodo('milk');
+    expect(get(store.todos)).toHaveLength(2);
+
+    const sent = JSON.parse(mockSend.mock.calls[0][0]);
+    messageHandler!({ type: 'TodoQuantityChanged', id: '1', quantity: 2 });
+    messageHandler!({ type: 'CommandResponse', commandId: sent.commandId, success: true, duplicate: { ...milk, quantity: 2 } });
+    await Promise.resolve();
+
+    const todos = get(store.todos);
+    expect(todos).toHaveLength(1);
+    expect(todos[0].quantity).toBe(2);
+
+    store.destroy();
+  });
+
+  it('should drop the optimistic todo and show why when the create is rejected as a duplicate', async () => {
+    const store = createTodoStore('ws://localhost:8080/ws');
+    const milk = { id: '1', name: 'Milk', createdAt: '2024-01-01T00:00:00Z', completedAt: null, sortOrder: 1000, starred: false, quantity: 1 };
+
+    messageHandler!({ type: 'StateRollup', todos: [milk], categories: [], listTitle: 'My Todo List' });
+    store.createTodo('milk');
+
+    const sent = JSON.parse(mockSend.mock.calls[0][0]);
+    messageHandler!({
+      type: 'CommandResponse',
+      commandId: sent.commandId,
+      success: false,
+      error: "'Milk' is already on the list",
+      code: 'duplicate_todo',
+      params: { name: 'Milk' },
+      duplicate: milk,
+    });
+    await Promise.resolve();
+    await Promise.resolve();
+
+    expect(get(store.todos)).toHaveLength(1);
+    expect(get(store.errorMessage)).toContain('Milk');
+
+    store.destroy();
+  });
+
   it('should sort todos by sortOrder descending', () => {
     const store = createTodoStore('ws://localhost:8080/ws');
     
@@ -1,6 +1,7 @@
 import {writable, derived, get} from "svelte/store"
 import {v4 as uuidv4} from "uuid"
 import {TodoWebSocket, ConnectionState} from "./websocket"
+import {errorText} from "./errors"
 import type {
   Todo,
   Category,
@@ -14,6 +15,7 @@ import type {
   TodoReordered,
   TodoRenamed,
   TodoCategorized,
+  TodoQuantityChanged,
   CategoryCreated,
   CategoryRenamed,
   CategoryDeleted,
@@ -33,6 +35,7 @@ import type {
   ReorderTodo,
   RenameTodo,
   SetListTitle,
+  CommandResponse,
   AutocompleteResponse,
   AutocompleteSuggestion,
 } from "./types"
@@ -69,6 +72,7 @@ export interface TodoStore {
   autocompleteSuggestions: ReturnType<typeof writable<AutocompleteSuggestion[]>>
   errorMessage: ReturnType<typeof writable<string | null>>
   isSynced: ReturnType<typeof writable<boolean>>
+  reloadRequired: ReturnType<typeof writable<string | null>> // Why the app must be reloaded, once the server turned it away
   createTodo: (name: string, categoryId?: string | null) => void
   createCategory: (name: string, id?: string) => Promise<string>
   renameCategory: (id: string, name: string) => Promise<void>
@@ -86,6 +90,9 @@ export interface TodoStore {
   destroy: () => void
 }
 
+// COMMAND_TIMEOUT rejects commands the server never answered
+const COMMAND_TIMEOUT = "Command timeout"
+
 export function createTodoStore(wsUrl: string): TodoStore {
   const todosMap = writable<Map<string, Todo>>(new Map())
   const categoriesMap = writable<Map<string, Category>>(new Map())
@@ -95,6 +102,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
   const autocompleteSuggestions = writable<AutocompleteSuggestion[]>([])
   const errorMessage = writable<string | null>(null)
   const isSynced = writable<boolean>(false)
+  const reloadRequired = writable<string | null>(null)
   let errorTimeout: number | null = null
 
   // Track pending autocomplete request to match responses
@@ -102,7 +110,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
 
   // Track pending commands to match responses
   type PendingCommand = {
-    resolve: () => void
+    resolve: (response: CommandResponse) => void
     reject: (error: string) => void
   }
   const pendingCommands = new Map<string, PendingCommand>()
@@ -194,6 +202,17 @@ export function createTodoStore(wsUrl: string): TodoStore {
       return
     }
 
+    if (message.type === "Welcome") {
+      // The StateRollup follows
+      return
+    }
+
+    if (message.type === "ReloadRequired") {
+      // This build is too old for the server; it only talks to us again after a reload
+      reloadRequired.set(errorText(message))
+      return
+    }
+
     if (message.type === "ClientCount") {
       userCount.set(message.count)
       return
@@ -204,15 +223,22 @@ export function createTodoStore(wsUrl: string): TodoStore {
       const pending = pendingCommands.get(message.commandId)
       if (pending) {
         if (message.success) {
-          pending.resolve()
+          pending.resolve(message)
         } else {
-          pending.reject(message.error || "Command failed")
+          pending.reject(errorText(message))
         }
         pendingCommands.delete(message.commandId)
       }
       return
     }
 
+    if (message.type === "EventBatch") {
+      for (const event of message.events) {
+        applyEvent(event)
+      }
+      return
+    }
+
     // Handle events
     applyEvent(message as Event)
   }
@@ -255,10 +281,20 @@ export function createTodoStore(wsUrl: string): TodoStore {
             sortOrder: e.sortOrder,
             starred: false,
             categoryId: e.categoryId ?? null,
+            quantity: 1,
           })
           break
         }
 
+        case "TodoQuantityChanged": {
+          const e = event as TodoQuantityChanged
+          const todo = newMap.get(e.id)
+          if (todo) {
+            newMap.set(e.id, {...todo, quantity: e.quantity})
+          }
+          break
+        }
+
         case "TodoCompleted": {
           const e = event as TodoCompleted
           const todo = newMap.get(e.id)
@@ -405,7 +441,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
   function sendCommand(
     command: Command,
     optimisticEvent?: Event
-  ): Promise<void> {
+  ): Promise<CommandResponse> {
     return new Promise((resolve, reject) => {
       // Apply optimistically if provided
       if (optimisticEvent) {
@@ -423,7 +459,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
       setTimeout(() => {
         if (pendingCommands.has(commandId)) {
           pendingCommands.delete(commandId)
-          reject("Command timeout")
+          reject(COMMAND_TIMEOUT)
         }
       }, 10000)
     })
@@ -451,6 +487,30 @@ export function createTodoStore(wsUrl: string): TodoStore {
       categoryId,
     }
     sendCommand(command, optimistic)
+      .then((response) => {
+        // Merged into an existing todo, whose TodoQuantityChanged is broadcast instead
+        if (response.duplicate && response.duplicate.id !== id) {
+          removeTodo(id)
+        }
+      })
+      .catch((error: string) => {
+        if (error === COMMAND_TIMEOUT) {
+          // The todo may still have been created; the next rollup tells
+          return
+        }
+        // Rejected, e.g. because the item is already on the list
+        removeTodo(id)
+        showError(error)
+      })
+  }
+
+  // removeTodo drops an optimistic todo the server never created
+  function removeTodo(id: string) {
+    todosMap.update((map) => {
+      const newMap = new Map(map)
+      newMap.delete(id)
+      return newMap
+    })
   }
 
   function createCategory(name: string, id?: string): Promise<string> {
@@ -482,7 +542,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
       name,
     }
     // No optimistic update - wait for server response
-    return sendCommand(command)
+    return sendCommand(command).then(() => {})
   }
 
   function deleteCategory(id: string) {
@@ -622,6 +682,7 @@ export function createTodoStore(wsUrl: string): TodoStore {
     autocompleteSuggestions,
     errorMessage,
     isSynced,
+    reloadRequired,
     createTodo,
     createCategory,
     renameCategory,
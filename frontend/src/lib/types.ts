@@ -1,25 +1,151 @@
-// Generated from schema/events.schema.json
-// Do not edit manually - run schema/generate.sh to regenerate
+// Code generated by schemagen from schema/events.schema.json. DO NOT EDIT.
+// Run go generate in backend/ to regenerate.
 
-// Todo item projected from events
-export interface Todo {
+// ClientCount message sent from server to clients
+export interface ClientCount {
+  type: "ClientCount"
+  count: number
+}
+
+export interface CreateTodo {
+  type: "CreateTodo"
+  commandId: string
   id: string
   name: string
-  createdAt: string
-  completedAt: string | null
-  sortOrder: number
-  starred: boolean
+  sortOrder?: number
   categoryId?: string | null
 }
 
-export interface Category {
+export interface CompleteTodo {
+  type: "CompleteTodo"
+  commandId: string
+  id: string
+}
+
+export interface UncompleteTodo {
+  type: "UncompleteTodo"
+  commandId: string
+  id: string
+}
+
+export interface StarTodo {
+  type: "StarTodo"
+  commandId: string
+  id: string
+}
+
+export interface UnstarTodo {
+  type: "UnstarTodo"
+  commandId: string
+  id: string
+}
+
+export interface ReorderTodo {
+  type: "ReorderTodo"
+  commandId: string
+  id: string
+  sortOrder: number
+}
+
+export interface RenameTodo {
+  type: "RenameTodo"
+  commandId: string
   id: string
   name: string
-  createdAt: string
+}
+
+export interface SetListTitle {
+  type: "SetListTitle"
+  commandId: string
+  title: string
+}
+
+export interface CategorizeTodo {
+  type: "CategorizeTodo"
+  commandId: string
+  id: string
+  categoryId: string | null
+}
+
+export interface CreateCategory {
+  type: "CreateCategory"
+  commandId: string
+  id: string
+  name: string
+  sortOrder?: number
+}
+
+export interface RenameCategory {
+  type: "RenameCategory"
+  commandId: string
+  id: string
+  name: string
+}
+
+export interface DeleteCategory {
+  type: "DeleteCategory"
+  commandId: string
+  id: string
+}
+
+export interface ReorderCategory {
+  type: "ReorderCategory"
+  commandId: string
+  id: string
   sortOrder: number
 }
 
-// Event types
+export interface AddSynonym {
+  type: "AddSynonym"
+  commandId: string
+  name: string
+  canonical: string
+}
+
+export interface RemoveSynonym {
+  type: "RemoveSynonym"
+  commandId: string
+  name: string
+}
+
+export interface SetDuplicatePolicy {
+  type: "SetDuplicatePolicy"
+  commandId: string
+  policy: DuplicatePolicy
+}
+
+export interface ForgetName {
+  type: "ForgetName"
+  commandId: string
+  name: string
+}
+
+export interface PinName {
+  type: "PinName"
+  commandId: string
+  name: string
+}
+
+export interface UnpinName {
+  type: "UnpinName"
+  commandId: string
+  name: string
+}
+
+export interface MergeNames {
+  type: "MergeNames"
+  commandId: string
+  from: string
+  into: string
+}
+
+// Several commands validated, persisted and applied together; if one is rejected none are applied. Batches can't be nested.
+export interface Batch {
+  type: "Batch"
+  commandId: string
+  commands: Exclude<Command, Batch>[]
+}
+
 export interface TodoCreated {
   type: "TodoCreated"
   id: string
@@ -99,103 +225,266 @@ export interface ListTitleChanged {
   title: string
 }
 
-// Command types (client -> server)
-export interface CreateTodo {
-  type: "CreateTodo"
-  commandId: string
-  id: string
+export interface SynonymAdded {
+  type: "SynonymAdded"
   name: string
-  sortOrder?: number
-  categoryId?: string | null
+  canonical: string
 }
 
-export interface CategorizeTodo {
-  type: "CategorizeTodo"
-  commandId: string
-  id: string
-  categoryId: string | null
+export interface SynonymRemoved {
+  type: "SynonymRemoved"
+  name: string
 }
 
-export interface CreateCategory {
-  type: "CreateCategory"
-  commandId: string
+export interface TodoQuantityChanged {
+  type: "TodoQuantityChanged"
   id: string
+  quantity: number
+}
+
+export interface DuplicatePolicyChanged {
+  type: "DuplicatePolicyChanged"
+  policy: DuplicatePolicy
+}
+
+export interface NameForgotten {
+  type: "NameForgotten"
   name: string
-  sortOrder?: number
 }
 
-export interface RenameCategory {
-  type: "RenameCategory"
-  commandId: string
-  id: string
+export interface NamePinned {
+  type: "NamePinned"
   name: string
 }
 
-export interface DeleteCategory {
-  type: "DeleteCategory"
-  commandId: string
-  id: string
+export interface NameUnpinned {
+  type: "NameUnpinned"
+  name: string
 }
 
-export interface ReorderCategory {
-  type: "ReorderCategory"
-  commandId: string
-  id: string
-  sortOrder: number
+export interface NamesMerged {
+  type: "NamesMerged"
+  from: string
+  into: string
 }
 
-export interface CompleteTodo {
-  type: "CompleteTodo"
-  commandId: string
-  id: string
+// StateRollup is sent to clients on connection with the current state
+export interface StateRollup {
+  type: "StateRollup"
+  todos: Todo[]
+  categories: Category[]
+  listTitle: string
+  synonyms?: Synonym[]
+  duplicatePolicy?: DuplicatePolicy
+  pinnedNames?: string[]
+}
+
+// Hello is the first message a client sends after connecting, before it gets any state
+export interface Hello {
+  type: "Hello"
+  // Protocol version the client was built for
+  protocolVersion: number
+  // Build of the client, for logging
+  clientVersion?: string
+}
+
+// Welcome accepts a client's Hello; the StateRollup follows it
+export interface Welcome {
+  type: "Welcome"
+  // Protocol version the server speaks
+  protocolVersion: number
+  // Oldest client protocol version the server accepts
+  minProtocolVersion: number
+  serverVersion: string
+  // VCS revision the server was built from, if known
+  serverCommit?: string
+  features: Feature[]
+}
+
+// ReloadRequired is sent to a client too old for the server before its connection is closed
+export interface ReloadRequired {
+  type: "ReloadRequired"
+  // Protocol version the server speaks
+  protocolVersion: number
+  // Oldest client protocol version the server accepts
+  minProtocolVersion: number
+  // English message of the code
+  error: string
+  code: ErrorCode
+  // Values of the placeholders in the code's message template
+  params?: Record<string, string>
+}
+
+// AutocompleteRequest is sent by clients to request autocomplete suggestions
+export interface AutocompleteRequest {
+  type: "AutocompleteRequest"
+  query: string
+  requestId: string
+  // Defaults to 4, capped at 50
+  limit?: number
+  // Number of ranked suggestions to skip
+  offset?: number
 }
 
-export interface UncompleteTodo {
-  type: "UncompleteTodo"
-  commandId: string
-  id: string
+// AutocompleteResponse contains autocomplete suggestions sent back to the requesting client
+export interface AutocompleteResponse {
+  type: "AutocompleteResponse"
+  suggestions: AutocompleteSuggestion[]
+  requestId: string
+  // Number of matching names across all pages
+  total?: number
 }
 
-export interface StarTodo {
-  type: "StarTodo"
-  commandId: string
-  id: string
+// AutocompleteSuggestion includes the name, optional category context and match details
+export interface AutocompleteSuggestion {
+  name: string
+  categoryId: string | null
+  categoryName: string | null
+  matchType?: MatchType
+  score?: number
+  frequency?: number
+  // Half-open [start, end) rune ranges of name matching the query; empty when the query matched another variant of the name or a synonym
+  matches?: [number, number][]
 }
 
-export interface UnstarTodo {
-  type: "UnstarTodo"
+// Events produced by a Batch, broadcast as one message and applied in order
+export interface EventBatch {
+  type: "EventBatch"
   commandId: string
-  id: string
+  events: Event[]
 }
 
-export interface ReorderTodo {
-  type: "ReorderTodo"
+// Sent to the client that issued a command once it was applied or rejected
+export interface CommandResponse {
+  type: "CommandResponse"
+  commandId: string
+  success: boolean
+  // English message of the code
+  error?: string
+  code?: ErrorCode
+  // Values of the placeholders in the code's message template
+  params?: Record<string, string>
+  // Existing todo a CreateTodo was rejected for or merged into
+  duplicate?: Todo
+  // Per-command outcome of a Batch
+  results?: CommandResult[]
+  // Every field of a command that doesn't match the schema
+  errors?: FieldError[]
+}
+
+// Outcome of one command of a Batch
+export interface CommandResult {
   commandId: string
+  success: boolean
+  // English message of the code
+  error?: string
+  code?: ErrorCode
+  // Values of the placeholders in the code's message template
+  params?: Record<string, string>
+}
+
+// FieldError describes one field of a message that doesn't match the schema
+export interface FieldError {
+  // Path of the field, e.g. commands[1].sortOrder; empty for the message itself
+  field: string
+  message: string
+}
+
+// Why a command or connection was rejected. Clients show the message template of the code in their language, with {name} placeholders filled from the response's params
+export type ErrorCode = "invalid_fields" | "command_type_mismatch" | "no_event" | "todo_not_found" | "duplicate_todo" | "unknown_duplicate_policy" | "category_not_found" | "missing_category_id" | "category_name_taken" | "category_not_empty" | "name_not_in_history" | "missing_merge_target" | "names_already_grouped" | "missing_pin_name" | "name_already_pinned" | "name_not_pinned" | "missing_synonym_name" | "synonym_not_found" | "batch_rejected" | "not_applied" | "not_applied_batch_rejected" | "persist_failed" | "shutting_down" | "client_too_old" | "internal_error"
+
+export const errorCodeMessages: Record<"en" | "sv", Record<ErrorCode, string>> = {
+  en: {
+    invalid_fields: "invalid {type}: {problems}",
+    command_type_mismatch: "{got} is not a {type} command",
+    no_event: "command did not produce an event",
+    todo_not_found: "todo not found",
+    duplicate_todo: "'{name}' is already on the list",
+    unknown_duplicate_policy: "unknown duplicate policy '{policy}'",
+    category_not_found: "category not found",
+    missing_category_id: "missing category id",
+    category_name_taken: "category with name '{name}' already exists",
+    category_not_empty: "cannot delete non-empty category",
+    name_not_in_history: "name not found in history",
+    missing_merge_target: "missing name to merge into",
+    names_already_grouped: "'{name}' is already grouped with '{other}'",
+    missing_pin_name: "missing name to pin",
+    name_already_pinned: "'{name}' is already pinned",
+    name_not_pinned: "name is not pinned",
+    missing_synonym_name: "synonym name and canonical name are required",
+    synonym_not_found: "synonym not found",
+    batch_rejected: "command {index} of the batch was rejected",
+    not_applied: "not applied",
+    not_applied_batch_rejected: "not applied, command {index} was rejected",
+    persist_failed: "failed to persist event",
+    shutting_down: "server is shutting down",
+    client_too_old: "this version of the app is out of date (protocol {version}, the server needs {min}); reload to update",
+    internal_error: "internal error",
+  },
+  sv: {
+    invalid_fields: "ogiltigt {type}: {problems}",
+    command_type_mismatch: "{got} är inte ett {type}-kommando",
+    no_event: "kommandot gav ingen händelse",
+    todo_not_found: "uppgiften finns inte",
+    duplicate_todo: "'{name}' finns redan på listan",
+    unknown_duplicate_policy: "okänd dubblettpolicy '{policy}'",
+    category_not_found: "kategorin finns inte",
+    missing_category_id: "kategorin saknar id",
+    category_name_taken: "det finns redan en kategori som heter '{name}'",
+    category_not_empty: "kategorin kan inte tas bort eftersom den inte är tom",
+    name_not_in_history: "namnet finns inte i historiken",
+    missing_merge_target: "namnet att slå ihop med saknas",
+    names_already_grouped: "'{name}' är redan grupperat med '{other}'",
+    missing_pin_name: "namnet att fästa saknas",
+    name_already_pinned: "'{name}' är redan fäst",
+    name_not_pinned: "namnet är inte fäst",
+    missing_synonym_name: "både synonymen och namnet den står för krävs",
+    synonym_not_found: "synonymen finns inte",
+    batch_rejected: "kommando {index} i gruppen avvisades",
+    not_applied: "inte utfört",
+    not_applied_batch_rejected: "inte utfört, kommando {index} avvisades",
+    persist_failed: "händelsen kunde inte sparas",
+    shutting_down: "servern stängs av",
+    client_too_old: "den här versionen av appen är för gammal (protokoll {version}, servern kräver {min}); ladda om för att uppdatera",
+    internal_error: "internt fel",
+  },
+}
+
+// Optional capabilities a server advertises in its Welcome
+export type Feature = "batch" | "errorCodes" | "duplicatePolicy" | "synonyms" | "pinnedNames" | "autocompletePaging"
+
+// What CreateTodo does when an active todo with the same normalized name exists
+export type DuplicatePolicy = "allow" | "merge" | "reject"
+
+// How an autocomplete suggestion matched the query
+export type MatchType = "all" | "prefix" | "substring" | "fuzzy"
+
+// Todo item projected from events
+export interface Todo {
   id: string
+  name: string
+  createdAt: string
+  completedAt: string | null
   sortOrder: number
+  starred: boolean
+  categoryId?: string | null
+  quantity?: number
 }
 
-export interface RenameTodo {
-  type: "RenameTodo"
-  commandId: string
+// Category projected from events
+export interface Category {
   id: string
   name: string
+  createdAt: string
+  sortOrder: number
 }
 
-export interface SetListTitle {
-  type: "SetListTitle"
-  commandId: string
-  title: string
-}
-
-export interface StateRollup {
-  type: "StateRollup"
-  todos: Todo[]
-  categories: Category[]
-  listTitle: string
+// Synonym maps an alias name to the canonical name it is grouped with
+export interface Synonym {
+  name: string
+  canonical: string
 }
 
-// Union types
 export type Event =
   | TodoCreated
   | TodoCompleted
@@ -210,44 +499,14 @@ export type Event =
   | CategoryDeleted
   | CategoryReordered
   | ListTitleChanged
-
-export interface ClientCount {
-  type: "ClientCount"
-  count: number
-}
-
-// Autocomplete types
-export interface AutocompleteRequest {
-  type: "AutocompleteRequest"
-  query: string
-  requestId: string
-}
-
-export interface AutocompleteSuggestion {
-  name: string
-  categoryId: string | null
-  categoryName: string | null
-}
-
-export interface AutocompleteResponse {
-  type: "AutocompleteResponse"
-  suggestions: AutocompleteSuggestion[]
-  requestId: string
-}
-
-export interface CommandResponse {
-  type: "CommandResponse"
-  commandId: string
-  success: boolean
-  error?: string
-}
-
-export type ServerMessage =
-  | Event
-  | StateRollup
-  | ClientCount
-  | AutocompleteResponse
-  | CommandResponse
+  | SynonymAdded
+  | SynonymRemoved
+  | TodoQuantityChanged
+  | DuplicatePolicyChanged
+  | NameForgotten
+  | NamePinned
+  | NameUnpinned
+  | NamesMerged
 
 export type Command =
   | CreateTodo
@@ -263,8 +522,58 @@ export type Command =
   | DeleteCategory
   | ReorderCategory
   | SetListTitle
+  | AddSynonym
+  | RemoveSynonym
+  | SetDuplicatePolicy
+  | ForgetName
+  | PinName
+  | UnpinName
+  | MergeNames
+  | Batch
+
+export type ServerMessage =
+  | Event
+  | StateRollup
+  | ClientCount
+  | AutocompleteResponse
+  | CommandResponse
+  | EventBatch
+  | Welcome
+  | ReloadRequired
+
+export type ClientMessage =
+  | Hello
+  | Command
+  | AutocompleteRequest
+
+const eventTypes: ReadonlySet<string> = new Set<Event["type"]>([
+  "TodoCreated",
+  "TodoCompleted",
+  "TodoUncompleted",
+  "TodoStarred",
+  "TodoUnstarred",
+  "TodoReordered",
+  "TodoRenamed",
+  "TodoCategorized",
+  "CategoryCreated",
+  "CategoryRenamed",
+  "CategoryDeleted",
+  "CategoryReordered",
+  "ListTitleChanged",
+  "SynonymAdded",
+  "SynonymRemoved",
+  "TodoQuantityChanged",
+  "DuplicatePolicyChanged",
+  "NameForgotten",
+  "NamePinned",
+  "NameUnpinned",
+  "NamesMerged",
+])
+
+export function isEvent(msg: ServerMessage): msg is Event {
+  return eventTypes.has(msg.type)
+}
 
-// Type guards
 export function isTodoCreated(msg: ServerMessage): msg is TodoCreated {
   return msg.type === "TodoCreated"
 }
@@ -293,26 +602,86 @@ export function isTodoRenamed(msg: ServerMessage): msg is TodoRenamed {
   return msg.type === "TodoRenamed"
 }
 
-export function isListTitleChanged(
-  msg: ServerMessage
-): msg is ListTitleChanged {
+export function isTodoCategorized(msg: ServerMessage): msg is TodoCategorized {
+  return msg.type === "TodoCategorized"
+}
+
+export function isCategoryCreated(msg: ServerMessage): msg is CategoryCreated {
+  return msg.type === "CategoryCreated"
+}
+
+export function isCategoryRenamed(msg: ServerMessage): msg is CategoryRenamed {
+  return msg.type === "CategoryRenamed"
+}
+
+export function isCategoryDeleted(msg: ServerMessage): msg is CategoryDeleted {
+  return msg.type === "CategoryDeleted"
+}
+
+export function isCategoryReordered(msg: ServerMessage): msg is CategoryReordered {
+  return msg.type === "CategoryReordered"
+}
+
+export function isListTitleChanged(msg: ServerMessage): msg is ListTitleChanged {
   return msg.type === "ListTitleChanged"
 }
 
-export function isStateRollup(msg: ServerMessage): msg is StateRollup {
-  return msg.type === "StateRollup"
+export function isSynonymAdded(msg: ServerMessage): msg is SynonymAdded {
+  return msg.type === "SynonymAdded"
 }
 
-export function isEvent(msg: ServerMessage): msg is Event {
-  return msg.type !== "StateRollup"
+export function isSynonymRemoved(msg: ServerMessage): msg is SynonymRemoved {
+  return msg.type === "SynonymRemoved"
+}
+
+export function isTodoQuantityChanged(msg: ServerMessage): msg is TodoQuantityChanged {
+  return msg.type === "TodoQuantityChanged"
+}
+
+export function isDuplicatePolicyChanged(msg: ServerMessage): msg is DuplicatePolicyChanged {
+  return msg.type === "DuplicatePolicyChanged"
+}
+
+export function isNameForgotten(msg: ServerMessage): msg is NameForgotten {
+  return msg.type === "NameForgotten"
+}
+
+export function isNamePinned(msg: ServerMessage): msg is NamePinned {
+  return msg.type === "NamePinned"
+}
+
+export function isNameUnpinned(msg: ServerMessage): msg is NameUnpinned {
+  return msg.type === "NameUnpinned"
+}
+
+export function isNamesMerged(msg: ServerMessage): msg is NamesMerged {
+  return msg.type === "NamesMerged"
+}
+
+export function isStateRollup(msg: ServerMessage): msg is StateRollup {
+  return msg.type === "StateRollup"
 }
 
 export function isClientCount(msg: ServerMessage): msg is ClientCount {
   return msg.type === "ClientCount"
 }
 
-export function isAutocompleteResponse(
-  msg: ServerMessage
-): msg is AutocompleteResponse {
+export function isAutocompleteResponse(msg: ServerMessage): msg is AutocompleteResponse {
   return msg.type === "AutocompleteResponse"
 }
+
+export function isCommandResponse(msg: ServerMessage): msg is CommandResponse {
+  return msg.type === "CommandResponse"
+}
+
+export function isEventBatch(msg: ServerMessage): msg is EventBatch {
+  return msg.type === "EventBatch"
+}
+
+export function isWelcome(msg: ServerMessage): msg is Welcome {
+  return msg.type === "Welcome"
+}
+
+export function isReloadRequired(msg: ServerMessage): msg is ReloadRequired {
+  return msg.type === "ReloadRequired"
+}
@@ -1,6 +1,6 @@
 import { describe, it, expect, vi, beforeEach, afterEach } from 'vitest';
-import { TodoWebSocket, ConnectionState } from './websocket';
-import type { ServerMessage, TodoCreated, StateRollup, CreateTodo } from './types';
+import { TodoWebSocket, ConnectionState, PROTOCOL_VERSION } from './websocket';
+import type { ServerMessage, TodoCreated, StateRollup, CreateTodo, ReloadRequired } from './types';
 
 // Mock WebSocket
 class MockWebSocket {
@@ -143,6 +143,53 @@ describe('TodoWebSocket', () => {
     ws.close();
   });
 
+  it('should say hello before anything else', async () => {
+    const ws = new TodoWebSocket('ws://localhost:8080/ws', { enableHeartbeat: false });
+    const command: CreateTodo = {
+      type: 'CreateTodo',
+      commandId: 'queued',
+      id: 'queued-id',
+      name: 'Queued todo',
+    };
+    ws.send(command);
+
+    await vi.runAllTimersAsync();
+
+    mockWs = (ws as any).ws;
+    expect(JSON.parse(mockWs.send.mock.calls[0][0])).toEqual({ type: 'Hello', protocolVersion: PROTOCOL_VERSION });
+    expect(JSON.parse(mockWs.send.mock.calls[1][0])).toEqual(command);
+
+    ws.close();
+  });
+
+  it('should stop reconnecting once a reload is required', async () => {
+    const ws = new TodoWebSocket('ws://localhost:8080/ws', { reconnectDelay: 1000, enableHeartbeat: false });
+    const messages: ServerMessage[] = [];
+    ws.onMessage((msg) => messages.push(msg));
+
+    await vi.runAllTimersAsync();
+
+    mockWs = (ws as any).ws;
+    const reload: ReloadRequired = {
+      type: 'ReloadRequired',
+      protocolVersion: 3,
+      minProtocolVersion: 3,
+      error: 'this version of the app is out of date (protocol 2, the server needs 3); reload to update',
+      code: 'client_too_old',
+      params: { version: '2', min: '3' },
+    };
+    mockWs.simulateMessage(reload);
+    mockWs.simulateClose();
+
+    expect(messages).toEqual([reload]);
+    expect(ws.getConnectionState()).toBe(ConnectionState.DISCONNECTED);
+
+    await vi.advanceTimersByTimeAsync(60000);
+    expect(MockWebSocket.instances).toHaveLength(1);
+
+    ws.close();
+  });
+
   it('should send commands to server', async () => {
     const ws = new TodoWebSocket('ws://localhost:8080/ws', { enableHeartbeat: false });
     
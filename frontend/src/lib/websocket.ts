@@ -1,4 +1,11 @@
-import type { Event, ServerMessage, AutocompleteRequest, AutocompleteResponse, Command } from './types';
+import type { Event, ServerMessage, AutocompleteRequest, AutocompleteResponse, Command, Hello } from './types';
+
+// Protocol version this client speaks, announced in the Hello sent on every connect.
+// Keep it in step with currentProtocolVersion in the backend's protocol.go.
+export const PROTOCOL_VERSION = 2;
+
+// Close code the server uses after a ReloadRequired
+const RELOAD_REQUIRED_CLOSE = 4000;
 
 export enum ConnectionState {
   CONNECTING = 'CONNECTING',
@@ -27,6 +34,7 @@ export class TodoWebSocket {
   private messageQueue: Command[] = [];
   private reconnectAttempts = 0;
   private manualClose = false;
+  private reloadRequired = false; // The server won't talk to this build; reconnecting can't help
   private reconnectTimeout: number | null = null;
   private options: Required<WebSocketOptions>;
   private visibilityHandler: (() => void) | null = null;
@@ -156,6 +164,9 @@ export class TodoWebSocket {
   }
 
   private reconnect() {
+    if (this.reloadRequired) {
+      return;
+    }
     console.log('Forcing reconnection...');
     
     // Clean up old connection completely
@@ -188,6 +199,10 @@ export class TodoWebSocket {
   }
 
   private connect() {
+    if (this.reloadRequired) {
+      return;
+    }
+
     // Clean up existing connection
     if (this.ws) {
       // Remove all event listeners to prevent callbacks on old connection
@@ -214,11 +229,15 @@ export class TodoWebSocket {
     }
 
     try {
+      // No subprotocol is requested, so the server sends JSON text frames. Its MessagePack
+      // subprotocol is for other clients; here the browser's permessage-deflate saves as much.
       this.ws = new WebSocket(this.url);
 
       this.ws.onopen = () => {
         console.log('WebSocket connected');
         this.reconnectAttempts = 0;
+        // The Hello goes first, so the server answers with a Welcome before the state
+        this.sendHello();
         this.setConnectionState(ConnectionState.CONNECTED);
         this.startHeartbeat();
         this.flushMessageQueue();
@@ -238,6 +257,13 @@ export class TodoWebSocket {
           return;
         }
 
+        if (this.reloadRequired || event.code === RELOAD_REQUIRED_CLOSE) {
+          console.log('Server requires a newer app version, not reconnecting');
+          this.reloadRequired = true;
+          this.setConnectionState(ConnectionState.DISCONNECTED);
+          return;
+        }
+
         // Connection was lost unexpectedly
         console.log('Unexpected disconnect, will attempt to reconnect');
         this.setConnectionState(ConnectionState.RECONNECTING);
@@ -259,6 +285,11 @@ export class TodoWebSocket {
           if (message.type === 'AutocompleteResponse') {
             this.notifyAutocompleteHandlers(message as AutocompleteResponse);
           } else {
+            if (message.type === 'Welcome') {
+              console.log('Server', message.serverVersion, 'speaks protocol', message.protocolVersion);
+            } else if (message.type === 'ReloadRequired') {
+              this.reloadRequired = true;
+            }
             this.notifyMessageHandlers(message);
           }
         } catch (e) {
@@ -273,7 +304,7 @@ export class TodoWebSocket {
   }
 
   private scheduleReconnect() {
-    if (this.manualClose) {
+    if (this.manualClose || this.reloadRequired) {
       return;
     }
 
@@ -307,6 +338,14 @@ export class TodoWebSocket {
     }, delay);
   }
 
+  private sendHello() {
+    const hello: Hello = {
+      type: 'Hello',
+      protocolVersion: PROTOCOL_VERSION,
+    };
+    this.ws?.send(JSON.stringify(hello));
+  }
+
   private flushMessageQueue() {
     while (this.messageQueue.length > 0) {
       const command = this.messageQueue.shift()!;